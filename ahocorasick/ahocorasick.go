@@ -66,6 +66,14 @@ func NewAhoCorasickBuilder() AhoCorasickBuilder {
 	}
 }
 
+// AsciiCaseInsensitive enables ASCII case-insensitive matching. Pattern and
+// haystack bytes are both folded to lower case, so that the pattern "eval"
+// also matches "EVAL" and "eVaL". Bytes outside A-Z and a-z are unaffected.
+func (a *AhoCorasickBuilder) AsciiCaseInsensitive(yes bool) *AhoCorasickBuilder {
+	a.nfaBuilder.asciiCaseInsensitive = yes
+	return a
+}
+
 // BuildByte builds an automaton from the user provided patterns.
 func (a *AhoCorasickBuilder) BuildByte(patterns [][]byte) AhoCorasick {
 	nfa := a.nfaBuilder.build(patterns)
@@ -124,7 +132,11 @@ func standardFindAtImp(a *iNFA, prestate *prefilterState, pf *prefilter, haystac
 				}
 			}
 		}
-		sid = a.NextStateNoFail(sid, haystack[at])
+		b := haystack[at]
+		if a.asciiCaseInsensitive {
+			b = toLowerASCII(b)
+		}
+		sid = a.NextStateNoFail(sid, b)
 		at += 1
 
 		if sid == deadStateID || a.hasMatch(sid) {
@@ -162,3 +174,17 @@ func overlappingFindAt(a *iNFA, prestate *prefilterState, haystack []byte, at in
 	*matchIndex = 1
 	return match
 }
+
+func toLowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
+
+func toUpperASCII(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
@@ -88,6 +88,35 @@ func TestIterOverlapping_SubstringPatterns(t *testing.T) {
 	}
 }
 
+func TestIterOverlapping_AsciiCaseInsensitive(t *testing.T) {
+	builder := NewAhoCorasickBuilder()
+	builder.AsciiCaseInsensitive(true)
+	ac := builder.BuildByte([][]byte{[]byte("Eval("), []byte("\xC9t\xE9")})
+	matches := collectMatches(ac, "x=EVAL($y); eval( eVaL[ \xC9T\xE9 \xE9t\xE9")
+
+	var got []int
+	for _, m := range matches {
+		got = append(got, m.Start())
+	}
+	// Only ASCII letters are folded, so the last pattern occurs once.
+	want := []int{2, 12, 24}
+	if len(got) != len(want) {
+		t.Fatalf("expected matches at %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("match %d: expected start %d, got %d", i, want[i], got[i])
+		}
+	}
+}
+
+func TestIterOverlapping_CaseSensitiveByDefault(t *testing.T) {
+	ac := buildAC("eval")
+	if matches := collectMatches(ac, "EVAL Eval"); len(matches) != 0 {
+		t.Errorf("expected no matches, got %d", len(matches))
+	}
+}
+
 func TestIterOverlapping_Parallel(t *testing.T) {
 	ac := buildAC("bear", "masha")
 	haystack := []byte("The bear and masha")
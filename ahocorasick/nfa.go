@@ -1,14 +1,15 @@
 package ahocorasick
 
 type iNFA struct {
-	startID       stateID
-	maxPatternLen int
-	prefil        *prefilter
-	anchored      bool
-	states        []state
-	denseTable    []stateID
-	matches       map[stateID][]pattern
-	matchBitset   []uint64
+	startID              stateID
+	maxPatternLen        int
+	prefil               *prefilter
+	anchored             bool
+	asciiCaseInsensitive bool
+	states               []state
+	denseTable           []stateID
+	matches              map[stateID][]pattern
+	matchBitset          []uint64
 }
 
 func (n *iNFA) hasMatch(id stateID) bool {
@@ -340,6 +341,9 @@ func (c *compiler) buildTrie(patterns [][]byte) {
 		prev := c.nfa.startID
 
 		for depth, b := range pat {
+			if c.builder.asciiCaseInsensitive {
+				b = toLowerASCII(b)
+			}
 			next := c.nfa.nextState(prev, b)
 
 			if next != failedStateID {
@@ -366,25 +370,27 @@ func (c *compiler) addState(depth int) stateID {
 }
 
 func newCompiler(builder iNFABuilder) compiler {
-	p := newPrefilterBuilder()
+	p := newPrefilterBuilder(builder.asciiCaseInsensitive)
 
 	return compiler{
 		builder:   builder,
 		prefilter: p,
 		nfa: iNFA{
-			startID:       2,
-			maxPatternLen: 0,
-			prefil:        nil,
-			anchored:      builder.anchored,
-			matches:       make(map[stateID][]pattern),
+			startID:              2,
+			maxPatternLen:        0,
+			prefil:               nil,
+			anchored:             builder.anchored,
+			matches:              make(map[stateID][]pattern),
+			asciiCaseInsensitive: builder.asciiCaseInsensitive,
 		},
 	}
 }
 
 type iNFABuilder struct {
-	denseDepth int
-	prefilter  bool
-	anchored   bool
+	denseDepth           int
+	prefilter            bool
+	anchored             bool
+	asciiCaseInsensitive bool
 }
 
 func newNFABuilder() *iNFABuilder {
@@ -61,10 +61,14 @@ func (p *prefilterBuilder) add(bytes []byte) {
 	p.rareBytes.add(bytes)
 }
 
-func newPrefilterBuilder() prefilterBuilder {
+func newPrefilterBuilder(asciiCaseInsensitive bool) prefilterBuilder {
+	startBytes := newStartBytesBuilder()
+	startBytes.asciiCaseInsensitive = asciiCaseInsensitive
+	rareBytes := newRareBytesBuilder()
+	rareBytes.asciiCaseInsensitive = asciiCaseInsensitive
 	return prefilterBuilder{
-		startBytes: newStartBytesBuilder(),
-		rareBytes:  newRareBytesBuilder(),
+		startBytes: startBytes,
+		rareBytes:  rareBytes,
 	}
 }
 
@@ -74,6 +78,9 @@ type rareBytesBuilder struct {
 	available   bool
 	count       int
 	rankSum     uint16
+	// asciiCaseInsensitive records both cases of every letter, since the
+	// prefilter scans the haystack before it is case-folded.
+	asciiCaseInsensitive bool
 }
 
 type prefilter struct {
@@ -161,6 +168,15 @@ func (r *rareBytesBuilder) add(bytes []byte) {
 }
 
 func (r *rareBytesBuilder) addRareByte(b byte) {
+	if r.asciiCaseInsensitive {
+		r.addOneRareByte(toLowerASCII(b))
+		r.addOneRareByte(toUpperASCII(b))
+		return
+	}
+	r.addOneRareByte(b)
+}
+
+func (r *rareBytesBuilder) addOneRareByte(b byte) {
 	if r.rareSet.insert(b) {
 		r.count += 1
 		r.rankSum += uint16(freqRank(b))
@@ -177,6 +193,11 @@ func newRareByteOffset(i int) rareByteOffset {
 
 func (r *rareBytesBuilder) setOffset(pos int, b byte) {
 	offset := newRareByteOffset(pos)
+	if r.asciiCaseInsensitive {
+		r.byteOffsets.set(toLowerASCII(b), offset)
+		r.byteOffsets.set(toUpperASCII(b), offset)
+		return
+	}
 	r.byteOffsets.set(b, offset)
 }
 
@@ -194,6 +215,8 @@ type startBytesBuilder struct {
 	byteset []bool
 	count   int
 	rankSum uint16
+	// asciiCaseInsensitive records both cases of a starting letter.
+	asciiCaseInsensitive bool
 }
 
 func (s *startBytesBuilder) build() *prefilter {
@@ -226,6 +249,15 @@ func (s *startBytesBuilder) add(bytes []byte) {
 	}
 
 	b := bytes[0]
+	if s.asciiCaseInsensitive {
+		s.addByte(toLowerASCII(b))
+		s.addByte(toUpperASCII(b))
+		return
+	}
+	s.addByte(b)
+}
+
+func (s *startBytesBuilder) addByte(b byte) {
 	if !s.byteset[int(b)] {
 		s.byteset[int(b)] = true
 		s.count += 1
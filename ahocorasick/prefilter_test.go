@@ -156,6 +156,20 @@ func TestStartBytesBuilder_Build(t *testing.T) {
 		}
 	})
 
+	t.Run("ascii case insensitive", func(t *testing.T) {
+		b := newStartBytesBuilder()
+		b.asciiCaseInsensitive = true
+		b.add([]byte("hello"))
+		pf := b.build()
+		if pf == nil {
+			t.Fatal("expected non-nil prefilter")
+		}
+		got := pf.nextCandidate(newState(), []byte("xxHELLO"), 0)
+		if got != 2 {
+			t.Errorf("nextCandidate() = %v, want 2", got)
+		}
+	})
+
 	t.Run("too many distinct start bytes returns nil", func(t *testing.T) {
 		b := newStartBytesBuilder()
 		b.add([]byte("a"))
@@ -188,6 +202,20 @@ func TestRareBytesBuilder_Build(t *testing.T) {
 		}
 	})
 
+	t.Run("ascii case insensitive", func(t *testing.T) {
+		b := newRareBytesBuilder()
+		b.asciiCaseInsensitive = true
+		b.add([]byte("zq"))
+		pf := b.build()
+		if pf == nil {
+			t.Fatal("expected non-nil prefilter")
+		}
+		got := pf.nextCandidate(newState(), []byte("xxxZQ"), 0)
+		if got != 3 {
+			t.Errorf("nextCandidate() = %v, want 3", got)
+		}
+	})
+
 	t.Run("too many rare bytes returns nil", func(t *testing.T) {
 		b := newRareBytesBuilder()
 		// Add patterns that produce >3 distinct rare bytes
@@ -1,23 +1,55 @@
 // Package ast defines the Abstract Syntax Tree types for YARA rules.
 package ast
 
+// Position is a location in YARA source.
+type Position struct {
+	Offset int // byte offset, starting at 0
+	Line   int // line number, starting at 1
+	Column int // column number in bytes, starting at 1
+}
+
+// Span is the source range of a node, from the start of its first token to
+// the end of its last token. Nodes built by hand have a zero Span.
+type Span struct {
+	File  string // empty for rules parsed from a string
+	Start Position
+	End   Position // just past the last byte
+}
+
 // RuleSet represents a collection of YARA rules.
 type RuleSet struct {
-	Rules []*Rule
+	Imports []string // module names from import statements, without duplicates
+	// Includes are the file names of include directives the parser kept
+	// unresolved, see parser.Options.KeepIncludes.
+	Includes []string
+	Rules    []*Rule
+	Comments []*Comment // comments of the parsed file, in source order
+}
+
+// Comment is a "//" or "/* */" comment, including its delimiters.
+type Comment struct {
+	Text string
+	Span Span
 }
 
 // Rule represents a single YARA rule.
 type Rule struct {
 	Name      string
+	Namespace string // namespace the rule was parsed into, see parser.ParseFiles
+	Tags      []string
+	Private   bool // not reported as a match, but can be referenced
+	Global    bool // must match for any other rule in its namespace to match
 	Meta      []*MetaEntry
 	Strings   []*StringDef
 	Condition Expr // parsed condition expression
+	Span      Span
 }
 
 // MetaEntry represents a key-value pair in the meta section.
 type MetaEntry struct {
 	Key   string
 	Value any // string or int64
+	Span  Span
 }
 
 // StringDef represents a string definition in the strings section.
@@ -25,13 +57,26 @@ type StringDef struct {
 	Name      string      // $identifier or $ (anonymous)
 	Value     StringValue // TextString, HexString, or RegexString
 	Modifiers StringModifiers
+	Span      Span
 }
 
-// StringModifiers represents the modifiers applied to a string.
+// StringModifiers represents the modifiers applied to a string. Rules built
+// without the parser must set the xor key range along with Xor: zero
+// bounds mean the single key 0, as in xor(0).
 type StringModifiers struct {
-	Ascii    bool
-	Base64   bool
-	Fullword bool
+	Ascii      bool
+	Wide       bool
+	Nocase     bool
+	Fullword   bool
+	Private    bool
+	Xor        bool
+	XorMin     int // lowest xor key, 0 unless given as xor(min-max)
+	XorMax     int // highest xor key, set to 255 by the parser unless given as xor(min-max)
+	Base64     bool
+	Base64Wide bool
+	// Base64Alphabet is the custom alphabet given as base64("...") or
+	// base64wide("..."), or empty for the standard one.
+	Base64Alphabet string
 }
 
 // StringValue is an interface for the different string types.
@@ -42,6 +87,7 @@ type StringValue interface {
 // TextString represents a quoted text string.
 type TextString struct {
 	Value string
+	Span  Span
 }
 
 func (TextString) stringValue() {}
@@ -49,6 +95,7 @@ func (TextString) stringValue() {}
 // HexString represents a hex byte sequence with optional wildcards and jumps.
 type HexString struct {
 	Tokens []HexToken
+	Span   Span
 }
 
 func (HexString) stringValue() {}
@@ -64,6 +111,7 @@ type RegexModifiers struct {
 type RegexString struct {
 	Pattern   string
 	Modifiers RegexModifiers
+	Span      Span
 }
 
 func (RegexString) stringValue() {}
@@ -76,19 +124,23 @@ type HexToken interface {
 // HexByte represents a literal byte value.
 type HexByte struct {
 	Value byte
+	Span  Span
 }
 
 func (HexByte) hexToken() {}
 
 // HexWildcard represents a ?? wildcard matching any byte.
-type HexWildcard struct{}
+type HexWildcard struct {
+	Span Span
+}
 
 func (HexWildcard) hexToken() {}
 
 // HexJump represents a jump like [4], [4-16], or [-].
 type HexJump struct {
-	Min *int // nil means unbounded
-	Max *int // nil means unbounded
+	Min  *int // nil means unbounded
+	Max  *int // nil means unbounded
+	Span Span
 }
 
 func (HexJump) hexToken() {}
@@ -97,6 +149,7 @@ func (HexJump) hexToken() {}
 // Each alternative can be a byte value or ?? wildcard.
 type HexAlt struct {
 	Alternatives []HexAltItem
+	Span         Span
 }
 
 func (HexAlt) hexToken() {}
@@ -110,64 +163,296 @@ type HexAltItem struct {
 // Expr represents a condition expression node.
 type Expr interface {
 	exprNode()
+	span() Span
+}
+
+// SpanOf returns the source range of an expression, or the zero Span if e
+// is nil.
+func SpanOf(e Expr) Span {
+	if e == nil {
+		return Span{}
+	}
+	return e.span()
 }
 
 // StringRef represents a string variable reference like $foo.
 type StringRef struct {
 	Name string
+	Span Span
+}
+
+func (StringRef) exprNode()    {}
+func (e StringRef) span() Span { return e.Span }
+
+// StringCount represents the number of matches of a string, like "#foo".
+type StringCount struct {
+	Name string // string identifier with $ prefix
+	Span Span
+}
+
+func (StringCount) exprNode()    {}
+func (e StringCount) span() Span { return e.Span }
+
+// StringOffset represents the offset of a string match, like "@foo[2]".
+// Indexes are 1-based; a nil Index refers to the first match.
+type StringOffset struct {
+	Name  string // string identifier with $ prefix
+	Index Expr
+	Span  Span
+}
+
+func (StringOffset) exprNode()    {}
+func (e StringOffset) span() Span { return e.Span }
+
+// StringLength represents the length of a string match, like "!foo[2]".
+// Indexes are 1-based; a nil Index refers to the first match.
+type StringLength struct {
+	Name  string // string identifier with $ prefix
+	Index Expr
+	Span  Span
 }
 
-func (StringRef) exprNode() {}
+func (StringLength) exprNode()    {}
+func (e StringLength) span() Span { return e.Span }
 
 // AtExpr represents a positional match like "$foo at 0".
 type AtExpr struct {
-	Ref StringRef
-	Pos Expr
+	Ref  StringRef
+	Pos  Expr
+	Span Span
 }
 
-func (AtExpr) exprNode() {}
+func (AtExpr) exprNode()    {}
+func (e AtExpr) span() Span { return e.Span }
 
-// IntLit represents an integer literal (decimal or hex).
+// InExpr represents a range match like "$foo in (0..1024)".
+type InExpr struct {
+	Ref   StringRef
+	Range Range
+	Span  Span
+}
+
+func (InExpr) exprNode()    {}
+func (e InExpr) span() Span { return e.Span }
+
+// Range represents an inclusive integer range like "(0..filesize)".
+type Range struct {
+	Start Expr
+	End   Expr
+	Span  Span
+}
+
+func (Range) iterable() {}
+
+// IntLit represents an integer literal, like 42, 0x5A4D or 2MB.
 type IntLit struct {
-	Value int64
+	Value  int64
+	Hex    bool   // written in hexadecimal
+	Suffix string // "KB" or "MB" if written with a size suffix, included in Value
+	Span   Span
+}
+
+func (IntLit) exprNode()    {}
+func (e IntLit) span() Span { return e.Span }
+
+// FloatLit represents a floating point literal like 7.2 in a condition.
+type FloatLit struct {
+	Value float64
+	Span  Span
 }
 
-func (IntLit) exprNode() {}
+func (FloatLit) exprNode()    {}
+func (e FloatLit) span() Span { return e.Span }
+
+// StringLit represents a quoted string in a condition, such as a module
+// function argument. Escape sequences are already resolved.
+type StringLit struct {
+	Value string
+	Span  Span
+}
+
+func (StringLit) exprNode()    {}
+func (e StringLit) span() Span { return e.Span }
+
+// RegexLit represents a regular expression in a condition, the right-hand
+// side of the matches operator.
+type RegexLit struct {
+	Pattern   string
+	Modifiers RegexModifiers
+	Span      Span
+}
+
+func (RegexLit) exprNode()    {}
+func (e RegexLit) span() Span { return e.Span }
+
+// Filesize represents the "filesize" keyword, the size of the scanned data in bytes.
+type Filesize struct {
+	Span Span
+}
+
+func (Filesize) exprNode()    {}
+func (e Filesize) span() Span { return e.Span }
+
+// Entrypoint represents the "entrypoint" keyword, the file offset of the
+// entry point of a PE or ELF executable. It is undefined for other data.
+type Entrypoint struct {
+	Span Span
+}
+
+func (Entrypoint) exprNode()    {}
+func (e Entrypoint) span() Span { return e.Span }
 
 // FuncCall represents a function call like uint32be(0).
 type FuncCall struct {
 	Name string
 	Args []Expr
+	Span Span
 }
 
-func (FuncCall) exprNode() {}
+func (FuncCall) exprNode()    {}
+func (e FuncCall) span() Span { return e.Span }
 
-// BinaryExpr represents a binary operation (and, or, ==).
+// BinaryExpr represents a binary operation: boolean (and, or), comparison
+// (==, !=, <, <=, >, >=), arithmetic (+, -, *, \, %), bitwise (&, |, ^, <<,
+// >>) or string (contains, icontains, startswith, istartswith, endswith,
+// iendswith, iequals, matches). The right operand of matches is a RegexLit.
 type BinaryExpr struct {
 	Op    string
 	Left  Expr
 	Right Expr
+	Span  Span
 }
 
-func (BinaryExpr) exprNode() {}
+func (BinaryExpr) exprNode()    {}
+func (e BinaryExpr) span() Span { return e.Span }
+
+// UnaryExpr represents a unary operation (not, - or ~).
+type UnaryExpr struct {
+	Op      string
+	Operand Expr
+	Span    Span
+}
+
+func (UnaryExpr) exprNode()    {}
+func (e UnaryExpr) span() Span { return e.Span }
 
 // ParenExpr represents a parenthesized expression.
 type ParenExpr struct {
 	Inner Expr
+	Span  Span
+}
+
+func (ParenExpr) exprNode()    {}
+func (e ParenExpr) span() Span { return e.Span }
+
+// OfExpr represents a quantified string set like "any of them",
+// "2 of ($a*)", "none of ($a, $b)" or "50% of them", or a quantified rule
+// set like "any of (is_php, webshell_*)". Only one of Strings and Rules is
+// set.
+type OfExpr struct {
+	Quantifier Quantifier
+	Strings    []string // "them", names like "$a", or prefixes like "$a*"
+	Rules      []string // rule names like "is_php", or prefixes like "webshell_*"
+	Span       Span
+}
+
+func (OfExpr) exprNode()    {}
+func (e OfExpr) span() Span { return e.Span }
+
+// QuantifierKind identifies how many members of a set a quantifier requires.
+type QuantifierKind int
+
+const (
+	QuantAny     QuantifierKind = iota // any
+	QuantAll                           // all
+	QuantNone                          // none
+	QuantCount                         // N, at least N members
+	QuantPercent                       // N%, at least N percent of members
+)
+
+// Quantifier represents the quantifier of an "of" expression.
+type Quantifier struct {
+	Kind  QuantifierKind
+	Value Expr // count or percentage for QuantCount and QuantPercent
 }
 
-func (ParenExpr) exprNode() {}
+// ForOfExpr represents a loop over a string set like
+// "for any of ($a*) : (@ < 100)". Inside Body the anonymous references
+// $, #, @ and ! refer to the string being iterated.
+type ForOfExpr struct {
+	Quantifier Quantifier
+	Strings    []string // "them", names like "$a", or prefixes like "$a*"
+	Body       Expr
+	Span       Span
+}
 
-// AnyOf represents "any of (pattern)" with optional wildcard.
-type AnyOf struct {
-	Pattern string // e.g., "$b64_*" or "them"
+func (ForOfExpr) exprNode()    {}
+func (e ForOfExpr) span() Span { return e.Span }
+
+// ForInExpr represents a loop binding a variable to each value of an
+// iterable, like "for all i in (1..#a) : (@a[i] < 100)".
+type ForInExpr struct {
+	Quantifier Quantifier
+	Var        string
+	Iterable   Iterable
+	Body       Expr
+	Span       Span
 }
 
-func (AnyOf) exprNode() {}
+func (ForInExpr) exprNode()    {}
+func (e ForInExpr) span() Span { return e.Span }
+
+// Iterable is the source of values for a "for ... in" loop: a Range or a ValueList.
+type Iterable interface {
+	iterable()
+}
+
+// ValueList represents an enumeration of values like "(1, 2, 3)".
+type ValueList struct {
+	Values []Expr
+	Span   Span
+}
+
+func (ValueList) iterable() {}
+
+// Ident represents a bare identifier, such as a loop variable, an imported
+// module, an external variable or a reference to another rule.
+type Ident struct {
+	Name string
+	Span Span
+}
 
-// AllOf represents "all of them" or "all of (pattern)".
-type AllOf struct {
-	Pattern string // e.g., "them" or "$prefix_*"
+func (Ident) exprNode()    {}
+func (e Ident) span() Span { return e.Span }
+
+// MemberExpr represents access to a structure field, like pe.machine.
+type MemberExpr struct {
+	Object Expr
+	Member string
+	Span   Span
+}
+
+func (MemberExpr) exprNode()    {}
+func (e MemberExpr) span() Span { return e.Span }
+
+// IndexExpr represents indexing into an array or dictionary, like
+// pe.sections[0].
+type IndexExpr struct {
+	Object Expr
+	Index  Expr
+	Span   Span
+}
+
+func (IndexExpr) exprNode()    {}
+func (e IndexExpr) span() Span { return e.Span }
+
+// CallExpr represents a call to a module function, like pe.exports(0).
+// Calls to built-in functions such as uint32 are represented by FuncCall.
+type CallExpr struct {
+	Func Expr
+	Args []Expr
+	Span Span
 }
 
-func (AllOf) exprNode() {}
+func (CallExpr) exprNode()    {}
+func (e CallExpr) span() Span { return e.Span }
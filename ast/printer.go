@@ -0,0 +1,777 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// indent is the indentation of one nesting level in printed rules.
+const indent = "    "
+
+// maxConditionWidth is the length above which a condition, or a part of it
+// in parentheses, that chains "and" or "or" operators is printed with one
+// operand per line.
+const maxConditionWidth = 80
+
+// WriteTo writes the rule set to w as canonical YARA source: imports,
+// includes, then the rules separated by blank lines. Comments of a parsed
+// rule set are kept next to the rule, meta entry or string they precede or
+// follow on the same line; comments before the first rule are written at
+// the top. Parsing the output yields an equivalent rule set.
+func (rs *RuleSet) WriteTo(w io.Writer) (int64, error) {
+	p := &printer{comments: rs.Comments}
+	p.ruleSet(rs)
+	return p.buf.WriteTo(w)
+}
+
+// String returns the rule set as canonical YARA source, see WriteTo.
+func (rs *RuleSet) String() string {
+	var b strings.Builder
+	rs.WriteTo(&b)
+	return b.String()
+}
+
+// WriteTo writes the rule to w as canonical YARA source.
+func (r *Rule) WriteTo(w io.Writer) (int64, error) {
+	var p printer
+	p.rule(r)
+	return p.buf.WriteTo(w)
+}
+
+// String returns the rule as canonical YARA source.
+func (r *Rule) String() string {
+	var b strings.Builder
+	r.WriteTo(&b)
+	return b.String()
+}
+
+// String returns the entry as it appears in a meta section.
+func (m *MetaEntry) String() string {
+	return sprint(func(p *printer) { p.metaEntry(m, 0) })
+}
+
+// String returns the definition as it appears in a strings section.
+func (d *StringDef) String() string {
+	return sprint(func(p *printer) { p.stringDef(d, 0) })
+}
+
+// String returns the modifiers as they follow a string, like "ascii wide".
+func (m StringModifiers) String() string {
+	return sprint(func(p *printer) { p.modifiers(m) })
+}
+
+func (s TextString) String() string  { return quote(s.Value) }
+func (s HexString) String() string   { return sprint(func(p *printer) { p.hexString(s) }) }
+func (s RegexString) String() string { return regex(s.Pattern, s.Modifiers) }
+
+func (t HexByte) String() string     { return fmt.Sprintf("%02X", t.Value) }
+func (t HexWildcard) String() string { return "??" }
+
+func (t HexJump) String() string {
+	switch {
+	case t.Min != nil && t.Max != nil && *t.Min == *t.Max:
+		return fmt.Sprintf("[%d]", *t.Min)
+	case t.Min != nil && t.Max != nil:
+		return fmt.Sprintf("[%d-%d]", *t.Min, *t.Max)
+	case t.Min != nil:
+		return fmt.Sprintf("[%d-]", *t.Min)
+	case t.Max != nil:
+		return fmt.Sprintf("[-%d]", *t.Max)
+	}
+	return "[-]"
+}
+
+func (t HexAlt) String() string {
+	items := make([]string, len(t.Alternatives))
+	for i, item := range t.Alternatives {
+		if item.Byte == nil {
+			items[i] = "??"
+		} else {
+			items[i] = fmt.Sprintf("%02X", *item.Byte)
+		}
+	}
+	return "(" + strings.Join(items, "|") + ")"
+}
+
+func (e StringRef) String() string    { return exprString(e) }
+func (e StringCount) String() string  { return exprString(e) }
+func (e StringOffset) String() string { return exprString(e) }
+func (e StringLength) String() string { return exprString(e) }
+func (e AtExpr) String() string       { return exprString(e) }
+func (e InExpr) String() string       { return exprString(e) }
+func (e IntLit) String() string       { return exprString(e) }
+func (e FloatLit) String() string     { return exprString(e) }
+func (e StringLit) String() string    { return exprString(e) }
+func (e RegexLit) String() string     { return exprString(e) }
+func (e Filesize) String() string     { return exprString(e) }
+func (e Entrypoint) String() string   { return exprString(e) }
+func (e FuncCall) String() string     { return exprString(e) }
+func (e BinaryExpr) String() string   { return exprString(e) }
+func (e UnaryExpr) String() string    { return exprString(e) }
+func (e ParenExpr) String() string    { return exprString(e) }
+func (e OfExpr) String() string       { return exprString(e) }
+func (e ForOfExpr) String() string    { return exprString(e) }
+func (e ForInExpr) String() string    { return exprString(e) }
+func (e Ident) String() string        { return exprString(e) }
+func (e MemberExpr) String() string   { return exprString(e) }
+func (e IndexExpr) String() string    { return exprString(e) }
+func (e CallExpr) String() string     { return exprString(e) }
+
+func (r Range) String() string     { return sprint(func(p *printer) { p.iterable(r) }) }
+func (v ValueList) String() string { return sprint(func(p *printer) { p.iterable(v) }) }
+
+func exprString(e Expr) string {
+	return sprint(func(p *printer) { p.expr(e, precLowest) })
+}
+
+func sprint(f func(p *printer)) string {
+	var p printer
+	f(&p)
+	return p.buf.String()
+}
+
+// Operator precedences in conditions, from the loosest to the tightest
+// binding, as in the grammar.
+const (
+	precLowest  = iota
+	precOr      // or
+	precAnd     // and
+	precNot     // not
+	precEqual   // == != contains icontains ... matches
+	precCompare // < <= > >=
+	precOf      // at in of
+	precBitOr   // |
+	precBitXor  // ^
+	precBitAnd  // &
+	precShift   // << >>
+	precAdd     // + -
+	precMul     // * \ %
+	precUnary   // - ~
+	precPrimary
+)
+
+var binaryPrec = map[string]int{
+	"or":          precOr,
+	"and":         precAnd,
+	"==":          precEqual,
+	"!=":          precEqual,
+	"contains":    precEqual,
+	"icontains":   precEqual,
+	"startswith":  precEqual,
+	"istartswith": precEqual,
+	"endswith":    precEqual,
+	"iendswith":   precEqual,
+	"iequals":     precEqual,
+	"matches":     precEqual,
+	"<":           precCompare,
+	"<=":          precCompare,
+	">":           precCompare,
+	">=":          precCompare,
+	"|":           precBitOr,
+	"^":           precBitXor,
+	"&":           precBitAnd,
+	"<<":          precShift,
+	">>":          precShift,
+	"+":           precAdd,
+	"-":           precAdd,
+	"*":           precMul,
+	"\\":          precMul,
+	"%":           precMul,
+}
+
+// exprPrec returns the precedence of the operator at the root of e.
+func exprPrec(e Expr) int {
+	switch e := e.(type) {
+	case BinaryExpr:
+		return binaryPrec[e.Op]
+	case UnaryExpr:
+		if e.Op == "not" {
+			return precNot
+		}
+		return precUnary
+	case AtExpr, InExpr, OfExpr:
+		return precOf
+	case IntLit:
+		if e.Value < 0 {
+			return precUnary
+		}
+	case FloatLit:
+		if e.Value < 0 {
+			return precUnary
+		}
+	}
+	return precPrimary
+}
+
+// printer accumulates printed YARA source.
+type printer struct {
+	buf      bytes.Buffer
+	comments []*Comment // comments not printed yet, in source order
+}
+
+func (p *printer) ruleSet(rs *RuleSet) {
+	if len(rs.Imports)+len(rs.Includes) > 0 && len(rs.Rules) > 0 && p.commentsFrom(rs.Rules[0]) {
+		start := rs.Rules[0].Span.Start
+		for range headerComments(p.comments, start.Offset, start.Line) {
+			p.line(0, p.comments[0].Text)
+			p.comments = p.comments[1:]
+		}
+	}
+	section := func() {
+		if p.buf.Len() > 0 {
+			p.buf.WriteByte('\n')
+		}
+	}
+	if len(rs.Imports) > 0 {
+		section()
+		for _, name := range rs.Imports {
+			fmt.Fprintf(&p.buf, "import %s\n", quote(name))
+		}
+	}
+	if len(rs.Includes) > 0 {
+		section()
+		for _, name := range rs.Includes {
+			fmt.Fprintf(&p.buf, "include %s\n", quote(name))
+		}
+	}
+	for _, r := range rs.Rules {
+		section()
+		if p.commentsFrom(r) {
+			p.commentsBefore(r.Span.Start.Offset, 0)
+		}
+		p.rule(r)
+	}
+	if len(p.comments) > 0 {
+		section()
+		p.commentsBefore(-1, 0)
+	}
+}
+
+func (p *printer) rule(r *Rule) {
+	if !p.commentsFrom(r) {
+		comments := p.comments
+		p.comments = nil
+		defer func() { p.comments = comments }()
+	}
+	if r.Private {
+		p.buf.WriteString("private ")
+	}
+	if r.Global {
+		p.buf.WriteString("global ")
+	}
+	p.buf.WriteString("rule " + r.Name)
+	if len(r.Tags) > 0 {
+		p.buf.WriteString(" : " + strings.Join(r.Tags, " "))
+	}
+	p.buf.WriteString(" {")
+	p.trailingComment(r.Span.Start, bodyStart(r))
+
+	if len(r.Meta) > 0 {
+		p.line(1, "meta:")
+		width := 0
+		for _, m := range r.Meta {
+			width = max(width, len(m.Key))
+		}
+		for _, m := range r.Meta {
+			p.commentsBefore(m.Span.Start.Offset, 2)
+			p.writeIndent(2)
+			p.metaEntry(m, width)
+			p.trailingComment(m.Span.End, -1)
+		}
+	}
+	if len(r.Strings) > 0 {
+		p.line(1, "strings:")
+		width := 0
+		for _, d := range r.Strings {
+			width = max(width, len(d.Name))
+		}
+		for _, d := range r.Strings {
+			p.commentsBefore(d.Span.Start.Offset, 2)
+			p.writeIndent(2)
+			p.stringDef(d, width)
+			p.trailingComment(d.Span.End, -1)
+		}
+	}
+	p.line(1, "condition:")
+	cond := SpanOf(r.Condition)
+	p.commentsBefore(cond.Start.Offset, 2)
+	p.writeIndent(2)
+	p.condition(r.Condition, 2)
+	// Comments after the closing brace trail the rule, not its condition.
+	closing := -1
+	if r.Span.End.Line > 0 {
+		closing = r.Span.End.Offset - 1
+	}
+	p.trailingComment(cond.End, closing)
+
+	p.commentsBefore(r.Span.End.Offset, 1)
+	p.buf.WriteByte('}')
+	p.trailingComment(r.Span.End, -1)
+}
+
+// condition prints a condition whose first line is indented to depth.
+// A long chain of "and" or "or" is split into one operand per line, and
+// so are long chains among its operands, in parentheses on lines of their
+// own one level deeper.
+func (p *printer) condition(cond Expr, depth int) {
+	chain, ok := cond.(BinaryExpr)
+	if !ok || !isChain(chain) || fits(cond) {
+		p.split(cond, precLowest, depth)
+		return
+	}
+	prec := binaryPrec[chain.Op]
+	operands := []Expr{chain.Right}
+	first := chain.Left
+	for {
+		left, ok := first.(BinaryExpr)
+		if !ok || left.Op != chain.Op {
+			break
+		}
+		operands = append(operands, left.Right)
+		first = left.Left
+	}
+	p.split(first, prec, depth)
+	for _, operand := range slices.Backward(operands) {
+		p.buf.WriteString(" " + chain.Op + "\n")
+		p.writeIndent(depth)
+		p.split(operand, prec+1, depth)
+	}
+}
+
+// split prints e like expr, but splits the long chains of "and" or "or" it
+// holds as a whole, in parentheses, after not or as a for loop body.
+func (p *printer) split(e Expr, prec, depth int) {
+	if fits(e) {
+		p.expr(e, prec)
+		return
+	}
+	switch e := e.(type) {
+	case BinaryExpr:
+		if isChain(e) {
+			p.block(e, depth)
+			return
+		}
+	case ParenExpr:
+		p.block(e.Inner, depth)
+		return
+	case UnaryExpr:
+		if e.Op == "not" && exprPrec(e) >= prec {
+			p.buf.WriteString("not ")
+			p.split(e.Operand, precNot, depth)
+			return
+		}
+	case ForOfExpr:
+		p.forOf(e)
+		p.buf.WriteString(" : ")
+		p.block(e.Body, depth)
+		return
+	case ForInExpr:
+		p.forIn(e)
+		p.buf.WriteString(" : ")
+		p.block(e.Body, depth)
+		return
+	}
+	p.expr(e, prec)
+}
+
+// block prints e in parentheses, on lines of its own one level deeper
+// than depth.
+func (p *printer) block(e Expr, depth int) {
+	p.buf.WriteString("(\n")
+	p.writeIndent(depth + 1)
+	p.condition(e, depth+1)
+	p.buf.WriteByte('\n')
+	p.writeIndent(depth)
+	p.buf.WriteByte(')')
+}
+
+func isChain(e BinaryExpr) bool { return e.Op == "and" || e.Op == "or" }
+
+func fits(e Expr) bool { return len(exprString(e)) <= maxConditionWidth }
+
+// metaEntry prints a meta entry with its key padded to width.
+func (p *printer) metaEntry(m *MetaEntry, width int) {
+	fmt.Fprintf(&p.buf, "%-*s = ", width, m.Key)
+	switch v := m.Value.(type) {
+	case string:
+		p.buf.WriteString(quote(v))
+	default:
+		fmt.Fprint(&p.buf, v)
+	}
+}
+
+// stringDef prints a string definition with its name padded to width.
+func (p *printer) stringDef(d *StringDef, width int) {
+	fmt.Fprintf(&p.buf, "%-*s = ", width, d.Name)
+	switch v := d.Value.(type) {
+	case TextString:
+		p.buf.WriteString(quote(v.Value))
+	case HexString:
+		p.hexString(v)
+	case RegexString:
+		p.buf.WriteString(regex(v.Pattern, v.Modifiers))
+	}
+	if mods := sprint(func(p *printer) { p.modifiers(d.Modifiers) }); mods != "" {
+		p.buf.WriteString(" " + mods)
+	}
+}
+
+func (p *printer) hexString(s HexString) {
+	p.buf.WriteString("{ ")
+	for _, t := range s.Tokens {
+		fmt.Fprint(&p.buf, t)
+		p.buf.WriteByte(' ')
+	}
+	p.buf.WriteByte('}')
+}
+
+func (p *printer) modifiers(m StringModifiers) {
+	var mods []string
+	add := func(set bool, name string) {
+		if set {
+			mods = append(mods, name)
+		}
+	}
+	add(m.Ascii, "ascii")
+	add(m.Wide, "wide")
+	add(m.Nocase, "nocase")
+	add(m.Fullword, "fullword")
+	add(m.Private, "private")
+	switch {
+	case !m.Xor:
+	case m.XorMin == 0 && m.XorMax == 255:
+		mods = append(mods, "xor")
+	case m.XorMin == m.XorMax:
+		mods = append(mods, fmt.Sprintf("xor(%d)", m.XorMin))
+	default:
+		mods = append(mods, fmt.Sprintf("xor(%d-%d)", m.XorMin, m.XorMax))
+	}
+	alphabet := ""
+	if m.Base64Alphabet != "" {
+		alphabet = "(" + quote(m.Base64Alphabet) + ")"
+	}
+	add(m.Base64, "base64"+alphabet)
+	add(m.Base64Wide, "base64wide"+alphabet)
+	p.buf.WriteString(strings.Join(mods, " "))
+}
+
+// expr prints e, in parentheses if its operator binds looser than prec.
+func (p *printer) expr(e Expr, prec int) {
+	if e == nil {
+		return
+	}
+	if exprPrec(e) < prec {
+		p.buf.WriteByte('(')
+		defer p.buf.WriteByte(')')
+	}
+
+	switch e := e.(type) {
+	case StringRef:
+		p.buf.WriteString(e.Name)
+	case StringCount:
+		p.buf.WriteString("#" + strings.TrimPrefix(e.Name, "$"))
+	case StringOffset:
+		p.buf.WriteString("@" + strings.TrimPrefix(e.Name, "$"))
+		p.index(e.Index)
+	case StringLength:
+		p.buf.WriteString("!" + strings.TrimPrefix(e.Name, "$"))
+		p.index(e.Index)
+	case AtExpr:
+		p.buf.WriteString(e.Ref.Name + " at ")
+		p.expr(e.Pos, precOf+1)
+	case InExpr:
+		p.buf.WriteString(e.Ref.Name + " in ")
+		p.iterable(e.Range)
+	case IntLit:
+		p.intLit(e)
+	case FloatLit:
+		s := strconv.FormatFloat(e.Value, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		p.buf.WriteString(s)
+	case StringLit:
+		p.buf.WriteString(quote(e.Value))
+	case RegexLit:
+		p.buf.WriteString(regex(e.Pattern, e.Modifiers))
+	case Filesize:
+		p.buf.WriteString("filesize")
+	case Entrypoint:
+		p.buf.WriteString("entrypoint")
+	case FuncCall:
+		p.buf.WriteString(e.Name)
+		p.args(e.Args)
+	case BinaryExpr:
+		prec := binaryPrec[e.Op]
+		p.expr(e.Left, prec)
+		p.buf.WriteString(" " + e.Op + " ")
+		p.expr(e.Right, prec+1)
+	case UnaryExpr:
+		if e.Op == "not" {
+			p.buf.WriteString("not ")
+			p.expr(e.Operand, precNot)
+		} else {
+			p.buf.WriteString(e.Op)
+			p.expr(e.Operand, precUnary)
+		}
+	case ParenExpr:
+		p.buf.WriteByte('(')
+		p.expr(e.Inner, precLowest)
+		p.buf.WriteByte(')')
+	case OfExpr:
+		p.quantifier(e.Quantifier)
+		p.buf.WriteString(" of ")
+		p.set(append(e.Strings[:len(e.Strings):len(e.Strings)], e.Rules...))
+	case ForOfExpr:
+		p.forOf(e)
+		p.body(e.Body)
+	case ForInExpr:
+		p.forIn(e)
+		p.body(e.Body)
+	case Ident:
+		p.buf.WriteString(e.Name)
+	case MemberExpr:
+		p.expr(e.Object, precPrimary)
+		p.buf.WriteString("." + e.Member)
+	case IndexExpr:
+		p.expr(e.Object, precPrimary)
+		p.index(e.Index)
+	case CallExpr:
+		p.expr(e.Func, precPrimary)
+		p.args(e.Args)
+	}
+}
+
+func (p *printer) intLit(e IntLit) {
+	switch {
+	case e.Hex && e.Value >= 0:
+		fmt.Fprintf(&p.buf, "0x%X", e.Value)
+	case e.Suffix == "KB" && e.Value%1024 == 0:
+		fmt.Fprintf(&p.buf, "%dKB", e.Value/1024)
+	case e.Suffix == "MB" && e.Value%(1024*1024) == 0:
+		fmt.Fprintf(&p.buf, "%dMB", e.Value/(1024*1024))
+	default:
+		p.buf.WriteString(strconv.FormatInt(e.Value, 10))
+	}
+}
+
+func (p *printer) index(index Expr) {
+	if index != nil {
+		p.buf.WriteByte('[')
+		p.expr(index, precLowest)
+		p.buf.WriteByte(']')
+	}
+}
+
+func (p *printer) args(args []Expr) {
+	p.buf.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			p.buf.WriteString(", ")
+		}
+		p.expr(arg, precLowest)
+	}
+	p.buf.WriteByte(')')
+}
+
+// quantifier prints a quantifier. Counts and percentages other than
+// literals are parenthesized, as the grammar only takes primary
+// expressions there.
+func (p *printer) quantifier(q Quantifier) {
+	switch q.Kind {
+	case QuantAny:
+		p.buf.WriteString("any")
+	case QuantAll:
+		p.buf.WriteString("all")
+	case QuantNone:
+		p.buf.WriteString("none")
+	case QuantCount:
+		p.expr(q.Value, precPrimary)
+	case QuantPercent:
+		p.expr(q.Value, precPrimary)
+		p.buf.WriteByte('%')
+	}
+}
+
+func (p *printer) set(names []string) {
+	if len(names) == 1 && names[0] == "them" {
+		p.buf.WriteString("them")
+		return
+	}
+	p.buf.WriteString("(" + strings.Join(names, ", ") + ")")
+}
+
+func (p *printer) iterable(it Iterable) {
+	switch it := it.(type) {
+	case Range:
+		p.buf.WriteByte('(')
+		p.expr(it.Start, precLowest)
+		p.buf.WriteString("..")
+		p.expr(it.End, precLowest)
+		p.buf.WriteByte(')')
+	case ValueList:
+		p.args(it.Values)
+	}
+}
+
+// forOf prints a for..of loop up to its body.
+func (p *printer) forOf(e ForOfExpr) {
+	p.buf.WriteString("for ")
+	p.quantifier(e.Quantifier)
+	p.buf.WriteString(" of ")
+	p.set(e.Strings)
+}
+
+// forIn prints a for..in loop up to its body.
+func (p *printer) forIn(e ForInExpr) {
+	p.buf.WriteString("for ")
+	p.quantifier(e.Quantifier)
+	p.buf.WriteString(" " + e.Var + " in ")
+	p.iterable(e.Iterable)
+}
+
+func (p *printer) body(body Expr) {
+	p.buf.WriteString(" : (")
+	p.expr(body, precLowest)
+	p.buf.WriteByte(')')
+}
+
+func (p *printer) writeIndent(depth int) {
+	p.buf.WriteString(strings.Repeat(indent, depth))
+}
+
+func (p *printer) line(depth int, s string) {
+	p.writeIndent(depth)
+	p.buf.WriteString(s + "\n")
+}
+
+// commentsBefore prints the pending comments that start before offset, or
+// all of them if offset is negative, each on its own line.
+func (p *printer) commentsBefore(offset, depth int) {
+	for len(p.comments) > 0 && (offset < 0 || p.comments[0].Span.Start.Offset < offset) {
+		p.line(depth, p.comments[0].Text)
+		p.comments = p.comments[1:]
+	}
+}
+
+// trailingComment ends the current line, appending the pending comment
+// that starts on the line of pos, after pos and before the offset limit
+// unless it is negative.
+func (p *printer) trailingComment(pos Position, limit int) {
+	if pos.Line > 0 && len(p.comments) > 0 {
+		c := p.comments[0].Span.Start
+		if c.Line != pos.Line || c.Offset < pos.Offset || limit >= 0 && c.Offset >= limit {
+			p.buf.WriteByte('\n')
+			return
+		}
+		p.buf.WriteString(" " + p.comments[0].Text)
+		p.comments = p.comments[1:]
+	}
+	p.buf.WriteByte('\n')
+}
+
+// bodyStart returns the offset of the first meta entry, string or
+// condition of a rule.
+func bodyStart(r *Rule) int {
+	switch {
+	case len(r.Meta) > 0:
+		return r.Meta[0].Span.Start.Offset
+	case len(r.Strings) > 0:
+		return r.Strings[0].Span.Start.Offset
+	}
+	return SpanOf(r.Condition).Start.Offset
+}
+
+// commentsFrom reports whether the pending comments are from the file of
+// a parsed rule, so their positions can be compared with the rule's.
+func (p *printer) commentsFrom(r *Rule) bool {
+	return len(p.comments) > 0 && hasPos(r.Span) && r.Span.File == p.comments[0].Span.File
+}
+
+// headerComments returns how many of the comments before offset form the
+// header of a file: all but those on consecutive lines right above line,
+// which belong to what follows them.
+func headerComments(comments []*Comment, offset, line int) int {
+	n := 0
+	for n < len(comments) && comments[n].Span.Start.Offset < offset {
+		n++
+	}
+	for n > 0 && comments[n-1].Span.End.Line >= line-1 {
+		line = comments[n-1].Span.Start.Line
+		n--
+	}
+	return n
+}
+
+// hasPos reports whether a span was set by the parser.
+func hasPos(s Span) bool {
+	return s.Start.Line > 0
+}
+
+// quote returns s as a double-quoted YARA string. Printable characters are
+// kept, anything else is escaped.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == utf8.RuneError && size == 1, !unicode.IsPrint(r):
+			for j := range size {
+				fmt.Fprintf(&b, `\x%02x`, s[i+j])
+			}
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// regex returns a regular expression in slashes followed by its
+// modifiers. Slashes in the pattern are escaped.
+func regex(pattern string, mods RegexModifiers) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			b.WriteByte('\\')
+			if i+1 < len(pattern) {
+				i++
+				b.WriteByte(pattern[i])
+			}
+			continue
+		case '/':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(pattern[i])
+	}
+	b.WriteByte('/')
+	if mods.CaseInsensitive {
+		b.WriteByte('i')
+	}
+	if mods.DotMatchesAll {
+		b.WriteByte('s')
+	}
+	if mods.Multiline {
+		b.WriteByte('m')
+	}
+	return b.String()
+}
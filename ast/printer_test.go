@@ -0,0 +1,211 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/sansecio/yargo/ast"
+	"github.com/sansecio/yargo/parser"
+)
+
+func parse(t *testing.T, src string) *ast.RuleSet {
+	t.Helper()
+	rs, err := parser.NewWithOptions(parser.Options{KeepIncludes: true}).Parse(src)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", src, err)
+	}
+	return rs
+}
+
+func TestWriteTo(t *testing.T) {
+	src := `// Webshell rules
+import "pe"
+include "common.yar"
+import "math"
+
+// Detects eval of decoded input
+private global rule webshell : php   web {  // header
+  meta:
+    author = "me \"quoted\"\ttab"   // who
+    score=10
+  strings:
+    $a = "eval(\x00" wide ascii
+    $hex = { 4d 5A ?? [4-16] (41|??) [-] [2-] }
+    $re = /foo\/bar[0-9]+/is
+    $b = "x" xor(1-200) private
+  condition:
+    uint16(0) == 0x5a4d and filesize < 2MB and ($a or $b) and not $re at 0 and #a > 2 and @a[1] < 100
+}
+rule small { condition: filesize<10KB } // tiny
+// end
+`
+	want := `// Webshell rules
+
+import "pe"
+import "math"
+
+include "common.yar"
+
+// Detects eval of decoded input
+private global rule webshell : php web { // header
+    meta:
+        author = "me \"quoted\"\ttab" // who
+        score  = 10
+    strings:
+        $a   = "eval(\x00" ascii wide
+        $hex = { 4D 5A ?? [4-16] (41|??) [-] [2-] }
+        $re  = /foo\/bar[0-9]+/is
+        $b   = "x" private xor(1-200)
+    condition:
+        uint16(0) == 0x5A4D and
+        filesize < 2MB and
+        ($a or $b) and
+        not $re at 0 and
+        #a > 2 and
+        @a[1] < 100
+}
+
+rule small {
+    condition:
+        filesize < 10KB
+} // tiny
+
+// end
+`
+	if got := parse(t, src).String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteToLayout(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{
+			`rule a { condition: filesize > 0 } /* after */`,
+			`rule a {
+    condition:
+        filesize > 0
+} /* after */
+`,
+		},
+		{
+			`rule a { condition: filesize > 0 /* cond */ } // rule`,
+			`rule a {
+    condition:
+        filesize > 0 /* cond */
+} // rule
+`,
+		},
+		{
+			`rule a { strings: $a = "x" $b = "y" condition: uint16(0) == 0x5A4D and (($a and filesize < 100000 and #a > 20 and @a[1] < 1000) or $b and #b > 2000 and filesize > 1000000000) }`,
+			`rule a {
+    strings:
+        $a = "x"
+        $b = "y"
+    condition:
+        uint16(0) == 0x5A4D and
+        (
+            ($a and filesize < 100000 and #a > 20 and @a[1] < 1000) or
+            $b and #b > 2000 and filesize > 1000000000
+        )
+}
+`,
+		},
+		{
+			`rule a { strings: $a = "x" condition: filesize < 1000000 and for all of them : ($ in (0..filesize) and @a[1] < 1000 and #a > 200 and !a[1] == 1 and $a at 0 and $a in (0..100)) }`,
+			`rule a {
+    strings:
+        $a = "x"
+    condition:
+        filesize < 1000000 and
+        for all of them : (
+            $ in (0..filesize) and
+            @a[1] < 1000 and
+            #a > 200 and
+            !a[1] == 1 and
+            $a at 0 and
+            $a in (0..100)
+        )
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		if got := parse(t, tt.src).String(); got != tt.want {
+			t.Errorf("%s\ngot:\n%s\nwant:\n%s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []string{
+		`rule a { strings: $a = "a\\b\n\r\t\"\xff\x01é" nocase fullword condition: $a }`,
+		`rule a { strings: $a = "x" base64("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/") base64wide condition: $a }`,
+		`rule a { strings: $a = "x" xor $b = "y" xor(7) condition: all of them }`,
+		`rule a { strings: $a = { 00 [-8] 01 } $b = /a\/b\d+/ condition: #a == 2 or !b[1] > 3 }`,
+		`rule a { condition: 1 + 2 * 3 - (4 - 5) == 10 \ 2 % 3 and -(1 + 2) < ~3 }`,
+		`rule a { condition: (1 | 2) ^ 3 & 4 << 1 >> 2 == 0 }`,
+		`rule a { condition: not (true_cond and false_cond) or not not x }`,
+		`rule a { strings: $a = "x" $b = "y" condition: 2 of ($a, $b) and 50% of them and none of ($a*) }`,
+		`rule a { strings: $a = "x" condition: for all i in (1, 2, 3) : (@a[i] > 0) and for 2 of them : ($ at 0) }`,
+		`rule a { strings: $a = "x" condition: $a in (0..filesize - 1) and $a at entrypoint + 0x10 }`,
+		`rule a { condition: pe.sections[pe.number_of_sections - 1].name == ".text" and pe.exports("x") }`,
+		`rule a { condition: math.entropy(0, filesize) >= 7.5 and hash.md5(0, 100) iequals "ab" }`,
+		`rule a { condition: name matches /^a.*$/i and name contains "x" and name startswith "y" }`,
+		`rule a { condition: b and any of (c, d_*) } rule b { condition: true_value } rule c { condition: c_ }`,
+		`import "pe" rule a : t1 t2 { meta: a = "b" c = -1 condition: pe.is_dll() }`,
+	}
+	for _, src := range tests {
+		printed := parse(t, src).String()
+		if again := parse(t, printed).String(); again != printed {
+			t.Errorf("%s\nprinted as:\n%s\nreprinted as:\n%s", src, printed, again)
+		}
+	}
+}
+
+func TestExprString(t *testing.T) {
+	one, two := ast.IntLit{Value: 1}, ast.IntLit{Value: 2}
+	tests := []struct {
+		expr ast.Expr
+		want string
+	}{
+		{
+			ast.BinaryExpr{Op: "*", Left: ast.BinaryExpr{Op: "+", Left: one, Right: two}, Right: two},
+			"(1 + 2) * 2",
+		},
+		{
+			ast.BinaryExpr{Op: "-", Left: one, Right: ast.BinaryExpr{Op: "-", Left: two, Right: one}},
+			"1 - (2 - 1)",
+		},
+		{
+			ast.UnaryExpr{Op: "not", Operand: ast.BinaryExpr{Op: "and", Left: ast.Ident{Name: "a"}, Right: ast.Ident{Name: "b"}}},
+			"not (a and b)",
+		},
+		{
+			ast.UnaryExpr{Op: "-", Operand: ast.IntLit{Value: -1}},
+			"--1",
+		},
+		{
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.BinaryExpr{Op: "+", Left: one, Right: one}}, Strings: []string{"them"}},
+			"(1 + 1) of them",
+		},
+		{
+			ast.AtExpr{Ref: ast.StringRef{Name: "$a"}, Pos: ast.BinaryExpr{Op: "==", Left: one, Right: one}},
+			"$a at (1 == 1)",
+		},
+		{
+			ast.BinaryExpr{Op: "matches", Left: ast.StringLit{Value: "a\x00/"}, Right: ast.RegexLit{Pattern: "a/b", Modifiers: ast.RegexModifiers{DotMatchesAll: true}}},
+			`"a\x00/" matches /a\/b/s`,
+		},
+		{ast.FloatLit{Value: 7}, "7.0"},
+		{ast.IntLit{Value: 1 << 20, Suffix: "MB"}, "1MB"},
+		{ast.IntLit{Value: 1000, Suffix: "KB"}, "1000"},
+		{ast.IntLit{Value: 255, Hex: true}, "0xFF"},
+		{ast.StringOffset{Name: "$", Index: ast.Ident{Name: "i"}}, "@[i]"},
+	}
+	for _, tt := range tests {
+		if got := tt.expr.(interface{ String() string }).String(); got != tt.want {
+			t.Errorf("%#v: got %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// edit is a line of an edit script: kept (' '), deleted ('-') or inserted
+// ('+').
+type edit struct {
+	op   byte
+	line string
+}
+
+// unifiedDiff returns a unified diff from old to new, or nil if they are
+// equal.
+func unifiedDiff(oldName, newName string, old, new []byte) []byte {
+	edits := lineDiff(splitLines(old), splitLines(new))
+
+	var out bytes.Buffer
+	oldLine, newLine := 1, 1
+	hunkEnd := 0
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			oldLine++
+			newLine++
+			k++
+			continue
+		}
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+
+		// Back up to include the context before the change, then extend
+		// the hunk over changes less than two contexts apart.
+		start := max(k-diffContext, hunkEnd)
+		oldLine -= k - start
+		newLine -= k - start
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := 0
+			for end+run < len(edits) && edits[end+run].op == ' ' {
+				run++
+			}
+			if end+run == len(edits) || run > 2*diffContext {
+				end += min(run, diffContext)
+				break
+			}
+			end += run
+		}
+
+		var oldCount, newCount int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine += oldCount
+		newLine += newCount
+		k, hunkEnd = end, end
+	}
+	if out.Len() == 0 {
+		return nil
+	}
+	return out.Bytes()
+}
+
+// hunkRange formats the line range of a hunk, where an empty range names
+// the line before it.
+func hunkRange(line, count int) string {
+	if count == 0 {
+		line--
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitLines splits data after each newline.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineDiff returns an edit script turning a into b. It is a patience
+// diff: lines occurring once in both a and b anchor the script, and the
+// lines between anchors are diffed recursively.
+func lineDiff(a, b []string) []edit {
+	var edits []edit
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		edits = append(edits, edit{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	common := 0
+	for common < len(a) && common < len(b) && a[len(a)-1-common] == b[len(b)-1-common] {
+		common++
+	}
+	suffix := a[len(a)-common:]
+	a, b = a[:len(a)-common], b[:len(b)-common]
+
+	if anchors := uniqueAnchors(a, b); len(anchors) > 0 {
+		i, j := 0, 0
+		for _, anchor := range anchors {
+			edits = append(edits, lineDiff(a[i:anchor[0]], b[j:anchor[1]])...)
+			edits = append(edits, edit{' ', a[anchor[0]]})
+			i, j = anchor[0]+1, anchor[1]+1
+		}
+		edits = append(edits, lineDiff(a[i:], b[j:])...)
+	} else {
+		for _, line := range a {
+			edits = append(edits, edit{'-', line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{'+', line})
+		}
+	}
+
+	for _, line := range suffix {
+		edits = append(edits, edit{' ', line})
+	}
+	return edits
+}
+
+// uniqueAnchors returns the longest sequence of index pairs of lines that
+// occur once in both a and b, increasing in both.
+func uniqueAnchors(a, b []string) [][2]int {
+	type occurrences struct{ a, b, bIndex int }
+	counts := make(map[string]*occurrences)
+	for _, line := range a {
+		c := counts[line]
+		if c == nil {
+			c = &occurrences{}
+			counts[line] = c
+		}
+		c.a++
+	}
+	for j, line := range b {
+		if c := counts[line]; c != nil {
+			c.b++
+			c.bIndex = j
+		}
+	}
+	var pairs [][2]int
+	for i, line := range a {
+		if c := counts[line]; c.a == 1 && c.b == 1 {
+			pairs = append(pairs, [2]int{i, c.bIndex})
+		}
+	}
+
+	// Longest increasing subsequence of the b indexes by patience sorting:
+	// tails[n] is the pair ending the best subsequence of length n+1.
+	var tails []int
+	prev := make([]int, len(pairs))
+	for k, pair := range pairs {
+		n := sort.Search(len(tails), func(t int) bool { return pairs[tails[t]][1] > pair[1] })
+		prev[k] = -1
+		if n > 0 {
+			prev[k] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, k)
+		} else {
+			tails[n] = k
+		}
+	}
+	if len(tails) == 0 {
+		return nil
+	}
+	anchors := make([][2]int, len(tails))
+	k := tails[len(tails)-1]
+	for n := len(tails) - 1; n >= 0; n-- {
+		anchors[n] = pairs[k]
+		k = prev[k]
+	}
+	return anchors
+}
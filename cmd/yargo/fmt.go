@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sansecio/yargo/parser"
+)
+
+// runFmt implements "yargo fmt", which prints rule files in canonical
+// form, like gofmt. It returns the exit status.
+func runFmt(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	showDiff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: yargo fmt [-w] [-d] [rules.yar...]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintf(os.Stderr, "error: cannot use -w with standard input\n")
+			return 2
+		}
+		if err := formatFile("<standard input>", os.Stdin, false, *showDiff); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err == nil {
+			err = formatFile(name, f, *write, *showDiff)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// formatFile formats the rules read from r, named name, and writes them
+// back to the file, prints a diff or prints them.
+func formatFile(name string, r io.Reader, write, showDiff bool) error {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := parser.NewWithOptions(parser.Options{KeepIncludes: true}).Parse(string(src))
+	var errs parser.ErrorList
+	if errors.As(err, &errs) {
+		for _, e := range errs {
+			e.File = name
+		}
+	}
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	ruleSet.WriteTo(&out)
+	formatted := out.Bytes()
+
+	if showDiff {
+		os.Stdout.Write(unifiedDiff(name+".orig", name, src, formatted))
+	}
+	if write {
+		if bytes.Equal(src, formatted) {
+			return nil
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(name, formatted, info.Mode().Perm())
+	}
+	if !showDiff {
+		os.Stdout.Write(formatted)
+	}
+	return nil
+}
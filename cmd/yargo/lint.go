@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sansecio/yargo/parser"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// runLint implements "yargo lint", which reports strings that make scans
+// slow. It returns the exit status: 1 if anything was reported.
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print diagnostics as JSON, one object per line")
+	severity := flags.String("severity", "warning", "report diagnostics of this `level` and above: info, warning or error")
+	opts := scanner.DefaultLintOptions()
+	flags.IntVar(&opts.MinAtomQuality, "min-quality", opts.MinAtomQuality, "report literals and atoms scoring below `score`, or none if 0")
+	flags.IntVar(&opts.MinLength, "min-length", opts.MinLength, "report literals and base64 patterns shorter than `n` bytes, or none if 0")
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: yargo lint [-json] [-severity level] [-min-quality score] [-min-length n] [namespace:]<rules.yar>...\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	minSeverity, err := scanner.ParseSeverity(*severity)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+
+	var ruleFiles []parser.File
+	for _, arg := range flags.Args() {
+		ruleFiles = append(ruleFiles, ruleFile(arg))
+	}
+	ruleSet, err := parser.New().ParseFiles(ruleFiles...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	status := 0
+	enc := json.NewEncoder(os.Stdout)
+	for _, d := range scanner.Lint(ruleSet, opts) {
+		if d.Severity < minSeverity {
+			continue
+		}
+		status = 1
+		if *asJSON {
+			enc.Encode(d)
+		} else {
+			fmt.Println(d)
+		}
+	}
+	return status
+}
@@ -1,33 +1,115 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/sansecio/yargo/modules/console"
+	"github.com/sansecio/yargo/modules/elf"
+	"github.com/sansecio/yargo/modules/hash"
+	"github.com/sansecio/yargo/modules/math"
+	"github.com/sansecio/yargo/modules/pe"
+	"github.com/sansecio/yargo/modules/stringmod"
 	"github.com/sansecio/yargo/parser"
 	"github.com/sansecio/yargo/scanner"
 )
 
+// externals collects -d name=value flags.
+type externals map[string]any
+
+func (e externals) String() string { return "" }
+
+// Set parses name=value, where value is a bool, an integer, a float or
+// otherwise a string, as with yara -d.
+func (e externals) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	e[name] = value
+	if value == "true" || value == "false" {
+		e[name] = value == "true"
+	} else if n, err := strconv.ParseInt(value, 0, 64); err == nil {
+		e[name] = n
+	} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+		e[name] = f
+	}
+	return nil
+}
+
+// ruleFile returns the rule file named by a [namespace:]path argument. The
+// text before the first colon is a namespace only if it is an identifier
+// and the whole argument is not an existing file, so that paths such as
+// C:\rules\a.yar and dir:x/a.yar are read as paths.
+func ruleFile(arg string) parser.File {
+	ns, name, ok := strings.Cut(arg, ":")
+	if !ok || !isIdent(ns) {
+		return parser.File{Name: arg}
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return parser.File{Name: arg}
+	}
+	return parser.File{Name: name, Namespace: ns}
+}
+
+// isIdent reports whether s is a YARA identifier.
+func isIdent(s string) bool {
+	for i, c := range s {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return s != ""
+}
+
 func main() {
-	if len(os.Args) != 3 {
-		fmt.Fprintf(os.Stderr, "usage: yargo <rules.yar> <path>\n")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(runFmt(os.Args[2:]))
+		case "lint":
+			os.Exit(runLint(os.Args[2:]))
+		}
+	}
+
+	defines := externals{}
+	flag.Var(defines, "d", "define external variable `name=value` (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: yargo [-d name=value]... [namespace:]<rules.yar>... <path>\n")
+		fmt.Fprintf(os.Stderr, "       yargo fmt [-w] [-d] [rules.yar...]\n")
+		fmt.Fprintf(os.Stderr, "       yargo lint [-json] [-severity level] [namespace:]<rules.yar>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	rulesFile := os.Args[1]
-	scanPath := os.Args[2]
+	var ruleFiles []parser.File
+	for _, arg := range flag.Args()[:flag.NArg()-1] {
+		ruleFiles = append(ruleFiles, ruleFile(arg))
+	}
+	scanPath := flag.Arg(flag.NArg() - 1)
 
 	p := parser.New()
-	ruleSet, err := p.ParseFile(rulesFile)
+	ruleSet, err := p.ParseFiles(ruleFiles...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error parsing rules: %v\n", err)
 		os.Exit(1)
 	}
 
-	rules, err := scanner.Compile(ruleSet)
+	rules, err := scanner.CompileWithOptions(ruleSet, scanner.CompileOptions{
+		Modules:   []scanner.Module{pe.New(), elf.New(), hash.New(), math.New(), stringmod.New(), console.New()},
+		Externals: defines,
+		Console:   os.Stderr,
+	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error compiling rules: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,68 @@
+// Package exe maps the virtual addresses of PE and ELF executables to file
+// offsets, for the pe and elf modules and the entrypoint keyword.
+package exe
+
+import "debug/elf"
+
+// Section is the part of a PE section header that maps addresses.
+type Section struct {
+	VirtualAddress uint32
+	VirtualSize    uint32
+	RawOffset      uint32 // PointerToRawData
+	RawSize        uint32 // SizeOfRawData
+}
+
+// Contains reports whether rva lies in the section, which extends over the
+// larger of its virtual and raw sizes.
+func (s Section) Contains(rva uint32) bool {
+	return rva >= s.VirtualAddress && rva-s.VirtualAddress < max(s.VirtualSize, s.RawSize)
+}
+
+// RVAToOffset maps a relative virtual address to an offset in a PE file of
+// size bytes with the given sections. Addresses below the first section
+// fall in the headers. The second result is false when rva is in no
+// section or maps outside the file.
+func RVAToOffset(sections []Section, rva uint32, size int64) (int64, bool) {
+	off := int64(-1)
+	lowest := uint32(0xffffffff)
+	for _, s := range sections {
+		lowest = min(lowest, s.VirtualAddress)
+		if s.Contains(rva) {
+			off = int64(s.RawOffset) + int64(rva-s.VirtualAddress)
+			break
+		}
+	}
+	if off < 0 && rva < lowest {
+		off = int64(rva)
+	}
+	if off < 0 || off >= size {
+		return 0, false
+	}
+	return off, true
+}
+
+// AddrToOffset maps a virtual address to an offset in the ELF file f of
+// size bytes, through the loadable segments, or through the sections when
+// there are no segments. The second result is false when addr is not
+// mapped from the file or maps outside it.
+func AddrToOffset(f *elf.File, addr uint64, size int64) (int64, bool) {
+	off := int64(-1)
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && addr >= p.Vaddr && addr-p.Vaddr < p.Filesz {
+			off = int64(p.Off + addr - p.Vaddr)
+			break
+		}
+	}
+	if len(f.Progs) == 0 {
+		for _, s := range f.Sections {
+			if s.Flags&elf.SHF_ALLOC != 0 && s.Type != elf.SHT_NOBITS && addr >= s.Addr && addr-s.Addr < s.Size {
+				off = int64(s.Offset + addr - s.Addr)
+				break
+			}
+		}
+	}
+	if off < 0 || off >= size {
+		return 0, false
+	}
+	return off, true
+}
@@ -0,0 +1,30 @@
+package exe
+
+import "testing"
+
+func TestRVAToOffset(t *testing.T) {
+	sections := []Section{
+		{VirtualAddress: 0x1000, VirtualSize: 0x800, RawOffset: 0x400, RawSize: 0x200},
+		{VirtualAddress: 0x2000, VirtualSize: 0x100, RawOffset: 0x600, RawSize: 0x200},
+	}
+	tests := []struct {
+		rva  uint32
+		size int64
+		want int64
+		ok   bool
+	}{
+		{0x10, 0x1000, 0x10, true},     // headers
+		{0x1010, 0x1000, 0x410, true},  // first section
+		{0x1700, 0x1000, 0x0b00, true}, // past the raw data, within the virtual size
+		{0x2180, 0x1000, 0x780, true},  // past the virtual size, within the raw data
+		{0x1900, 0x1000, 0, false},     // between sections
+		{0x3000, 0x1000, 0, false},     // after the last section
+		{0x1700, 0x0800, 0, false},     // beyond the end of the file
+	}
+	for _, tt := range tests {
+		got, ok := RVAToOffset(sections, tt.rva, tt.size)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("RVAToOffset(%#x) = %#x, %v, want %#x, %v", tt.rva, got, ok, tt.want, tt.ok)
+		}
+	}
+}
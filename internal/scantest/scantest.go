@@ -0,0 +1,54 @@
+// Package scantest compiles and scans rules for the tests of the scanner
+// and its modules.
+package scantest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sansecio/yargo/parser"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Compile parses src and compiles it with opts, failing the test on
+// errors.
+func Compile(t testing.TB, src string, opts scanner.CompileOptions) *scanner.Rules {
+	t.Helper()
+	rs, err := parser.New().Parse(src)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := scanner.CompileWithOptions(rs, opts)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	return rules
+}
+
+// Scan scans data with rules and returns the names of the matching rules,
+// failing the test on errors.
+func Scan(t testing.TB, rules *scanner.Rules, data []byte) []string {
+	t.Helper()
+	var matches scanner.MatchRules
+	if err := rules.ScanMem(data, 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, m.Rule)
+	}
+	return names
+}
+
+// Match reports whether a rule with condition cond, importing the modules
+// of opts, matches data.
+func Match(t testing.TB, cond string, data []byte, opts scanner.CompileOptions) bool {
+	t.Helper()
+	var src strings.Builder
+	for _, m := range opts.Modules {
+		src.WriteString("import \"" + m.Name() + "\"\n")
+	}
+	src.WriteString("rule t { condition: " + cond + " }")
+	return len(Scan(t, Compile(t, src.String(), opts), data)) > 0
+}
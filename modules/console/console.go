@@ -0,0 +1,100 @@
+// Package console implements the console module, which lets rule authors
+// print values while a condition is evaluated:
+//
+//	import "console"
+//
+//	rule debug {
+//	    condition:
+//	        console.log("size: ", filesize) and console.hex("magic: ", uint16(0))
+//	}
+//
+// log prints a string, integer or float, and hex an integer in hex, each
+// optionally preceded by a message. Every call writes one line to
+// scanner.ScanContext.Console, configured with
+// scanner.CompileOptions.Console, and is true, so calls can be chained with
+// and. Non-printable bytes in strings are escaped as \xNN, as in YARA.
+package console
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Module is the console module.
+type Module struct{}
+
+// New returns the console module, to be passed in
+// scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "console".
+func (m *Module) Name() string { return "console" }
+
+// Load returns the console functions, writing to sc.Console.
+func (m *Module) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	w := sc.Console
+	return scanner.Struct{
+		"log": printer(w, func(v any) (string, bool) {
+			switch v := v.(type) {
+			case string:
+				return escape(v), true
+			case int64:
+				return strconv.FormatInt(v, 10), true
+			case float64:
+				return strconv.FormatFloat(v, 'f', 6, 64), true
+			default:
+				return "", false
+			}
+		}),
+		"hex": printer(w, func(v any) (string, bool) {
+			n, ok := v.(int64)
+			return fmt.Sprintf("0x%x", uint64(n)), ok
+		}),
+	}, nil
+}
+
+// printer returns a function printing its last argument formatted with
+// format, after an optional message.
+func printer(w io.Writer, format func(any) (string, bool)) scanner.Func {
+	return func(args []any) (any, bool) {
+		var msg string
+		switch len(args) {
+		case 1:
+		case 2:
+			s, ok := args[0].(string)
+			if !ok {
+				return nil, false
+			}
+			msg = escape(s)
+		default:
+			return nil, false
+		}
+		v, ok := format(args[len(args)-1])
+		if !ok {
+			return nil, false
+		}
+		if w != nil {
+			io.WriteString(w, msg+v+"\n")
+		}
+		return true, true
+	}
+}
+
+// escape replaces the non-printable bytes of s with \xNN escapes.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= 0x20 && c < 0x7f {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package console
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// scan reports whether a rule with condition cond matches a short MZ
+// header, compiled with the console module and opts.
+func scan(t *testing.T, cond string, opts scanner.CompileOptions) bool {
+	t.Helper()
+	opts.Modules = []scanner.Module{New()}
+	return scantest.Match(t, cond, []byte("MZ\x90\x00"), opts)
+}
+
+func TestLog(t *testing.T) {
+	tests := []struct {
+		cond  string
+		want  bool
+		lines string
+	}{
+		{`console.log("hello")`, true, "hello\n"},
+		{`console.log("size: ", filesize)`, true, "size: 4\n"},
+		{`console.log(filesize)`, true, "4\n"},
+		{`console.log("ratio: ", filesize \ 8.0)`, true, "ratio: 0.500000\n"},
+		{`console.log("tab\there\x00")`, true, "tab\\x09here\\x00\n"},
+		{`console.hex(uint16(0))`, true, "0x5a4d\n"},
+		{`console.hex("byte: ", uint8(2))`, true, "byte: 0x90\n"},
+		{`console.hex(-1)`, true, "0xffffffffffffffff\n"},
+		{`console.log("a") and console.log("b")`, true, "a\nb\n"},
+		{`console.log("a") and uint8(0) == 0 and console.log("b")`, false, "a\n"},
+
+		// Calls with undefined or unsupported arguments print nothing.
+		{`console.log(filesize \ 0)`, false, ""},
+		{`console.hex("x")`, false, ""},
+		{`console.log(1, 2)`, false, ""},
+		{`console.log()`, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			var out bytes.Buffer
+			if got := scan(t, tt.cond, scanner.CompileOptions{Console: &out}); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+			if out.String() != tt.lines {
+				t.Errorf("output = %q, want %q", out.String(), tt.lines)
+			}
+		})
+	}
+}
+
+func TestLogWithoutConsole(t *testing.T) {
+	if !scan(t, `console.log("discarded")`, scanner.CompileOptions{}) {
+		t.Error("console.log without a configured console did not match")
+	}
+}
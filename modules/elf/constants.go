@@ -0,0 +1,115 @@
+package elf
+
+import (
+	debugelf "debug/elf"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// constants are the named values rules compare fields against, as in
+// elf.type == elf.ET_EXEC. They are defined for any scanned data.
+var constants = scanner.Struct{
+	"ET_NONE": uint16(debugelf.ET_NONE),
+	"ET_REL":  uint16(debugelf.ET_REL),
+	"ET_EXEC": uint16(debugelf.ET_EXEC),
+	"ET_DYN":  uint16(debugelf.ET_DYN),
+	"ET_CORE": uint16(debugelf.ET_CORE),
+
+	"EM_NONE":        uint16(debugelf.EM_NONE),
+	"EM_M32":         uint16(debugelf.EM_M32),
+	"EM_SPARC":       uint16(debugelf.EM_SPARC),
+	"EM_386":         uint16(debugelf.EM_386),
+	"EM_68K":         uint16(debugelf.EM_68K),
+	"EM_88K":         uint16(debugelf.EM_88K),
+	"EM_860":         uint16(debugelf.EM_860),
+	"EM_MIPS":        uint16(debugelf.EM_MIPS),
+	"EM_MIPS_RS3_LE": uint16(debugelf.EM_MIPS_RS3_LE),
+	"EM_PPC":         uint16(debugelf.EM_PPC),
+	"EM_PPC64":       uint16(debugelf.EM_PPC64),
+	"EM_ARM":         uint16(debugelf.EM_ARM),
+	"EM_X86_64":      uint16(debugelf.EM_X86_64),
+	"EM_AARCH64":     uint16(debugelf.EM_AARCH64),
+	"EM_RISCV":       uint16(debugelf.EM_RISCV),
+
+	"SHT_NULL":     uint32(debugelf.SHT_NULL),
+	"SHT_PROGBITS": uint32(debugelf.SHT_PROGBITS),
+	"SHT_SYMTAB":   uint32(debugelf.SHT_SYMTAB),
+	"SHT_STRTAB":   uint32(debugelf.SHT_STRTAB),
+	"SHT_RELA":     uint32(debugelf.SHT_RELA),
+	"SHT_HASH":     uint32(debugelf.SHT_HASH),
+	"SHT_DYNAMIC":  uint32(debugelf.SHT_DYNAMIC),
+	"SHT_NOTE":     uint32(debugelf.SHT_NOTE),
+	"SHT_NOBITS":   uint32(debugelf.SHT_NOBITS),
+	"SHT_REL":      uint32(debugelf.SHT_REL),
+	"SHT_SHLIB":    uint32(debugelf.SHT_SHLIB),
+	"SHT_DYNSYM":   uint32(debugelf.SHT_DYNSYM),
+
+	"SHF_WRITE":     uint32(debugelf.SHF_WRITE),
+	"SHF_ALLOC":     uint32(debugelf.SHF_ALLOC),
+	"SHF_EXECINSTR": uint32(debugelf.SHF_EXECINSTR),
+
+	"PT_NULL":         uint32(debugelf.PT_NULL),
+	"PT_LOAD":         uint32(debugelf.PT_LOAD),
+	"PT_DYNAMIC":      uint32(debugelf.PT_DYNAMIC),
+	"PT_INTERP":       uint32(debugelf.PT_INTERP),
+	"PT_NOTE":         uint32(debugelf.PT_NOTE),
+	"PT_SHLIB":        uint32(debugelf.PT_SHLIB),
+	"PT_PHDR":         uint32(debugelf.PT_PHDR),
+	"PT_TLS":          uint32(debugelf.PT_TLS),
+	"PT_GNU_EH_FRAME": uint32(debugelf.PT_GNU_EH_FRAME),
+	"PT_GNU_STACK":    uint32(debugelf.PT_GNU_STACK),
+
+	"PF_X": uint32(debugelf.PF_X),
+	"PF_W": uint32(debugelf.PF_W),
+	"PF_R": uint32(debugelf.PF_R),
+
+	"DT_NULL":         int64(debugelf.DT_NULL),
+	"DT_NEEDED":       int64(debugelf.DT_NEEDED),
+	"DT_PLTRELSZ":     int64(debugelf.DT_PLTRELSZ),
+	"DT_PLTGOT":       int64(debugelf.DT_PLTGOT),
+	"DT_HASH":         int64(debugelf.DT_HASH),
+	"DT_STRTAB":       int64(debugelf.DT_STRTAB),
+	"DT_SYMTAB":       int64(debugelf.DT_SYMTAB),
+	"DT_RELA":         int64(debugelf.DT_RELA),
+	"DT_RELASZ":       int64(debugelf.DT_RELASZ),
+	"DT_RELAENT":      int64(debugelf.DT_RELAENT),
+	"DT_STRSZ":        int64(debugelf.DT_STRSZ),
+	"DT_SYMENT":       int64(debugelf.DT_SYMENT),
+	"DT_INIT":         int64(debugelf.DT_INIT),
+	"DT_FINI":         int64(debugelf.DT_FINI),
+	"DT_SONAME":       int64(debugelf.DT_SONAME),
+	"DT_RPATH":        int64(debugelf.DT_RPATH),
+	"DT_SYMBOLIC":     int64(debugelf.DT_SYMBOLIC),
+	"DT_REL":          int64(debugelf.DT_REL),
+	"DT_RELSZ":        int64(debugelf.DT_RELSZ),
+	"DT_RELENT":       int64(debugelf.DT_RELENT),
+	"DT_PLTREL":       int64(debugelf.DT_PLTREL),
+	"DT_DEBUG":        int64(debugelf.DT_DEBUG),
+	"DT_TEXTREL":      int64(debugelf.DT_TEXTREL),
+	"DT_JMPREL":       int64(debugelf.DT_JMPREL),
+	"DT_BIND_NOW":     int64(debugelf.DT_BIND_NOW),
+	"DT_INIT_ARRAY":   int64(debugelf.DT_INIT_ARRAY),
+	"DT_FINI_ARRAY":   int64(debugelf.DT_FINI_ARRAY),
+	"DT_INIT_ARRAYSZ": int64(debugelf.DT_INIT_ARRAYSZ),
+	"DT_FINI_ARRAYSZ": int64(debugelf.DT_FINI_ARRAYSZ),
+	"DT_RUNPATH":      int64(debugelf.DT_RUNPATH),
+	"DT_FLAGS":        int64(debugelf.DT_FLAGS),
+	"DT_ENCODING":     int64(debugelf.DT_ENCODING),
+
+	"STT_NOTYPE":  uint8(debugelf.STT_NOTYPE),
+	"STT_OBJECT":  uint8(debugelf.STT_OBJECT),
+	"STT_FUNC":    uint8(debugelf.STT_FUNC),
+	"STT_SECTION": uint8(debugelf.STT_SECTION),
+	"STT_FILE":    uint8(debugelf.STT_FILE),
+	"STT_COMMON":  uint8(debugelf.STT_COMMON),
+	"STT_TLS":     uint8(debugelf.STT_TLS),
+
+	"STB_LOCAL":  uint8(debugelf.STB_LOCAL),
+	"STB_GLOBAL": uint8(debugelf.STB_GLOBAL),
+	"STB_WEAK":   uint8(debugelf.STB_WEAK),
+
+	"STV_DEFAULT":   uint8(debugelf.STV_DEFAULT),
+	"STV_INTERNAL":  uint8(debugelf.STV_INTERNAL),
+	"STV_HIDDEN":    uint8(debugelf.STV_HIDDEN),
+	"STV_PROTECTED": uint8(debugelf.STV_PROTECTED),
+}
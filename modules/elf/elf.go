@@ -0,0 +1,234 @@
+// Package elf implements the elf module, which exposes the header,
+// sections, segments, symbols and dynamic entries of ELF files to rule
+// conditions:
+//
+//	import "elf"
+//
+//	rule miner {
+//	    condition:
+//	        elf.type == elf.ET_EXEC and elf.machine == elf.EM_X86_64
+//	}
+//
+// Field names follow YARA's elf module. Data that is not an ELF file only
+// defines the constants.
+package elf
+
+import (
+	"bytes"
+	debugelf "debug/elf"
+	"encoding/binary"
+	"io"
+	"maps"
+
+	"github.com/sansecio/yargo/internal/exe"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Module is the elf module.
+type Module struct{}
+
+// New returns the elf module, to be passed in scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "elf".
+func (m *Module) Name() string { return "elf" }
+
+// Load parses the scanned data as an ELF file. Malformed files are not an
+// error: whatever could be parsed is returned and the rest is undefined.
+func (m *Module) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	v := make(scanner.Struct, len(constants)+16)
+	maps.Copy(v, constants)
+	if f := parse(sc.Data); f != nil {
+		f.fields(v)
+	}
+	return v, nil
+}
+
+// maxSymbols bounds the symbols read from each symbol table.
+const maxSymbols = 1 << 20
+
+// file is a parsed ELF file.
+type file struct {
+	data []byte
+	elf  *debugelf.File
+}
+
+// parse returns the ELF file in data, or nil if data is not an ELF file.
+func parse(data []byte) (f *file) {
+	if len(data) < 4 || string(data[:4]) != debugelf.ELFMAG {
+		return nil
+	}
+	// debug/elf is not hardened against malformed input.
+	defer func() {
+		if recover() != nil {
+			f = nil
+		}
+	}()
+	ef, err := debugelf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	return &file{data: data, elf: ef}
+}
+
+func (f *file) fields(v scanner.Struct) {
+	ef := f.elf
+	v["type"] = uint16(ef.Type)
+	v["machine"] = uint16(ef.Machine)
+	if off, ok := f.addrToOffset(ef.Entry); ok {
+		v["entry_point"] = off
+	}
+	f.headerOffsets(v)
+
+	sections := make(scanner.Array, len(ef.Sections))
+	for i, s := range ef.Sections {
+		sections[i] = scanner.Struct{
+			"type":    uint32(s.Type),
+			"flags":   uint64(s.Flags),
+			"address": s.Addr,
+			"name":    s.Name,
+			"size":    s.Size,
+			"offset":  s.Offset,
+		}
+	}
+	v["number_of_sections"] = len(ef.Sections)
+	v["sections"] = sections
+
+	segments := make(scanner.Array, len(ef.Progs))
+	for i, p := range ef.Progs {
+		segments[i] = scanner.Struct{
+			"type":             uint32(p.Type),
+			"flags":            uint32(p.Flags),
+			"offset":           p.Off,
+			"virtual_address":  p.Vaddr,
+			"physical_address": p.Paddr,
+			"file_size":        p.Filesz,
+			"memory_size":      p.Memsz,
+			"alignment":        p.Align,
+		}
+	}
+	v["number_of_segments"] = len(ef.Progs)
+	v["segments"] = segments
+
+	if dynamic, ok := f.dynamic(); ok {
+		v["dynamic_section_entries"] = len(dynamic)
+		v["dynamic"] = dynamic
+	}
+	if symbols, ok := f.symbols(debugelf.SHT_SYMTAB); ok {
+		v["symtab_entries"] = len(symbols)
+		v["symtab"] = symbols
+	}
+	if symbols, ok := f.symbols(debugelf.SHT_DYNSYM); ok {
+		v["dynsym_entries"] = len(symbols)
+		v["dynsym"] = symbols
+	}
+}
+
+// headerOffsets adds the header fields debug/elf does not keep.
+func (f *file) headerOffsets(v scanner.Struct) {
+	order := f.elf.ByteOrder
+	if f.elf.Class == debugelf.ELFCLASS64 && len(f.data) >= 64 {
+		v["ph_offset"] = order.Uint64(f.data[0x20:])
+		v["sh_offset"] = order.Uint64(f.data[0x28:])
+		v["ph_entry_size"] = order.Uint16(f.data[0x36:])
+		v["sh_entry_size"] = order.Uint16(f.data[0x3a:])
+	} else if f.elf.Class == debugelf.ELFCLASS32 && len(f.data) >= 52 {
+		v["ph_offset"] = order.Uint32(f.data[0x1c:])
+		v["sh_offset"] = order.Uint32(f.data[0x20:])
+		v["ph_entry_size"] = order.Uint16(f.data[0x2a:])
+		v["sh_entry_size"] = order.Uint16(f.data[0x2e:])
+	}
+}
+
+// addrToOffset maps a virtual address to a file offset through the
+// loadable segments, or through the sections when there are no segments.
+func (f *file) addrToOffset(addr uint64) (int64, bool) {
+	return exe.AddrToOffset(f.elf, addr, int64(len(f.data)))
+}
+
+// dynamic returns the entries of the dynamic section, or of the dynamic
+// segment when the section headers are stripped, up to and including the
+// terminating DT_NULL.
+func (f *file) dynamic() (scanner.Array, bool) {
+	var r io.Reader
+	for _, s := range f.elf.Sections {
+		if s.Type == debugelf.SHT_DYNAMIC {
+			r = s.Open()
+			break
+		}
+	}
+	if r == nil {
+		for _, p := range f.elf.Progs {
+			if p.Type == debugelf.PT_DYNAMIC {
+				r = p.Open()
+				break
+			}
+		}
+	}
+	if r == nil {
+		return nil, false
+	}
+
+	var entries scanner.Array
+	for len(entries) < maxSymbols {
+		var tag, val uint64
+		if f.elf.Class == debugelf.ELFCLASS64 {
+			var e [2]uint64
+			if binary.Read(r, f.elf.ByteOrder, &e) != nil {
+				break
+			}
+			tag, val = e[0], e[1]
+		} else {
+			var e [2]uint32
+			if binary.Read(r, f.elf.ByteOrder, &e) != nil {
+				break
+			}
+			tag, val = uint64(e[0]), uint64(e[1])
+		}
+		entries = append(entries, scanner.Struct{"type": tag, "val": val})
+		if debugelf.DynTag(tag) == debugelf.DT_NULL {
+			break
+		}
+	}
+	return entries, true
+}
+
+// symbols returns the symbols of the first section of type typ, starting
+// with the reserved null symbol so indexes match the symbol table.
+func (f *file) symbols(typ debugelf.SectionType) (scanner.Array, bool) {
+	if f.elf.SectionByType(typ) == nil {
+		return nil, false
+	}
+	var syms []debugelf.Symbol
+	var err error
+	if typ == debugelf.SHT_SYMTAB {
+		syms, err = f.elf.Symbols()
+	} else {
+		syms, err = f.elf.DynamicSymbols()
+	}
+	if err != nil {
+		return nil, false
+	}
+	syms = syms[:min(len(syms), maxSymbols-1)]
+
+	list := make(scanner.Array, 0, len(syms)+1)
+	list = append(list, symbol(debugelf.Symbol{}))
+	for _, s := range syms {
+		list = append(list, symbol(s))
+	}
+	return list, true
+}
+
+func symbol(s debugelf.Symbol) scanner.Struct {
+	return scanner.Struct{
+		"name":       s.Name,
+		"value":      s.Value,
+		"size":       s.Size,
+		"type":       s.Info & 0xf,
+		"bind":       s.Info >> 4,
+		"shndx":      uint16(s.Section),
+		"visibility": s.Other & 0x3,
+	}
+}
@@ -0,0 +1,143 @@
+package elf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// targets are the builds of testdata/hello the tests scan.
+var targets = []struct {
+	name, goarch, buildmode string
+}{
+	{"amd64", "amd64", "exe"},
+	{"386", "386", "exe"},
+	{"arm64-pie", "arm64", "pie"},
+}
+
+var errNoGo = errors.New("go command not found")
+
+// buildFixtures builds testdata/hello for every target with the Go
+// toolchain running the tests.
+var buildFixtures = sync.OnceValues(func() (map[string][]byte, error) {
+	gocmd, err := exec.LookPath("go")
+	if err != nil {
+		return nil, errNoGo
+	}
+	dir, err := os.MkdirTemp("", "yargo-elf")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	fixtures := make(map[string][]byte, len(targets))
+	for _, target := range targets {
+		out := filepath.Join(dir, target.name)
+		cmd := exec.Command(gocmd, "build", "-trimpath", "-buildmode="+target.buildmode, "-o", out, "./testdata/hello")
+		cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH="+target.goarch, "CGO_ENABLED=0")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("building %s: %v\n%s", target.name, err, output)
+		}
+		if fixtures[target.name], err = os.ReadFile(out); err != nil {
+			return nil, err
+		}
+	}
+	return fixtures, nil
+})
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	fixtures, err := buildFixtures()
+	if errors.Is(err, errNoGo) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fixtures[name]
+}
+
+var opts = scanner.CompileOptions{Modules: []scanner.Module{New()}}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		target string
+		cond   string
+		want   bool
+	}{
+		{"amd64", `elf.type == elf.ET_EXEC and elf.machine == elf.EM_X86_64`, true},
+		{"amd64", `elf.entry_point == entrypoint`, true},
+		{"amd64", `elf.ph_offset == 64 and elf.ph_entry_size == 56 and elf.sh_entry_size == 64`, true},
+		{"amd64", `elf.sh_offset > 0 and elf.number_of_sections > 10`, true},
+		{"amd64", `for any i in (0..elf.number_of_segments - 1) : (elf.segments[i].type == elf.PT_LOAD and elf.segments[i].flags & elf.PF_X)`, true},
+		{"amd64", `for any i in (0..elf.number_of_sections - 1) : (elf.sections[i].type == elf.SHT_SYMTAB)`, true},
+		{"amd64", `elf.symtab_entries > 100 and elf.symtab[0].value == 0`, true},
+		{"amd64", `for any i in (0..elf.number_of_sections - 1) : (elf.sections[i].name == ".text" and elf.sections[i].flags & elf.SHF_EXECINSTR)`, true},
+		{"amd64", `for any i in (0..elf.symtab_entries - 1) : (elf.symtab[i].name == "main.beacon" and elf.symtab[i].type == elf.STT_FUNC)`, true},
+		{"amd64", `elf.dynamic_section_entries == 0`, false},
+		{"amd64", `elf.dynsym_entries == 0`, false},
+
+		{"386", `elf.type == elf.ET_EXEC and elf.machine == elf.EM_386`, true},
+		{"386", `elf.ph_offset == 52 and elf.ph_entry_size == 32 and elf.sh_entry_size == 40`, true},
+		{"386", `elf.entry_point == entrypoint`, true},
+
+		{"arm64-pie", `elf.type == elf.ET_DYN and elf.machine == elf.EM_AARCH64`, true},
+		{"arm64-pie", `elf.entry_point == entrypoint`, true},
+		{"arm64-pie", `elf.dynamic_section_entries > 1`, true},
+		{"arm64-pie", `elf.dynamic[elf.dynamic_section_entries - 1].type == elf.DT_NULL`, true},
+		{"arm64-pie", `for any i in (0..elf.dynamic_section_entries - 1) : (elf.dynamic[i].type == elf.DT_RELA and elf.dynamic[i].val > 0)`, true},
+		{"arm64-pie", `for any i in (0..elf.number_of_segments - 1) : (elf.segments[i].type == elf.PT_DYNAMIC)`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target+"/"+tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, fixture(t, tt.target), opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	v, err := New().Load(&scanner.ScanContext{Data: fixture(t, "amd64")})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	sections := v["sections"].(scanner.Array)
+	var beacon scanner.Struct
+	for _, s := range v["symtab"].(scanner.Array) {
+		if sym := s.(scanner.Struct); sym["name"] == "main.beacon" {
+			beacon = sym
+		}
+	}
+	if beacon == nil {
+		t.Fatal("main.beacon not found in symtab")
+	}
+	if beacon["type"] != constants["STT_FUNC"] {
+		t.Errorf("main.beacon type = %v, want STT_FUNC", beacon["type"])
+	}
+	if got := sections[beacon["shndx"].(uint16)].(scanner.Struct)["name"]; got != ".text" {
+		t.Errorf("main.beacon is in section %v, want .text", got)
+	}
+}
+
+func TestNotELF(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("#!/bin/sh\necho hi\n"),
+		[]byte("\x7fELF truncated"),
+	} {
+		if !scantest.Match(t, `elf.ET_EXEC == 2`, data, opts) {
+			t.Errorf("%q: expected constants to be defined", data)
+		}
+		if scantest.Match(t, `elf.type >= 0 or not (elf.type >= 0)`, data, opts) {
+			t.Errorf("%q: expected elf.type to be undefined", data)
+		}
+	}
+}
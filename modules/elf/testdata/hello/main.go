@@ -0,0 +1,9 @@
+// Command hello is built by the elf module tests for several targets.
+package main
+
+import "os"
+
+//go:noinline
+func beacon() int { return len(os.Args) }
+
+func main() { os.Exit(beacon()) }
@@ -0,0 +1,109 @@
+// Package hash implements the hash module, which computes digests and
+// checksums over ranges of the scanned data or over strings:
+//
+//	import "hash"
+//
+//	rule known_bad {
+//	    condition:
+//	        hash.sha256(0, filesize) == "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+//	}
+//
+// md5, sha1 and sha256 return lower-case hex strings; crc32 and checksum32
+// return integers. Each function takes either an offset and a size in the
+// scanned data or a single string. A range that starts outside the data is
+// undefined, and one that extends past its end is truncated, as in YARA.
+package hash
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/crc32"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Module is the hash module.
+type Module struct{}
+
+// New returns the hash module, to be passed in
+// scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "hash".
+func (m *Module) Name() string { return "hash" }
+
+// Load returns the hash functions for a scan of sc.Data. Results over
+// ranges of the data are cached for the scan, so rules repeating a hash
+// of the same range compute it once.
+func (m *Module) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	s := &scan{data: sc.Data, cache: make(map[rangeKey]any)}
+	return scanner.Struct{
+		"md5": s.function("md5", func(b []byte) any {
+			sum := md5.Sum(b)
+			return hex.EncodeToString(sum[:])
+		}),
+		"sha1": s.function("sha1", func(b []byte) any {
+			sum := sha1.Sum(b)
+			return hex.EncodeToString(sum[:])
+		}),
+		"sha256": s.function("sha256", func(b []byte) any {
+			sum := sha256.Sum256(b)
+			return hex.EncodeToString(sum[:])
+		}),
+		"crc32":      s.function("crc32", func(b []byte) any { return crc32.ChecksumIEEE(b) }),
+		"checksum32": s.function("checksum32", checksum32),
+	}, nil
+}
+
+type scan struct {
+	data  []byte
+	cache map[rangeKey]any
+}
+
+type rangeKey struct {
+	name         string
+	offset, size int64
+}
+
+// function returns the module function name, computing sum over a range
+// of the data or over a string argument.
+func (s *scan) function(name string, sum func([]byte) any) scanner.Func {
+	return func(args []any) (any, bool) {
+		switch len(args) {
+		case 1:
+			str, ok := args[0].(string)
+			if !ok {
+				return nil, false
+			}
+			return sum([]byte(str)), true
+		case 2:
+			offset, ok1 := args[0].(int64)
+			size, ok2 := args[1].(int64)
+			if !ok1 || !ok2 || offset < 0 || offset >= int64(len(s.data)) || size < 0 {
+				return nil, false
+			}
+			key := rangeKey{name, offset, size}
+			if v, ok := s.cache[key]; ok {
+				return v, true
+			}
+			v := sum(s.data[offset : offset+min(size, int64(len(s.data))-offset)])
+			s.cache[key] = v
+			return v, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// checksum32 adds up the bytes, modulo 2^32.
+func checksum32(b []byte) any {
+	var sum uint32
+	for _, c := range b {
+		sum += uint32(c)
+	}
+	return sum
+}
@@ -0,0 +1,75 @@
+package hash
+
+import (
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+var opts = scanner.CompileOptions{Modules: []scanner.Module{New()}}
+
+func TestConditions(t *testing.T) {
+	data := []byte("<?php eval($_POST['x']); ?>")
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`hash.md5("abc") == "900150983cd24fb0d6963f7d28e17f72"`, true},
+		{`hash.sha1("abc") == "a9993e364706816aba3e25717850c26c9cd0d89d"`, true},
+		{`hash.sha256("abc") == "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"`, true},
+		{`hash.crc32("abc") == 0x352441c2`, true},
+		{`hash.checksum32("abc") == 294`, true},
+		{`hash.md5("") == "d41d8cd98f00b204e9800998ecf8427e"`, true},
+
+		{`hash.md5(0, 3) == hash.md5("<?p")`, true},
+		{`hash.sha256(0, filesize) == hash.sha256("<?php eval($_POST['x']); ?>")`, true},
+		{`hash.sha1(6, 4) == hash.sha1("eval")`, true},
+		{`hash.crc32(0, 5) == hash.crc32("<?php")`, true},
+		{`hash.md5(0, filesize) != "900150983cd24fb0d6963f7d28e17f72"`, true},
+
+		// Ranges past the end are truncated; ranges starting outside the
+		// data are undefined.
+		{`hash.md5(20, 100) == hash.md5(20, filesize - 20)`, true},
+		{`hash.md5(filesize, 1) == hash.md5("")`, false},
+		{`hash.md5(-1, 1) == hash.md5("")`, false},
+		{`hash.md5(0, -1) == hash.md5("")`, false},
+		{`hash.md5(0) == hash.md5("")`, false},
+		{`hash.md5(0, 1, 2) == hash.md5("")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, data, opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeCache(t *testing.T) {
+	data := []byte("first")
+	v, err := New().Load(&scanner.ScanContext{Data: data})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	md5 := v["md5"].(scanner.Func)
+	args := []any{int64(0), int64(len(data))}
+	first, _ := md5(args)
+
+	// A cached result does not see the data change; a different range does.
+	copy(data, "other")
+	if again, _ := md5(args); again != first {
+		t.Errorf("md5(0, 5) = %v after change, want cached %v", again, first)
+	}
+	if other, _ := md5([]any{int64(0), int64(4)}); other == first {
+		t.Error("md5(0, 4) returned the cached result of md5(0, 5)")
+	}
+
+	// Every scan loads the module again and starts with an empty cache.
+	v, _ = New().Load(&scanner.ScanContext{Data: data})
+	if fresh, _ := v["md5"].(scanner.Func)(args); fresh == first {
+		t.Error("cache was shared between scans")
+	}
+}
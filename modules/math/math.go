@@ -0,0 +1,361 @@
+// Package math implements the math module, which computes statistics over
+// ranges of the scanned data or over strings:
+//
+//	import "math"
+//
+//	rule packed {
+//	    condition:
+//	        math.entropy(0, filesize) > 7.5
+//	}
+//
+// entropy, mean, deviation, serial_correlation and monte_carlo_pi take
+// either an offset and a size in the scanned data or a single string, and
+// return floats. count, percentage and mode default to the whole data when
+// no range is given. A range that starts outside the data is undefined, and
+// one that extends past its end is truncated, as in YARA. Statistics over
+// no bytes at all are undefined.
+package math
+
+import (
+	stdmath "math"
+	"strconv"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// meanBytes is the mean of uniformly distributed bytes, exposed as
+// math.MEAN_BYTES for use with deviation.
+const meanBytes = 127.5
+
+// Module is the math module.
+type Module struct{}
+
+// New returns the math module, to be passed in
+// scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "math".
+func (m *Module) Name() string { return "math" }
+
+// Load returns the math functions for a scan of sc.Data. Byte histograms
+// of ranges of the data are cached for the scan, so rules computing several
+// statistics over the same range count its bytes once.
+func (m *Module) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	s := &scan{data: sc.Data, hists: make(map[[2]int64]*histogram)}
+	return scanner.Struct{
+		"MEAN_BYTES": meanBytes,
+
+		"entropy":            s.histFunc(entropy),
+		"mean":               s.histFunc(func(h *histogram) any { return h.mean() }),
+		"deviation":          scanner.Func(s.deviation),
+		"serial_correlation": s.bytesFunc(serialCorrelation),
+		"monte_carlo_pi":     s.bytesFunc(monteCarloPi),
+		"count":              scanner.Func(s.count),
+		"percentage":         scanner.Func(s.percentage),
+		"mode":               scanner.Func(s.mode),
+
+		"in_range":  scanner.Func(inRange),
+		"min":       intFunc(2, func(n []int64) any { return min(n[0], n[1]) }),
+		"max":       intFunc(2, func(n []int64) any { return max(n[0], n[1]) }),
+		"abs":       intFunc(1, func(n []int64) any { return max(n[0], -n[0]) }),
+		"to_number": intFunc(1, func(n []int64) any { return n[0] != 0 }),
+		"to_string": scanner.Func(toString),
+	}, nil
+}
+
+type scan struct {
+	data  []byte
+	hists map[[2]int64]*histogram
+}
+
+// histogram counts the occurrences of every byte value.
+type histogram struct {
+	counts [256]int64
+	total  int64
+}
+
+func newHistogram(b []byte) *histogram {
+	h := &histogram{total: int64(len(b))}
+	for _, c := range b {
+		h.counts[c]++
+	}
+	return h
+}
+
+func (h *histogram) mean() float64 {
+	var sum float64
+	for c, n := range h.counts {
+		sum += float64(c) * float64(n)
+	}
+	return sum / float64(h.total)
+}
+
+// span returns the bytes selected by args: a string, or an offset and a
+// size within the scanned data.
+func (s *scan) span(args []any) ([]byte, bool) {
+	switch len(args) {
+	case 1:
+		str, ok := args[0].(string)
+		return []byte(str), ok
+	case 2:
+		offset, ok1 := args[0].(int64)
+		size, ok2 := args[1].(int64)
+		if !ok1 || !ok2 || offset < 0 || offset >= int64(len(s.data)) || size < 0 {
+			return nil, false
+		}
+		return s.data[offset : offset+min(size, int64(len(s.data))-offset)], true
+	default:
+		return nil, false
+	}
+}
+
+// histogram returns the histogram of the bytes selected by args, or of all
+// of the data if args is empty. It is undefined for no bytes.
+func (s *scan) histogram(args []any) (*histogram, bool) {
+	if len(args) == 0 {
+		args = []any{int64(0), int64(len(s.data))}
+	}
+	b, ok := s.span(args)
+	if !ok || len(b) == 0 {
+		return nil, false
+	}
+	if len(args) == 1 {
+		return newHistogram(b), true
+	}
+	key := [2]int64{args[0].(int64), int64(len(b))}
+	h, ok := s.hists[key]
+	if !ok {
+		h = newHistogram(b)
+		s.hists[key] = h
+	}
+	return h, true
+}
+
+// histFunc returns a function computing stat over the histogram of a range
+// or a string.
+func (s *scan) histFunc(stat func(*histogram) any) scanner.Func {
+	return func(args []any) (any, bool) {
+		if len(args) == 0 {
+			return nil, false
+		}
+		h, ok := s.histogram(args)
+		if !ok {
+			return nil, false
+		}
+		return stat(h), true
+	}
+}
+
+// bytesFunc returns a function computing stat over the bytes of a range or
+// a string.
+func (s *scan) bytesFunc(stat func([]byte) (float64, bool)) scanner.Func {
+	return func(args []any) (any, bool) {
+		b, ok := s.span(args)
+		if !ok || len(b) == 0 {
+			return nil, false
+		}
+		return stat(b)
+	}
+}
+
+// entropy returns the Shannon entropy in bits per byte, from 0 to 8.
+func entropy(h *histogram) any {
+	var e float64
+	for _, n := range h.counts {
+		if n > 0 {
+			p := float64(n) / float64(h.total)
+			e -= p * stdmath.Log2(p)
+		}
+	}
+	return e
+}
+
+// deviation implements deviation(offset, size, mean) and
+// deviation(string, mean): the mean absolute deviation from mean.
+func (s *scan) deviation(args []any) (any, bool) {
+	if len(args) < 2 {
+		return nil, false
+	}
+	mean, ok := toFloat(args[len(args)-1])
+	if !ok {
+		return nil, false
+	}
+	h, ok := s.histogram(args[:len(args)-1])
+	if !ok {
+		return nil, false
+	}
+	var sum float64
+	for c, n := range h.counts {
+		sum += stdmath.Abs(float64(c)-mean) * float64(n)
+	}
+	return sum / float64(h.total), true
+}
+
+// count implements count(byte) and count(byte, offset, size).
+func (s *scan) count(args []any) (any, bool) {
+	c, h, ok := s.byteHistogram(args)
+	if !ok {
+		return nil, false
+	}
+	return h.counts[c], true
+}
+
+// percentage implements percentage(byte) and percentage(byte, offset,
+// size): the fraction of the bytes equal to byte, from 0 to 1.
+func (s *scan) percentage(args []any) (any, bool) {
+	c, h, ok := s.byteHistogram(args)
+	if !ok {
+		return nil, false
+	}
+	return float64(h.counts[c]) / float64(h.total), true
+}
+
+// byteHistogram parses the byte and optional range arguments of count and
+// percentage.
+func (s *scan) byteHistogram(args []any) (byte, *histogram, bool) {
+	if len(args) != 1 && len(args) != 3 {
+		return 0, nil, false
+	}
+	c, ok := args[0].(int64)
+	if !ok || c < 0 || c > 255 {
+		return 0, nil, false
+	}
+	h, ok := s.histogram(args[1:])
+	return byte(c), h, ok
+}
+
+// mode implements mode() and mode(offset, size): the most common byte,
+// the lowest one on a tie.
+func (s *scan) mode(args []any) (any, bool) {
+	if len(args) != 0 && len(args) != 2 {
+		return nil, false
+	}
+	h, ok := s.histogram(args)
+	if !ok {
+		return nil, false
+	}
+	mode := 0
+	for c, n := range h.counts {
+		if n > h.counts[mode] {
+			mode = c
+		}
+	}
+	return mode, true
+}
+
+// serialCorrelation returns how much each byte depends on the previous
+// one, from -1 to 1, computed as by the ent tool. Data whose bytes are all
+// equal yields -100000.
+func serialCorrelation(b []byte) (float64, bool) {
+	var t1, t2, t3, last float64
+	for _, c := range b {
+		u := float64(c)
+		t1 += last * u
+		t2 += u
+		t3 += u * u
+		last = u
+	}
+	t1 += last * float64(b[0])
+	t2 *= t2
+	n := float64(len(b))
+	d := n*t3 - t2
+	if d == 0 {
+		return -100000, true
+	}
+	return (n*t1 - t2) / d, true
+}
+
+// monteCarloPi returns the relative error of the approximation of pi the
+// ent tool derives from the data, treating each 6 bytes as a point in a
+// square. Random data yields values near 0. It is undefined for fewer than
+// 6 bytes.
+func monteCarloPi(b []byte) (float64, bool) {
+	const points = 6
+	inCircle := stdmath.Pow(stdmath.Pow(256, points/2)-1, 2)
+	var hits, total int
+	for ; len(b) >= points; b = b[points:] {
+		var x, y float64
+		for j := range points / 2 {
+			x = x*256 + float64(b[j])
+			y = y*256 + float64(b[j+points/2])
+		}
+		if x*x+y*y <= inCircle {
+			hits++
+		}
+		total++
+	}
+	if total == 0 {
+		return 0, false
+	}
+	pi := 4 * float64(hits) / float64(total)
+	return stdmath.Abs((pi - stdmath.Pi) / stdmath.Pi), true
+}
+
+// inRange implements in_range(test, lower, upper).
+func inRange(args []any) (any, bool) {
+	if len(args) != 3 {
+		return nil, false
+	}
+	var f [3]float64
+	for i, arg := range args {
+		var ok bool
+		if f[i], ok = toFloat(arg); !ok {
+			return nil, false
+		}
+	}
+	return f[1] <= f[0] && f[0] <= f[2], true
+}
+
+// toString implements to_string(n) and to_string(n, base) for bases 8, 10
+// and 16.
+func toString(args []any) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, false
+	}
+	n, ok := args[0].(int64)
+	if !ok {
+		return nil, false
+	}
+	base := int64(10)
+	if len(args) == 2 {
+		if base, ok = args[1].(int64); !ok {
+			return nil, false
+		}
+	}
+	switch base {
+	case 8, 10, 16:
+		return strconv.FormatInt(n, int(base)), true
+	default:
+		return nil, false
+	}
+}
+
+// intFunc returns a function taking exactly n integer arguments.
+func intFunc(n int, fn func([]int64) any) scanner.Func {
+	return func(args []any) (any, bool) {
+		if len(args) != n {
+			return nil, false
+		}
+		ints := make([]int64, n)
+		for i, arg := range args {
+			var ok bool
+			if ints[i], ok = arg.(int64); !ok {
+				return nil, false
+			}
+		}
+		return fn(ints), true
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,104 @@
+package math
+
+import (
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+var opts = scanner.CompileOptions{Modules: []scanner.Module{New()}}
+
+func TestConditions(t *testing.T) {
+	data := []byte("AAAABBCD")
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`math.entropy("AAAA") == 0`, true},
+		{`math.entropy("AB") == 1.0`, true},
+		{`math.entropy(0, filesize) == 1.75`, true},
+		{`math.entropy(0, 4) == 0`, true},
+		{`math.entropy(4, 100) == math.entropy("BBCD")`, true},
+		{`math.entropy(0, filesize) > 7.5`, false},
+		{`math.mean(0, 4) == 65`, true},
+		{`math.mean("ABC") == 66.0`, true},
+		{`math.deviation("ABC", 66) > 0.66 and math.deviation("ABC", 66) < 0.67`, true},
+		{`math.deviation(0, 4, math.MEAN_BYTES) == 62.5`, true},
+		{`math.MEAN_BYTES == 127.5`, true},
+		{`math.serial_correlation("\x00\xff\x00\xff") == -1`, true},
+		{`math.serial_correlation("AAAA") == -100000`, true},
+		{`math.monte_carlo_pi("\x00\x00\x00\x00\x00\x00") > 0.27 and math.monte_carlo_pi("\x00\x00\x00\x00\x00\x00") < 0.28`, true},
+		{`math.count(0x41) == 4`, true},
+		{`math.count(0x42, 4, 2) == 2`, true},
+		{`math.percentage(0x41) == 0.5`, true},
+		{`math.percentage(0x44, 6, 2) == 0.5`, true},
+		{`math.mode() == 0x41`, true},
+		{`math.mode(4, 4) == 0x42`, true},
+		{`math.in_range(math.entropy(0, filesize), 1.5, 2)`, true},
+		{`math.in_range(3, 1, 2)`, false},
+		{`math.min(3, filesize) == 3 and math.max(3, filesize) == 8`, true},
+		{`math.abs(-3) == 3 and math.abs(3) == 3`, true},
+		{`math.to_number(filesize > 1) + math.to_number(filesize > 100) == 1`, true},
+		{`math.to_string(255) == "255" and math.to_string(255, 16) == "ff"`, true},
+
+		// Empty, out-of-range and malformed inputs are undefined.
+		{`math.entropy("") >= 0`, false},
+		{`math.entropy(filesize, 1) >= 0`, false},
+		{`math.entropy(-1, 1) >= 0`, false},
+		{`math.entropy(0, -1) >= 0`, false},
+		{`math.entropy(0) >= 0`, false},
+		{`math.monte_carlo_pi("12345") >= 0`, false},
+		{`math.count(256) >= 0`, false},
+		{`math.count(0x41, 0) >= 0`, false},
+		{`math.to_string(255, 2) == "11111111"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, data, opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntropyOfUniformData(t *testing.T) {
+	data := make([]byte, 256*4)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	v, err := New().Load(&scanner.ScanContext{Data: data})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got, _ := v["entropy"].(scanner.Func)([]any{int64(0), int64(len(data))}); got != 8.0 {
+		t.Errorf("entropy = %v, want 8", got)
+	}
+	if got, _ := v["mean"].(scanner.Func)([]any{int64(0), int64(len(data))}); got != meanBytes {
+		t.Errorf("mean = %v, want %v", got, meanBytes)
+	}
+}
+
+func TestHistogramCache(t *testing.T) {
+	data := []byte("AAAA")
+	v, err := New().Load(&scanner.ScanContext{Data: data})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	entropy := v["entropy"].(scanner.Func)
+	mean := v["mean"].(scanner.Func)
+	args := []any{int64(0), int64(len(data))}
+	entropy(args)
+
+	// Statistics over a counted range do not see the data change; a
+	// different range does.
+	copy(data, "ABCD")
+	if got, _ := mean(args); got != 65.0 {
+		t.Errorf("mean(0, 4) = %v after change, want cached 65", got)
+	}
+	if got, _ := mean([]any{int64(0), int64(2)}); got != 65.5 {
+		t.Errorf("mean(0, 2) = %v, want 65.5", got)
+	}
+}
@@ -0,0 +1,133 @@
+package pe
+
+import (
+	debugpe "debug/pe"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// constants are the named values rules compare fields against, as in
+// pe.machine == pe.MACHINE_AMD64. They are defined for any scanned data.
+var constants = scanner.Struct{
+	"MACHINE_UNKNOWN":   debugpe.IMAGE_FILE_MACHINE_UNKNOWN,
+	"MACHINE_AM33":      debugpe.IMAGE_FILE_MACHINE_AM33,
+	"MACHINE_AMD64":     debugpe.IMAGE_FILE_MACHINE_AMD64,
+	"MACHINE_ARM":       debugpe.IMAGE_FILE_MACHINE_ARM,
+	"MACHINE_ARMNT":     debugpe.IMAGE_FILE_MACHINE_ARMNT,
+	"MACHINE_ARM64":     debugpe.IMAGE_FILE_MACHINE_ARM64,
+	"MACHINE_EBC":       debugpe.IMAGE_FILE_MACHINE_EBC,
+	"MACHINE_I386":      debugpe.IMAGE_FILE_MACHINE_I386,
+	"MACHINE_IA64":      debugpe.IMAGE_FILE_MACHINE_IA64,
+	"MACHINE_M32R":      debugpe.IMAGE_FILE_MACHINE_M32R,
+	"MACHINE_MIPS16":    debugpe.IMAGE_FILE_MACHINE_MIPS16,
+	"MACHINE_MIPSFPU":   debugpe.IMAGE_FILE_MACHINE_MIPSFPU,
+	"MACHINE_MIPSFPU16": debugpe.IMAGE_FILE_MACHINE_MIPSFPU16,
+	"MACHINE_POWERPC":   debugpe.IMAGE_FILE_MACHINE_POWERPC,
+	"MACHINE_POWERPCFP": debugpe.IMAGE_FILE_MACHINE_POWERPCFP,
+	"MACHINE_R4000":     debugpe.IMAGE_FILE_MACHINE_R4000,
+	"MACHINE_SH3":       debugpe.IMAGE_FILE_MACHINE_SH3,
+	"MACHINE_SH3DSP":    debugpe.IMAGE_FILE_MACHINE_SH3DSP,
+	"MACHINE_SH4":       debugpe.IMAGE_FILE_MACHINE_SH4,
+	"MACHINE_SH5":       debugpe.IMAGE_FILE_MACHINE_SH5,
+	"MACHINE_THUMB":     debugpe.IMAGE_FILE_MACHINE_THUMB,
+	"MACHINE_WCEMIPSV2": debugpe.IMAGE_FILE_MACHINE_WCEMIPSV2,
+	"MACHINE_RISCV32":   debugpe.IMAGE_FILE_MACHINE_RISCV32,
+	"MACHINE_RISCV64":   debugpe.IMAGE_FILE_MACHINE_RISCV64,
+
+	"SUBSYSTEM_UNKNOWN":                  debugpe.IMAGE_SUBSYSTEM_UNKNOWN,
+	"SUBSYSTEM_NATIVE":                   debugpe.IMAGE_SUBSYSTEM_NATIVE,
+	"SUBSYSTEM_WINDOWS_GUI":              debugpe.IMAGE_SUBSYSTEM_WINDOWS_GUI,
+	"SUBSYSTEM_WINDOWS_CUI":              debugpe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+	"SUBSYSTEM_OS2_CUI":                  debugpe.IMAGE_SUBSYSTEM_OS2_CUI,
+	"SUBSYSTEM_POSIX_CUI":                debugpe.IMAGE_SUBSYSTEM_POSIX_CUI,
+	"SUBSYSTEM_NATIVE_WINDOWS":           debugpe.IMAGE_SUBSYSTEM_NATIVE_WINDOWS,
+	"SUBSYSTEM_WINDOWS_CE_GUI":           debugpe.IMAGE_SUBSYSTEM_WINDOWS_CE_GUI,
+	"SUBSYSTEM_EFI_APPLICATION":          debugpe.IMAGE_SUBSYSTEM_EFI_APPLICATION,
+	"SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER":  debugpe.IMAGE_SUBSYSTEM_EFI_BOOT_SERVICE_DRIVER,
+	"SUBSYSTEM_EFI_RUNTIME_DRIVER":       debugpe.IMAGE_SUBSYSTEM_EFI_RUNTIME_DRIVER,
+	"SUBSYSTEM_EFI_ROM_IMAGE":            debugpe.IMAGE_SUBSYSTEM_EFI_ROM,
+	"SUBSYSTEM_XBOX":                     debugpe.IMAGE_SUBSYSTEM_XBOX,
+	"SUBSYSTEM_WINDOWS_BOOT_APPLICATION": debugpe.IMAGE_SUBSYSTEM_WINDOWS_BOOT_APPLICATION,
+
+	"RELOCS_STRIPPED":         debugpe.IMAGE_FILE_RELOCS_STRIPPED,
+	"EXECUTABLE_IMAGE":        debugpe.IMAGE_FILE_EXECUTABLE_IMAGE,
+	"LINE_NUMS_STRIPPED":      debugpe.IMAGE_FILE_LINE_NUMS_STRIPPED,
+	"LOCAL_SYMS_STRIPPED":     debugpe.IMAGE_FILE_LOCAL_SYMS_STRIPPED,
+	"AGGRESIVE_WS_TRIM":       debugpe.IMAGE_FILE_AGGRESIVE_WS_TRIM,
+	"LARGE_ADDRESS_AWARE":     debugpe.IMAGE_FILE_LARGE_ADDRESS_AWARE,
+	"BYTES_REVERSED_LO":       debugpe.IMAGE_FILE_BYTES_REVERSED_LO,
+	"MACHINE_32BIT":           debugpe.IMAGE_FILE_32BIT_MACHINE,
+	"DEBUG_STRIPPED":          debugpe.IMAGE_FILE_DEBUG_STRIPPED,
+	"REMOVABLE_RUN_FROM_SWAP": debugpe.IMAGE_FILE_REMOVABLE_RUN_FROM_SWAP,
+	"NET_RUN_FROM_SWAP":       debugpe.IMAGE_FILE_NET_RUN_FROM_SWAP,
+	"SYSTEM":                  debugpe.IMAGE_FILE_SYSTEM,
+	"DLL":                     debugpe.IMAGE_FILE_DLL,
+	"UP_SYSTEM_ONLY":          debugpe.IMAGE_FILE_UP_SYSTEM_ONLY,
+	"BYTES_REVERSED_HI":       debugpe.IMAGE_FILE_BYTES_REVERSED_HI,
+
+	"HIGH_ENTROPY_VA":       debugpe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA,
+	"DYNAMIC_BASE":          debugpe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE,
+	"FORCE_INTEGRITY":       debugpe.IMAGE_DLLCHARACTERISTICS_FORCE_INTEGRITY,
+	"NX_COMPAT":             debugpe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT,
+	"NO_ISOLATION":          debugpe.IMAGE_DLLCHARACTERISTICS_NO_ISOLATION,
+	"NO_SEH":                debugpe.IMAGE_DLLCHARACTERISTICS_NO_SEH,
+	"NO_BIND":               debugpe.IMAGE_DLLCHARACTERISTICS_NO_BIND,
+	"APPCONTAINER":          debugpe.IMAGE_DLLCHARACTERISTICS_APPCONTAINER,
+	"WDM_DRIVER":            debugpe.IMAGE_DLLCHARACTERISTICS_WDM_DRIVER,
+	"GUARD_CF":              debugpe.IMAGE_DLLCHARACTERISTICS_GUARD_CF,
+	"TERMINAL_SERVER_AWARE": debugpe.IMAGE_DLLCHARACTERISTICS_TERMINAL_SERVER_AWARE,
+
+	"SECTION_CNT_CODE":               debugpe.IMAGE_SCN_CNT_CODE,
+	"SECTION_CNT_INITIALIZED_DATA":   debugpe.IMAGE_SCN_CNT_INITIALIZED_DATA,
+	"SECTION_CNT_UNINITIALIZED_DATA": debugpe.IMAGE_SCN_CNT_UNINITIALIZED_DATA,
+	"SECTION_LNK_COMDAT":             debugpe.IMAGE_SCN_LNK_COMDAT,
+	"SECTION_MEM_DISCARDABLE":        debugpe.IMAGE_SCN_MEM_DISCARDABLE,
+	"SECTION_MEM_EXECUTE":            debugpe.IMAGE_SCN_MEM_EXECUTE,
+	"SECTION_MEM_READ":               debugpe.IMAGE_SCN_MEM_READ,
+	"SECTION_MEM_WRITE":              debugpe.IMAGE_SCN_MEM_WRITE,
+	"SECTION_MEM_NOT_CACHED":         0x04000000,
+	"SECTION_MEM_NOT_PAGED":          0x08000000,
+	"SECTION_MEM_SHARED":             0x10000000,
+
+	"IMAGE_DIRECTORY_ENTRY_EXPORT":         debugpe.IMAGE_DIRECTORY_ENTRY_EXPORT,
+	"IMAGE_DIRECTORY_ENTRY_IMPORT":         debugpe.IMAGE_DIRECTORY_ENTRY_IMPORT,
+	"IMAGE_DIRECTORY_ENTRY_RESOURCE":       debugpe.IMAGE_DIRECTORY_ENTRY_RESOURCE,
+	"IMAGE_DIRECTORY_ENTRY_EXCEPTION":      debugpe.IMAGE_DIRECTORY_ENTRY_EXCEPTION,
+	"IMAGE_DIRECTORY_ENTRY_SECURITY":       debugpe.IMAGE_DIRECTORY_ENTRY_SECURITY,
+	"IMAGE_DIRECTORY_ENTRY_BASERELOC":      debugpe.IMAGE_DIRECTORY_ENTRY_BASERELOC,
+	"IMAGE_DIRECTORY_ENTRY_DEBUG":          debugpe.IMAGE_DIRECTORY_ENTRY_DEBUG,
+	"IMAGE_DIRECTORY_ENTRY_ARCHITECTURE":   debugpe.IMAGE_DIRECTORY_ENTRY_ARCHITECTURE,
+	"IMAGE_DIRECTORY_ENTRY_GLOBALPTR":      debugpe.IMAGE_DIRECTORY_ENTRY_GLOBALPTR,
+	"IMAGE_DIRECTORY_ENTRY_TLS":            debugpe.IMAGE_DIRECTORY_ENTRY_TLS,
+	"IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG":    debugpe.IMAGE_DIRECTORY_ENTRY_LOAD_CONFIG,
+	"IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT":   debugpe.IMAGE_DIRECTORY_ENTRY_BOUND_IMPORT,
+	"IMAGE_DIRECTORY_ENTRY_IAT":            debugpe.IMAGE_DIRECTORY_ENTRY_IAT,
+	"IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT":   debugpe.IMAGE_DIRECTORY_ENTRY_DELAY_IMPORT,
+	"IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR": debugpe.IMAGE_DIRECTORY_ENTRY_COM_DESCRIPTOR,
+
+	"IMAGE_NT_OPTIONAL_HDR32_MAGIC": 0x10b,
+	"IMAGE_NT_OPTIONAL_HDR64_MAGIC": 0x20b,
+	"IMAGE_ROM_OPTIONAL_HDR_MAGIC":  0x107,
+
+	"RESOURCE_TYPE_CURSOR":       1,
+	"RESOURCE_TYPE_BITMAP":       2,
+	"RESOURCE_TYPE_ICON":         3,
+	"RESOURCE_TYPE_MENU":         4,
+	"RESOURCE_TYPE_DIALOG":       5,
+	"RESOURCE_TYPE_STRING":       6,
+	"RESOURCE_TYPE_FONTDIR":      7,
+	"RESOURCE_TYPE_FONT":         8,
+	"RESOURCE_TYPE_ACCELERATOR":  9,
+	"RESOURCE_TYPE_RCDATA":       10,
+	"RESOURCE_TYPE_MESSAGETABLE": 11,
+	"RESOURCE_TYPE_GROUP_CURSOR": 12,
+	"RESOURCE_TYPE_GROUP_ICON":   14,
+	"RESOURCE_TYPE_VERSION":      16,
+	"RESOURCE_TYPE_DLGINCLUDE":   17,
+	"RESOURCE_TYPE_PLUGPLAY":     19,
+	"RESOURCE_TYPE_VXD":          20,
+	"RESOURCE_TYPE_ANICURSOR":    21,
+	"RESOURCE_TYPE_ANIICON":      22,
+	"RESOURCE_TYPE_HTML":         23,
+	"RESOURCE_TYPE_MANIFEST":     24,
+}
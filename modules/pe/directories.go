@@ -0,0 +1,466 @@
+package pe
+
+import (
+	"crypto/md5"
+	debugpe "debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Limits on what is read from the directories, so malformed files with
+// absurd counts cannot make a scan allocate or loop without bound.
+const (
+	maxImportedLibs    = 4096
+	maxImportedFuncs   = 16384
+	maxExports         = 65536
+	maxResources       = 4096
+	maxResourceEntries = 16384 // directory entries, including those of empty directories
+	maxNameLength      = 1024
+)
+
+type importedLib struct {
+	name  string
+	funcs []importedFunc
+}
+
+// importedFunc is imported either by name or, when name is empty, by
+// ordinal.
+type importedFunc struct {
+	name    string
+	ordinal uint16
+}
+
+type exportedFunc struct {
+	name    string
+	ordinal uint32
+	rva     uint32
+	forward string
+}
+
+type resource struct {
+	typ, name, lang       uint32
+	typString, nameString string
+	langString            string
+	rva, length           uint32
+	hasTypeID, hasNameID  bool
+	hasLangID             bool
+}
+
+// dir returns the file offset and size of a data directory, or false if
+// the directory is absent or outside the file.
+func (f *file) dir(index int) (int64, uint32, bool) {
+	if index >= len(f.dirs) || f.dirs[index].VirtualAddress == 0 {
+		return 0, 0, false
+	}
+	off, ok := f.rvaToOffset(f.dirs[index].VirtualAddress)
+	return off, f.dirs[index].Size, ok
+}
+
+func (f *file) u16(off int64) (uint16, bool) {
+	if off < 0 || off+2 > int64(len(f.data)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint16(f.data[off:]), true
+}
+
+func (f *file) u32(off int64) (uint32, bool) {
+	if off < 0 || off+4 > int64(len(f.data)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(f.data[off:]), true
+}
+
+func (f *file) u64(off int64) (uint64, bool) {
+	if off < 0 || off+8 > int64(len(f.data)) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint64(f.data[off:]), true
+}
+
+// cstring reads the NUL-terminated string at rva.
+func (f *file) cstring(rva uint32) (string, bool) {
+	off, ok := f.rvaToOffset(rva)
+	if !ok {
+		return "", false
+	}
+	b := f.data[off:min(int64(len(f.data)), off+maxNameLength)]
+	n := strings.IndexByte(string(b), 0)
+	if n < 0 {
+		return "", false
+	}
+	return string(b[:n]), true
+}
+
+func (f *file) imports(v scanner.Struct) {
+	off, _, ok := f.dir(debugpe.IMAGE_DIRECTORY_ENTRY_IMPORT)
+	if ok {
+		f.libs = f.readImports(off)
+	}
+	details := make(scanner.Array, len(f.libs))
+	funcs := 0
+	for i, lib := range f.libs {
+		fns := make(scanner.Array, len(lib.funcs))
+		for j, fn := range lib.funcs {
+			if fn.name != "" {
+				fns[j] = scanner.Struct{"name": fn.name}
+			} else {
+				fns[j] = scanner.Struct{"ordinal": fn.ordinal}
+			}
+		}
+		details[i] = scanner.Struct{
+			"library_name":        lib.name,
+			"number_of_functions": len(lib.funcs),
+			"functions":           fns,
+		}
+		funcs += len(lib.funcs)
+	}
+	v["number_of_imports"] = len(f.libs)
+	v["number_of_imported_functions"] = funcs
+	v["import_details"] = details
+}
+
+// readImports reads the import descriptors at off, up to the terminating
+// all-zero descriptor.
+func (f *file) readImports(off int64) []importedLib {
+	var libs []importedLib
+	for ; len(libs) < maxImportedLibs; off += 20 {
+		lookup, ok1 := f.u32(off)
+		nameRVA, ok2 := f.u32(off + 12)
+		thunks, ok3 := f.u32(off + 16)
+		if !ok1 || !ok2 || !ok3 || nameRVA == 0 {
+			break
+		}
+		name, ok := f.cstring(nameRVA)
+		if !ok || name == "" {
+			continue
+		}
+		// Bound linkers leave only the import address table.
+		if lookup == 0 {
+			lookup = thunks
+		}
+		libs = append(libs, importedLib{name: name, funcs: f.readThunks(lookup)})
+	}
+	return libs
+}
+
+func (f *file) readThunks(rva uint32) []importedFunc {
+	off, ok := f.rvaToOffset(rva)
+	if !ok {
+		return nil
+	}
+	size, ordinalFlag := int64(4), uint64(1)<<31
+	if f.is64 {
+		size, ordinalFlag = 8, 1<<63
+	}
+	var funcs []importedFunc
+	for ; len(funcs) < maxImportedFuncs; off += size {
+		var thunk uint64
+		if f.is64 {
+			thunk, ok = f.u64(off)
+		} else {
+			var t uint32
+			t, ok = f.u32(off)
+			thunk = uint64(t)
+		}
+		if !ok || thunk == 0 {
+			break
+		}
+		if thunk&ordinalFlag != 0 {
+			funcs = append(funcs, importedFunc{ordinal: uint16(thunk)})
+			continue
+		}
+		// Skip the hint preceding the name.
+		if name, ok := f.cstring(uint32(thunk) + 2); ok && name != "" {
+			funcs = append(funcs, importedFunc{name: name})
+		}
+	}
+	return funcs
+}
+
+func (f *file) importsFunc(args []any) (any, bool) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, false
+	}
+	dll, ok := args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	count := 0
+	for _, lib := range f.libs {
+		if !strings.EqualFold(lib.name, dll) {
+			continue
+		}
+		if len(args) == 1 {
+			count += len(lib.funcs)
+			continue
+		}
+		for _, fn := range lib.funcs {
+			switch want := args[1].(type) {
+			case string:
+				if fn.name != "" && strings.EqualFold(fn.name, want) {
+					return true, true
+				}
+			case int64:
+				if fn.name == "" && int64(fn.ordinal) == want {
+					return true, true
+				}
+			}
+		}
+	}
+	if len(args) == 1 {
+		return count, true
+	}
+	return false, true
+}
+
+// imphash returns the import hash popularised by Mandiant: the MD5 of the
+// comma-separated, lower-cased "library.function" pairs in import order,
+// with .dll, .ocx and .sys stripped from library names. Functions imported
+// by ordinal are written as "ordN". Unlike pefile, ordinals of ws2_32,
+// wsock32 and oleaut32 are not resolved to names.
+func (f *file) imphash() string {
+	var parts []string
+	for _, lib := range f.libs {
+		name := strings.ToLower(lib.name)
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			switch name[i+1:] {
+			case "dll", "ocx", "sys":
+				name = name[:i]
+			}
+		}
+		for _, fn := range lib.funcs {
+			fname := strings.ToLower(fn.name)
+			if fn.name == "" {
+				fname = "ord" + strconv.Itoa(int(fn.ordinal))
+			}
+			parts = append(parts, name+"."+fname)
+		}
+	}
+	sum := md5.Sum([]byte(strings.Join(parts, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *file) exports(v scanner.Struct) {
+	off, size, ok := f.dir(debugpe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if !ok {
+		v["number_of_exports"] = 0
+		return
+	}
+	timestamp, _ := f.u32(off + 4)
+	nameRVA, _ := f.u32(off + 12)
+	base, _ := f.u32(off + 16)
+	numFuncs, _ := f.u32(off + 20)
+	numNames, _ := f.u32(off + 24)
+	funcsRVA, _ := f.u32(off + 28)
+	namesRVA, _ := f.u32(off + 32)
+	ordinalsRVA, _ := f.u32(off + 36)
+
+	if name, ok := f.cstring(nameRVA); ok {
+		v["dll_name"] = name
+	}
+	v["export_timestamp"] = timestamp
+
+	numFuncs = min(numFuncs, maxExports)
+	names := make(map[uint32]string, min(numNames, maxExports))
+	namesOff, ok1 := f.rvaToOffset(namesRVA)
+	ordinalsOff, ok2 := f.rvaToOffset(ordinalsRVA)
+	for i := int64(0); ok1 && ok2 && i < int64(min(numNames, maxExports)); i++ {
+		rva, ok := f.u32(namesOff + 4*i)
+		index, ok2 := f.u16(ordinalsOff + 2*i)
+		if !ok || !ok2 {
+			break
+		}
+		if name, ok := f.cstring(rva); ok {
+			names[uint32(index)] = name
+		}
+	}
+
+	funcsOff, ok := f.rvaToOffset(funcsRVA)
+	dirRVA := f.dirs[debugpe.IMAGE_DIRECTORY_ENTRY_EXPORT].VirtualAddress
+	for i := uint32(0); ok && i < numFuncs; i++ {
+		rva, ok := f.u32(funcsOff + 4*int64(i))
+		if !ok {
+			break
+		}
+		if rva == 0 {
+			continue
+		}
+		fn := exportedFunc{name: names[i], ordinal: base + i, rva: rva}
+		// Addresses inside the export directory name a forwarded export.
+		if rva >= dirRVA && rva-dirRVA < size {
+			fn.forward, _ = f.cstring(rva)
+		}
+		f.exported = append(f.exported, fn)
+	}
+
+	details := make(scanner.Array, len(f.exported))
+	for i, fn := range f.exported {
+		d := scanner.Struct{"ordinal": fn.ordinal}
+		if fn.name != "" {
+			d["name"] = fn.name
+		}
+		if fn.forward != "" {
+			d["forward_name"] = fn.forward
+		} else if off, ok := f.rvaToOffset(fn.rva); ok {
+			d["offset"] = off
+		}
+		details[i] = d
+	}
+	v["number_of_exports"] = len(f.exported)
+	v["export_details"] = details
+}
+
+// exportIndex returns the index in export_details of the function exported
+// under the name or ordinal in args.
+func (f *file) exportIndex(args []any) (any, bool) {
+	if len(args) != 1 {
+		return nil, false
+	}
+	for i, fn := range f.exported {
+		switch want := args[0].(type) {
+		case string:
+			if fn.name != "" && strings.EqualFold(fn.name, want) {
+				return i, true
+			}
+		case int64:
+			if int64(fn.ordinal) == want {
+				return i, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (f *file) resources(v scanner.Struct) {
+	off, _, ok := f.dir(debugpe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if !ok {
+		v["number_of_resources"] = 0
+		return
+	}
+	if timestamp, ok := f.u32(off + 4); ok {
+		v["resource_timestamp"] = timestamp
+	}
+	major, _ := f.u16(off + 8)
+	minor, _ := f.u16(off + 10)
+	v["resource_version"] = version(major, minor)
+
+	w := resourceWalker{f: f, base: off, visited: make(map[int64]bool)}
+	w.walk(off, 0, &resource{})
+
+	list := make(scanner.Array, len(f.res))
+	for i, r := range f.res {
+		s := scanner.Struct{"rva": r.rva, "length": r.length}
+		if off, ok := f.rvaToOffset(r.rva); ok {
+			s["offset"] = off
+		}
+		if r.hasTypeID {
+			s["type"] = r.typ
+		} else {
+			s["type_string"] = r.typString
+		}
+		if r.hasNameID {
+			s["id"] = r.name
+		} else {
+			s["name_string"] = r.nameString
+		}
+		if r.hasLangID {
+			s["language"] = r.lang
+		} else {
+			s["language_string"] = r.langString
+		}
+		list[i] = s
+	}
+	v["number_of_resources"] = len(f.res)
+	v["resources"] = list
+}
+
+// resourceWalker reads the resource tree of a file into f.res.
+type resourceWalker struct {
+	f       *file
+	base    int64          // offset of the root, which offsets inside the tree are relative to
+	visited map[int64]bool // offsets of the directories read, to stop at cycles
+	entries int            // entries read, up to maxResourceEntries
+}
+
+// walk reads the resource directory at off. The tree has three levels,
+// type, name and language; r accumulates the entries leading to the
+// current directory.
+func (w *resourceWalker) walk(off int64, depth int, r *resource) {
+	f := w.f
+	if w.visited[off] {
+		return
+	}
+	w.visited[off] = true
+	named, ok1 := f.u16(off + 12)
+	ids, ok2 := f.u16(off + 14)
+	if !ok1 || !ok2 {
+		return
+	}
+	for i := int64(0); i < int64(named)+int64(ids) && len(f.res) < maxResources; i++ {
+		if w.entries++; w.entries > maxResourceEntries {
+			return
+		}
+		entry := off + 16 + 8*i
+		id, ok1 := f.u32(entry)
+		target, ok2 := f.u32(entry + 4)
+		if !ok1 || !ok2 {
+			return
+		}
+		var str string
+		isID := id&0x80000000 == 0
+		if !isID {
+			str = f.resourceString(w.base + int64(id&0x7fffffff))
+		}
+		switch depth {
+		case 0:
+			r.typ, r.typString, r.hasTypeID = id, str, isID
+		case 1:
+			r.name, r.nameString, r.hasNameID = id, str, isID
+		case 2:
+			r.lang, r.langString, r.hasLangID = id, str, isID
+		}
+
+		if target&0x80000000 != 0 {
+			// Deeper trees are malformed.
+			if depth < 2 {
+				w.walk(w.base+int64(target&0x7fffffff), depth+1, r)
+			}
+			continue
+		}
+		if depth != 2 {
+			continue
+		}
+		rva, ok1 := f.u32(w.base + int64(target))
+		length, ok2 := f.u32(w.base + int64(target) + 4)
+		if ok1 && ok2 {
+			res := *r
+			res.rva, res.length = rva, length
+			f.res = append(f.res, res)
+		}
+	}
+}
+
+// resourceString reads a length-prefixed UTF-16 name from the resource
+// directory. Like YARA, it returns the raw UTF-16LE bytes.
+func (f *file) resourceString(off int64) string {
+	n, ok := f.u16(off)
+	if !ok || off+2+2*int64(n) > int64(len(f.data)) {
+		return ""
+	}
+	return string(f.data[off+2 : off+2+2*int64(n)])
+}
+
+// hasLanguage reports whether any resource has a language ID for which
+// match returns true.
+func (f *file) hasLanguage(match func(id uint32) bool) bool {
+	for _, r := range f.res {
+		if r.hasLangID && match(r.lang) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+// Package pe implements the pe module, which exposes the headers, sections,
+// imports, exports and resources of Windows PE files to rule conditions:
+//
+//	import "pe"
+//
+//	rule dropper {
+//	    condition:
+//	        pe.is_dll() and pe.imports("kernel32.dll", "VirtualAlloc")
+//	}
+//
+// Field names follow YARA's pe module. Data that is not a PE file only
+// defines is_pe, which is 0, and the constants.
+package pe
+
+import (
+	"bytes"
+	debugpe "debug/pe"
+	"encoding/binary"
+	"maps"
+	"strings"
+
+	"github.com/sansecio/yargo/internal/exe"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Module is the pe module.
+type Module struct{}
+
+// New returns the pe module, to be passed in scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "pe".
+func (m *Module) Name() string { return "pe" }
+
+// Load parses the scanned data as a PE file. Malformed files are not an
+// error: whatever could be parsed is returned and the rest is undefined.
+func (m *Module) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	v := make(scanner.Struct, len(constants)+64)
+	maps.Copy(v, constants)
+	f := parse(sc.Data)
+	if f == nil {
+		v["is_pe"] = false
+		return v, nil
+	}
+	v["is_pe"] = true
+	f.headers(v)
+	f.imports(v)
+	f.exports(v)
+	f.resources(v)
+	f.functions(v)
+	return v, nil
+}
+
+// file is a parsed PE file.
+type file struct {
+	data     []byte
+	pe       *debugpe.File
+	is64     bool
+	dirs     []debugpe.DataDirectory
+	sections []*debugpe.Section
+	mapping  []exe.Section // the sections, for mapping addresses
+
+	// sectionTable is the file offset of the section headers.
+	sectionTable int
+
+	libs     []importedLib
+	exported []exportedFunc
+	res      []resource
+}
+
+// parse returns the PE file in data, or nil if data is not a PE file.
+func parse(data []byte) (f *file) {
+	if len(data) < 0x40 || data[0] != 'M' || data[1] != 'Z' {
+		return nil
+	}
+	lfanew := int(binary.LittleEndian.Uint32(data[0x3c:]))
+	if lfanew < 0 || lfanew > len(data)-4 || string(data[lfanew:lfanew+4]) != "PE\x00\x00" {
+		return nil
+	}
+
+	// debug/pe is not hardened against malformed input.
+	defer func() {
+		if recover() != nil {
+			f = nil
+		}
+	}()
+	pf, err := debugpe.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	f = &file{
+		data:         data,
+		pe:           pf,
+		sections:     pf.Sections,
+		sectionTable: lfanew + 4 + 20 + int(pf.SizeOfOptionalHeader),
+	}
+	for _, s := range pf.Sections {
+		f.mapping = append(f.mapping, exe.Section{
+			VirtualAddress: s.VirtualAddress,
+			VirtualSize:    s.VirtualSize,
+			RawOffset:      s.Offset,
+			RawSize:        s.Size,
+		})
+	}
+	switch oh := pf.OptionalHeader.(type) {
+	case *debugpe.OptionalHeader32:
+		f.dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]
+	case *debugpe.OptionalHeader64:
+		f.is64 = true
+		f.dirs = oh.DataDirectory[:min(oh.NumberOfRvaAndSizes, 16)]
+	}
+	return f
+}
+
+func (f *file) headers(v scanner.Struct) {
+	fh := f.pe.FileHeader
+	v["machine"] = fh.Machine
+	v["number_of_sections"] = fh.NumberOfSections
+	v["timestamp"] = fh.TimeDateStamp
+	v["pointer_to_symbol_table"] = fh.PointerToSymbolTable
+	v["number_of_symbols"] = fh.NumberOfSymbols
+	v["size_of_optional_header"] = fh.SizeOfOptionalHeader
+	v["characteristics"] = fh.Characteristics
+
+	var entry uint32
+	switch oh := f.pe.OptionalHeader.(type) {
+	case *debugpe.OptionalHeader32:
+		entry = oh.AddressOfEntryPoint
+		v["opthdr_magic"] = oh.Magic
+		v["linker_version"] = version(uint16(oh.MajorLinkerVersion), uint16(oh.MinorLinkerVersion))
+		v["size_of_code"] = oh.SizeOfCode
+		v["size_of_initialized_data"] = oh.SizeOfInitializedData
+		v["size_of_uninitialized_data"] = oh.SizeOfUninitializedData
+		v["base_of_code"] = oh.BaseOfCode
+		v["base_of_data"] = oh.BaseOfData
+		v["image_base"] = oh.ImageBase
+		v["section_alignment"] = oh.SectionAlignment
+		v["file_alignment"] = oh.FileAlignment
+		v["os_version"] = version(oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion)
+		v["image_version"] = version(oh.MajorImageVersion, oh.MinorImageVersion)
+		v["subsystem_version"] = version(oh.MajorSubsystemVersion, oh.MinorSubsystemVersion)
+		v["win32_version_value"] = oh.Win32VersionValue
+		v["size_of_image"] = oh.SizeOfImage
+		v["size_of_headers"] = oh.SizeOfHeaders
+		v["checksum"] = oh.CheckSum
+		v["subsystem"] = oh.Subsystem
+		v["dll_characteristics"] = oh.DllCharacteristics
+		v["size_of_stack_reserve"] = oh.SizeOfStackReserve
+		v["size_of_stack_commit"] = oh.SizeOfStackCommit
+		v["size_of_heap_reserve"] = oh.SizeOfHeapReserve
+		v["size_of_heap_commit"] = oh.SizeOfHeapCommit
+		v["loader_flags"] = oh.LoaderFlags
+		v["number_of_rva_and_sizes"] = oh.NumberOfRvaAndSizes
+	case *debugpe.OptionalHeader64:
+		entry = oh.AddressOfEntryPoint
+		v["opthdr_magic"] = oh.Magic
+		v["linker_version"] = version(uint16(oh.MajorLinkerVersion), uint16(oh.MinorLinkerVersion))
+		v["size_of_code"] = oh.SizeOfCode
+		v["size_of_initialized_data"] = oh.SizeOfInitializedData
+		v["size_of_uninitialized_data"] = oh.SizeOfUninitializedData
+		v["base_of_code"] = oh.BaseOfCode
+		v["image_base"] = oh.ImageBase
+		v["section_alignment"] = oh.SectionAlignment
+		v["file_alignment"] = oh.FileAlignment
+		v["os_version"] = version(oh.MajorOperatingSystemVersion, oh.MinorOperatingSystemVersion)
+		v["image_version"] = version(oh.MajorImageVersion, oh.MinorImageVersion)
+		v["subsystem_version"] = version(oh.MajorSubsystemVersion, oh.MinorSubsystemVersion)
+		v["win32_version_value"] = oh.Win32VersionValue
+		v["size_of_image"] = oh.SizeOfImage
+		v["size_of_headers"] = oh.SizeOfHeaders
+		v["checksum"] = oh.CheckSum
+		v["subsystem"] = oh.Subsystem
+		v["dll_characteristics"] = oh.DllCharacteristics
+		v["size_of_stack_reserve"] = oh.SizeOfStackReserve
+		v["size_of_stack_commit"] = oh.SizeOfStackCommit
+		v["size_of_heap_reserve"] = oh.SizeOfHeapReserve
+		v["size_of_heap_commit"] = oh.SizeOfHeapCommit
+		v["loader_flags"] = oh.LoaderFlags
+		v["number_of_rva_and_sizes"] = oh.NumberOfRvaAndSizes
+	}
+	if f.pe.OptionalHeader != nil {
+		v["entry_point_raw"] = entry
+		if off, ok := f.rvaToOffset(entry); ok {
+			v["entry_point"] = off
+		}
+	}
+
+	dirs := make(scanner.Array, len(f.dirs))
+	for i, d := range f.dirs {
+		dirs[i] = scanner.Struct{"virtual_address": d.VirtualAddress, "size": d.Size}
+	}
+	v["data_directories"] = dirs
+
+	sections := make(scanner.Array, len(f.sections))
+	var end int64
+	for i, s := range f.sections {
+		sections[i] = scanner.Struct{
+			"name":                    f.rawSectionName(i),
+			"full_name":               s.Name,
+			"characteristics":         s.Characteristics,
+			"virtual_address":         s.VirtualAddress,
+			"virtual_size":            s.VirtualSize,
+			"raw_data_offset":         s.Offset,
+			"raw_data_size":           s.Size,
+			"pointer_to_relocations":  s.PointerToRelocations,
+			"pointer_to_line_numbers": s.PointerToLineNumbers,
+			"number_of_relocations":   s.NumberOfRelocations,
+			"number_of_line_numbers":  s.NumberOfLineNumbers,
+		}
+		end = max(end, int64(s.Offset)+int64(s.Size))
+	}
+	v["sections"] = sections
+
+	overlay := scanner.Struct{"offset": 0, "size": 0}
+	if end > 0 && end < int64(len(f.data)) {
+		overlay = scanner.Struct{"offset": end, "size": int64(len(f.data)) - end}
+	}
+	v["overlay"] = overlay
+}
+
+func version(major, minor uint16) scanner.Struct {
+	return scanner.Struct{"major": major, "minor": minor}
+}
+
+// rawSectionName returns the name in the section header, which for long
+// names is a "/offset" reference into the string table.
+func (f *file) rawSectionName(i int) string {
+	off := f.sectionTable + 40*i
+	if off+8 > len(f.data) {
+		return f.sections[i].Name
+	}
+	name := f.data[off : off+8]
+	if n := strings.IndexByte(string(name), 0); n >= 0 {
+		name = name[:n]
+	}
+	return string(name)
+}
+
+// rvaToOffset maps a relative virtual address to a file offset. Addresses
+// below the first section map to the headers.
+func (f *file) rvaToOffset(rva uint32) (int64, bool) {
+	return exe.RVAToOffset(f.mapping, rva, int64(len(f.data)))
+}
+
+// sectionIndex returns the index of the section containing rva.
+func (f *file) sectionIndex(rva uint32) (int, bool) {
+	for i, s := range f.mapping {
+		if s.Contains(rva) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// functions adds the module functions that depend on the parsed file.
+func (f *file) functions(v scanner.Struct) {
+	v["is_dll"] = noArgs(func() any { return f.pe.Characteristics&debugpe.IMAGE_FILE_DLL != 0 })
+	v["is_32bit"] = noArgs(func() any { return f.pe.OptionalHeader != nil && !f.is64 })
+	v["is_64bit"] = noArgs(func() any { return f.is64 })
+	v["rva_to_offset"] = scanner.Func(func(args []any) (any, bool) {
+		rva, ok := intArg(args, 0, 1)
+		if !ok {
+			return nil, false
+		}
+		return f.rvaToOffset(uint32(rva))
+	})
+	v["section_index"] = scanner.Func(func(args []any) (any, bool) {
+		if len(args) != 1 {
+			return nil, false
+		}
+		switch arg := args[0].(type) {
+		case string:
+			for i, s := range f.sections {
+				if s.Name == arg {
+					return i, true
+				}
+			}
+			return nil, false
+		case int64:
+			return f.sectionIndex(uint32(arg))
+		}
+		return nil, false
+	})
+	v["imports"] = scanner.Func(f.importsFunc)
+	v["imphash"] = noArgs(func() any { return f.imphash() })
+	v["exports"] = scanner.Func(func(args []any) (any, bool) {
+		if len(args) != 1 {
+			return nil, false
+		}
+		_, ok := f.exportIndex(args)
+		return ok, true
+	})
+	v["exports_index"] = scanner.Func(f.exportIndex)
+	v["language"] = scanner.Func(func(args []any) (any, bool) {
+		lang, ok := intArg(args, 0, 1)
+		return ok && f.hasLanguage(func(id uint32) bool { return int64(id&0xff) == lang }), ok
+	})
+	v["locale"] = scanner.Func(func(args []any) (any, bool) {
+		locale, ok := intArg(args, 0, 1)
+		return ok && f.hasLanguage(func(id uint32) bool { return int64(id&0xffff) == locale }), ok
+	})
+	v["calculate_checksum"] = noArgs(func() any { return f.checksum() })
+}
+
+// noArgs wraps a function that takes no arguments.
+func noArgs(fn func() any) scanner.Func {
+	return func(args []any) (any, bool) {
+		if len(args) != 0 {
+			return nil, false
+		}
+		return fn(), true
+	}
+}
+
+// intArg returns args[i] if there are n arguments and it is an integer.
+func intArg(args []any, i, n int) (int64, bool) {
+	if len(args) != n {
+		return 0, false
+	}
+	v, ok := args[i].(int64)
+	return v, ok
+}
+
+// checksumOffset returns the file offset of the optional header's CheckSum.
+func (f *file) checksumOffset() int {
+	return int(binary.LittleEndian.Uint32(f.data[0x3c:])) + 4 + 20 + 64
+}
+
+// checksum computes the image checksum the way the Windows loader does.
+func (f *file) checksum() uint32 {
+	skip := f.checksumOffset()
+	var sum uint64
+	data := f.data
+	for i := 0; i+1 < len(data); i += 2 {
+		if i == skip || i == skip+2 {
+			continue
+		}
+		sum += uint64(binary.LittleEndian.Uint16(data[i:]))
+		sum = (sum & 0xffff) + sum>>16
+	}
+	if len(data)%2 == 1 {
+		sum += uint64(data[len(data)-1])
+		sum = (sum & 0xffff) + sum>>16
+	}
+	return uint32(sum) + uint32(len(data))
+}
@@ -0,0 +1,211 @@
+package pe
+
+import (
+	debugpe "debug/pe"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// The fixtures are generated by testdata/gen.go.
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+var opts = scanner.CompileOptions{Modules: []scanner.Module{New()}}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		fixture string
+		cond    string
+		want    bool
+	}{
+		{"tiny32.dll", `pe.is_pe`, true},
+		{"tiny32.dll", `pe.machine == pe.MACHINE_I386`, true},
+		{"tiny32.dll", `pe.is_dll() and pe.is_32bit() and not pe.is_64bit()`, true},
+		{"tiny32.dll", `pe.characteristics & pe.DLL`, true},
+		{"tiny32.dll", `pe.subsystem == pe.SUBSYSTEM_WINDOWS_GUI`, true},
+		{"tiny32.dll", `pe.timestamp == 0x5f5e1000`, true},
+		{"tiny32.dll", `pe.opthdr_magic == pe.IMAGE_NT_OPTIONAL_HDR32_MAGIC`, true},
+		{"tiny32.dll", `pe.image_base == 0x10000000 and pe.base_of_data == 0x2000`, true},
+		{"tiny32.dll", `pe.linker_version.major == 6 and pe.os_version.minor == 1`, true},
+		{"tiny32.dll", `pe.entry_point == 0x200 and pe.entry_point_raw == 0x1000`, true},
+		{"tiny32.dll", `uint8(pe.entry_point) == 0xb8`, true},
+		{"tiny32.dll", `pe.checksum != 0 and pe.checksum == pe.calculate_checksum()`, true},
+		{"tiny32.dll", `pe.number_of_sections == 3`, true},
+		{"tiny32.dll", `pe.sections[1].virtual_address == 0x2000 and pe.sections[1].raw_data_offset == 0x400`, true},
+		{"tiny32.dll", `pe.sections[0].characteristics & pe.SECTION_MEM_EXECUTE`, true},
+		{"tiny32.dll", `pe.section_index(".rsrc") == 2`, true},
+		{"tiny32.dll", `pe.section_index(0x2010) == 1`, true},
+		{"tiny32.dll", `pe.section_index(".bss") == 0`, false},
+		{"tiny32.dll", `pe.rva_to_offset(0x1010) == 0x210`, true},
+		{"tiny32.dll", `pe.rva_to_offset(0x10) == 0x10`, true},
+		{"tiny32.dll", `pe.data_directories[pe.IMAGE_DIRECTORY_ENTRY_IMPORT].virtual_address > 0x2000`, true},
+		{"tiny32.dll", `pe.overlay.size == 0`, true},
+		{"tiny32.dll", `pe.sections[0].name == ".text" and pe.dll_name == "tiny32.dll"`, true},
+		{"tiny32.dll", `pe.imphash() == "9cbf57d36b26a4a4bc4d638300a1e62e"`, true},
+
+		{"tiny32.dll", `pe.number_of_imports == 3 and pe.number_of_imported_functions == 5`, true},
+		{"tiny32.dll", `pe.imports("kernel32.dll", "VirtualAlloc")`, true},
+		{"tiny32.dll", `pe.imports("KERNEL32.DLL", "virtualalloc")`, true},
+		{"tiny32.dll", `pe.imports("kernel32.dll", "CreateThread")`, false},
+		{"tiny32.dll", `pe.imports("user32.dll", "VirtualAlloc")`, false},
+		{"tiny32.dll", `pe.imports("kernel32.dll") == 3`, true},
+		{"tiny32.dll", `pe.imports("ntdll.dll") == 0`, true},
+		{"tiny32.dll", `pe.imports("comctl32.dll", 17)`, true},
+		{"tiny32.dll", `pe.imports("comctl32.dll", 18)`, false},
+		{"tiny32.dll", `pe.import_details[1].number_of_functions == 1`, true},
+		{"tiny32.dll", `pe.import_details[2].functions[0].ordinal == 17`, true},
+
+		{"tiny32.dll", `pe.number_of_exports == 3 and pe.export_timestamp == pe.timestamp`, true},
+		{"tiny32.dll", `pe.exports("Hello") and pe.exports("world")`, true},
+		{"tiny32.dll", `pe.exports("DllMain")`, false},
+		{"tiny32.dll", `pe.exports(3) and not pe.exports(4)`, true},
+		{"tiny32.dll", `pe.exports_index("World") == 1`, true},
+		{"tiny32.dll", `pe.export_details[0].ordinal == 1 and pe.export_details[0].offset == 0x210`, true},
+		{"tiny32.dll", `uint8(pe.export_details[2].offset + 1) == 3`, true},
+
+		{"tiny32.dll", `pe.number_of_resources == 2 and pe.resource_timestamp == pe.timestamp`, true},
+		{"tiny32.dll", `pe.resource_version.major == 4`, true},
+		{"tiny32.dll", `pe.resources[0].type == pe.RESOURCE_TYPE_RCDATA`, true},
+		{"tiny32.dll", `pe.resources[0].id == 0`, false},
+		{"tiny32.dll", `pe.resources[0].length == 10 and uint8(pe.resources[0].offset) == 0x6b`, true},
+		{"tiny32.dll", `pe.resources[1].type == pe.RESOURCE_TYPE_MANIFEST and pe.resources[1].id == 1`, true},
+		{"tiny32.dll", `pe.language(0x09) and pe.locale(0x409)`, true},
+		{"tiny32.dll", `pe.locale(0x407)`, false},
+
+		{"tiny64.exe", `pe.machine == pe.MACHINE_AMD64 and pe.is_64bit()`, true},
+		{"tiny64.exe", `pe.is_dll()`, false},
+		{"tiny64.exe", `pe.subsystem == pe.SUBSYSTEM_WINDOWS_CUI`, true},
+		{"tiny64.exe", `pe.image_base == 0x140000000`, true},
+		{"tiny64.exe", `pe.dll_characteristics & pe.HIGH_ENTROPY_VA`, true},
+		{"tiny64.exe", `pe.base_of_data == 0`, false},
+		{"tiny64.exe", `pe.checksum == 0`, true},
+		{"tiny64.exe", `pe.imports("kernel32.dll", "ExitProcess") and pe.imports("ws2_32.dll", 23)`, true},
+		{"tiny64.exe", `pe.number_of_exports == 0 and pe.number_of_resources == 0`, true},
+		{"tiny64.exe", `pe.exports("Hello")`, false},
+		{"tiny64.exe", `pe.overlay.offset == 0x800 and pe.overlay.size == 27`, true},
+		{"tiny64.exe", `uint32be(pe.overlay.offset + pe.overlay.size - 4) == 0x4c415921`, true},
+		{"tiny64.exe", `pe.section_index(".gnu_debuglink") == 2`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture+"/"+tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, readFixture(t, tt.fixture), opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	v, err := New().Load(&scanner.ScanContext{Data: readFixture(t, "tiny32.dll")})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	imphash, _ := v["imphash"].(scanner.Func)([]any{})
+	if want := "9cbf57d36b26a4a4bc4d638300a1e62e"; imphash != want {
+		t.Errorf("imphash() = %v, want %s", imphash, want)
+	}
+	if got := v["dll_name"]; got != "tiny32.dll" {
+		t.Errorf("dll_name = %v, want tiny32.dll", got)
+	}
+	if got := v["import_details"].(scanner.Array)[0].(scanner.Struct)["library_name"]; got != "KERNEL32.dll" {
+		t.Errorf("import_details[0].library_name = %v, want KERNEL32.dll", got)
+	}
+	exports := v["export_details"].(scanner.Array)
+	if got := exports[1].(scanner.Struct)["name"]; got != "World" {
+		t.Errorf("export_details[1].name = %v, want World", got)
+	}
+	if _, ok := exports[2].(scanner.Struct)["name"]; ok {
+		t.Error("export_details[2] exported by ordinal only has a name")
+	}
+	res := v["resources"].(scanner.Array)[0].(scanner.Struct)
+	if got, want := res["name_string"], "C\x00O\x00N\x00F\x00I\x00G\x00"; got != want {
+		t.Errorf("resources[0].name_string = %q, want %q", got, want)
+	}
+
+	v, err = New().Load(&scanner.ScanContext{Data: readFixture(t, "tiny64.exe")})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	section := v["sections"].(scanner.Array)[2].(scanner.Struct)
+	if section["name"] != "/4" || section["full_name"] != ".gnu_debuglink" {
+		t.Errorf("sections[2] name = %q, full_name = %q, want /4 and .gnu_debuglink", section["name"], section["full_name"])
+	}
+}
+
+func TestNotPE(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"text", []byte("<?php echo 1; ?>")},
+		{"mz only", append([]byte("MZ"), make([]byte, 0x40)...)},
+		{"truncated", readFixture(t, "tiny32.dll")[:0x60]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !scantest.Match(t, `not pe.is_pe and pe.MACHINE_I386 == 0x14c`, tt.data, opts) {
+				t.Error("expected is_pe to be false with constants defined")
+			}
+			if scantest.Match(t, `pe.number_of_sections == 0 or pe.is_dll() or pe.imports("kernel32.dll") == 0`, tt.data, opts) {
+				t.Error("expected PE fields to be undefined")
+			}
+		})
+	}
+}
+
+// TestMalformed checks that corrupt directories do not break a scan.
+func TestMalformed(t *testing.T) {
+	data := readFixture(t, "tiny32.dll")
+	for i := 0x180; i < len(data); i += 7 {
+		corrupt := append([]byte(nil), data...)
+		for j := i; j < min(i+4, len(corrupt)); j++ {
+			corrupt[j] = 0xff
+		}
+		if _, err := New().Load(&scanner.ScanContext{Data: corrupt}); err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+	}
+}
+
+// TestResourceCycle checks that a resource directory whose entries all
+// point back at itself is read once, not once per path through it.
+func TestResourceCycle(t *testing.T) {
+	data := append(readFixture(t, "tiny32.dll"), make([]byte, 8*4096)...)
+	off, _, ok := parse(data).dir(debugpe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if !ok {
+		t.Fatal("fixture has no resource directory")
+	}
+	n := min((int64(len(data))-off-16)/8, 0xffff)
+	binary.LittleEndian.PutUint16(data[off+12:], 0)
+	binary.LittleEndian.PutUint16(data[off+14:], uint16(n))
+	for i := int64(0); i < n; i++ {
+		binary.LittleEndian.PutUint32(data[off+16+8*i:], uint32(i))
+		binary.LittleEndian.PutUint32(data[off+20+8*i:], 0x80000000)
+	}
+
+	start := time.Now()
+	v, err := New().Load(&scanner.ScanContext{Data: data})
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := v["number_of_resources"]; got != 0 {
+		t.Errorf("number_of_resources = %v, want 0", got)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Load() took %v", elapsed)
+	}
+}
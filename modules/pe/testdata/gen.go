@@ -0,0 +1,445 @@
+//go:build ignore
+
+// gen writes the PE fixtures used by the pe module tests. The images are
+// assembled by hand so they stay small and their contents are known:
+//
+//	go run gen.go
+//
+// tiny32.dll is an i386 DLL with imports (one by ordinal), exports (one by
+// ordinal only) and two resources. tiny64.exe is an AMD64 console program
+// with a long section name and an overlay.
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"log"
+	"os"
+	"unicode/utf16"
+)
+
+const (
+	fileAlign    = 0x200
+	sectionAlign = 0x1000
+	headerSize   = 0x200
+	lfanew       = 0x40
+)
+
+type section struct {
+	name  string
+	rva   uint32
+	buf   bytes.Buffer
+	chars uint32
+}
+
+// here returns the RVA of the next byte written to the section.
+func (s *section) here() uint32 { return s.rva + uint32(s.buf.Len()) }
+
+func (s *section) put(v any) uint32 {
+	rva := s.here()
+	if err := binary.Write(&s.buf, binary.LittleEndian, v); err != nil {
+		log.Fatal(err)
+	}
+	return rva
+}
+
+func (s *section) cstring(str string) uint32 {
+	rva := s.here()
+	s.buf.WriteString(str)
+	s.buf.WriteByte(0)
+	return rva
+}
+
+func (s *section) align(n int) {
+	for s.buf.Len()%n != 0 {
+		s.buf.WriteByte(0)
+	}
+}
+
+type image struct {
+	machine   uint16
+	is64      bool
+	dll       bool
+	subsystem uint16
+	timestamp uint32
+	entry     uint32
+	sections  []*section
+	dirs      [16]pe.DataDirectory
+	strtab    []string // long section names, referenced as "/offset"
+	overlay   []byte
+	checksum  bool
+}
+
+func (img *image) add(name string, chars uint32) *section {
+	s := &section{name: name, rva: uint32(len(img.sections)+1) * sectionAlign, chars: chars}
+	img.sections = append(img.sections, s)
+	return s
+}
+
+type importLib struct {
+	name  string
+	funcs []any // string names or uint16 ordinals
+}
+
+func (img *image) writeImports(s *section, libs []importLib) {
+	names := make([][]uint64, len(libs))
+	dllNames := make([]uint32, len(libs))
+	for i, lib := range libs {
+		dllNames[i] = s.cstring(lib.name)
+		for _, fn := range lib.funcs {
+			switch fn := fn.(type) {
+			case string:
+				s.align(2)
+				rva := s.put(uint16(0))
+				s.cstring(fn)
+				names[i] = append(names[i], uint64(rva))
+			case uint16:
+				flag := uint64(0x80000000)
+				if img.is64 {
+					flag = 0x8000000000000000
+				}
+				names[i] = append(names[i], flag|uint64(fn))
+			}
+		}
+	}
+	s.align(8)
+	thunks := func(entries []uint64) uint32 {
+		rva := s.here()
+		for _, e := range append(entries, 0) {
+			if img.is64 {
+				s.put(e)
+			} else {
+				s.put(uint32(e))
+			}
+		}
+		return rva
+	}
+	descs := make([]pe.ImportDirectory, 0, len(libs)+1)
+	iatStart := s.here()
+	for i := range libs {
+		ilt := thunks(names[i])
+		iat := thunks(names[i])
+		descs = append(descs, pe.ImportDirectory{OriginalFirstThunk: ilt, Name: dllNames[i], FirstThunk: iat})
+	}
+	img.dirs[pe.IMAGE_DIRECTORY_ENTRY_IAT] = pe.DataDirectory{VirtualAddress: iatStart, Size: s.here() - iatStart}
+	descs = append(descs, pe.ImportDirectory{})
+	dir := s.here()
+	for _, d := range descs {
+		s.put([5]uint32{d.OriginalFirstThunk, d.TimeDateStamp, d.ForwarderChain, d.Name, d.FirstThunk})
+	}
+	img.dirs[pe.IMAGE_DIRECTORY_ENTRY_IMPORT] = pe.DataDirectory{VirtualAddress: dir, Size: s.here() - dir}
+}
+
+type exportDirectory struct {
+	Characteristics       uint32
+	TimeDateStamp         uint32
+	MajorVersion          uint16
+	MinorVersion          uint16
+	Name                  uint32
+	Base                  uint32
+	NumberOfFunctions     uint32
+	NumberOfNames         uint32
+	AddressOfFunctions    uint32
+	AddressOfNames        uint32
+	AddressOfNameOrdinals uint32
+}
+
+// writeExports exports funcs by ordinal, starting at 1. Functions with an
+// empty name are exported by ordinal only. Names must be sorted.
+func (img *image) writeExports(s *section, dllName string, funcs []string, addrs []uint32) {
+	nameRVA := s.cstring(dllName)
+	var names []uint32
+	var ordinals []uint16
+	for i, fn := range funcs {
+		if fn != "" {
+			names = append(names, s.cstring(fn))
+			ordinals = append(ordinals, uint16(i))
+		}
+	}
+	s.align(4)
+	d := exportDirectory{
+		TimeDateStamp:     img.timestamp,
+		Name:              nameRVA,
+		Base:              1,
+		NumberOfFunctions: uint32(len(funcs)),
+		NumberOfNames:     uint32(len(names)),
+	}
+	d.AddressOfFunctions = s.put(addrs)
+	d.AddressOfNames = s.put(names)
+	d.AddressOfNameOrdinals = s.put(ordinals)
+	s.align(4)
+	dir := s.put(d)
+	img.dirs[pe.IMAGE_DIRECTORY_ENTRY_EXPORT] = pe.DataDirectory{VirtualAddress: dir, Size: s.here() - dir}
+}
+
+type resourceDirectory struct {
+	Characteristics      uint32
+	TimeDateStamp        uint32
+	MajorVersion         uint16
+	MinorVersion         uint16
+	NumberOfNamedEntries uint16
+	NumberOfIdEntries    uint16
+}
+
+type resourceDataEntry struct {
+	OffsetToData uint32
+	Size         uint32
+	CodePage     uint32
+	Reserved     uint32
+}
+
+// writeResources lays out a fixed tree: an RT_RCDATA resource named
+// "CONFIG" and an RT_MANIFEST resource with ID 1, both in US English.
+func (img *image) writeResources(s *section, config, manifest []byte) {
+	const (
+		subdir  = 0x80000000
+		named   = 0x80000000
+		langUS  = 0x409
+		rcdata  = 10
+		manType = 24
+	)
+	dir := func(namedEntries, idEntries uint16) {
+		s.put(resourceDirectory{TimeDateStamp: img.timestamp, MajorVersion: 4, NumberOfNamedEntries: namedEntries, NumberOfIdEntries: idEntries})
+	}
+	entry := func(id, offset uint32) { s.put([2]uint32{id, offset}) }
+
+	// Offsets are relative to the start of the section.
+	dir(0, 2) // 0: types
+	entry(rcdata, subdir|32)
+	entry(manType, subdir|56)
+	dir(1, 0) // 32: RT_RCDATA names
+	entry(named|160, subdir|80)
+	dir(0, 1) // 56: RT_MANIFEST IDs
+	entry(1, subdir|104)
+	dir(0, 1) // 80: CONFIG languages
+	entry(langUS, 128)
+	dir(0, 1) // 104: manifest languages
+	entry(langUS, 144)
+	s.put(resourceDataEntry{OffsetToData: s.rva + 176, Size: uint32(len(config))}) // 128
+	s.put(resourceDataEntry{OffsetToData: s.rva + 192, Size: uint32(len(manifest))})
+	name := utf16.Encode([]rune("CONFIG")) // 160
+	s.put(uint16(len(name)))
+	s.put(name)
+	s.align(16)
+	s.buf.Write(config) // 176
+	s.align(16)
+	s.buf.Write(manifest) // 192
+	img.dirs[pe.IMAGE_DIRECTORY_ENTRY_RESOURCE] = pe.DataDirectory{VirtualAddress: s.rva, Size: uint32(s.buf.Len())}
+}
+
+func alignUp(n, a uint32) uint32 { return (n + a - 1) &^ (a - 1) }
+
+func (img *image) bytes() []byte {
+	var out bytes.Buffer
+	w := func(v any) {
+		if err := binary.Write(&out, binary.LittleEndian, v); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	dos := make([]byte, lfanew)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], lfanew)
+	out.Write(dos)
+	out.WriteString("PE\x00\x00")
+
+	var codeSize, dataSize, codeBase, dataBase uint32
+	offset := uint32(headerSize)
+	var headers []pe.SectionHeader32
+	for _, s := range img.sections {
+		raw := alignUp(uint32(s.buf.Len()), fileAlign)
+		if s.chars&pe.IMAGE_SCN_CNT_CODE != 0 {
+			codeSize += raw
+			if codeBase == 0 {
+				codeBase = s.rva
+			}
+		} else {
+			dataSize += raw
+			if dataBase == 0 {
+				dataBase = s.rva
+			}
+		}
+		h := pe.SectionHeader32{
+			VirtualSize:      uint32(s.buf.Len()),
+			VirtualAddress:   s.rva,
+			SizeOfRawData:    raw,
+			PointerToRawData: offset,
+			Characteristics:  s.chars,
+		}
+		copy(h.Name[:], s.name)
+		headers = append(headers, h)
+		offset += raw
+	}
+	last := img.sections[len(img.sections)-1]
+	imageSize := last.rva + alignUp(uint32(last.buf.Len()), sectionAlign)
+
+	fh := pe.FileHeader{
+		Machine:          img.machine,
+		NumberOfSections: uint16(len(img.sections)),
+		TimeDateStamp:    img.timestamp,
+		Characteristics:  pe.IMAGE_FILE_EXECUTABLE_IMAGE,
+	}
+	if len(img.strtab) > 0 {
+		fh.PointerToSymbolTable = offset
+	}
+	if img.dll {
+		fh.Characteristics |= pe.IMAGE_FILE_DLL
+	}
+	if img.is64 {
+		fh.SizeOfOptionalHeader = uint16(binary.Size(pe.OptionalHeader64{}))
+		fh.Characteristics |= pe.IMAGE_FILE_LARGE_ADDRESS_AWARE
+	} else {
+		fh.SizeOfOptionalHeader = uint16(binary.Size(pe.OptionalHeader32{}))
+		fh.Characteristics |= pe.IMAGE_FILE_32BIT_MACHINE
+	}
+	w(fh)
+
+	dllChars := uint16(pe.IMAGE_DLLCHARACTERISTICS_DYNAMIC_BASE | pe.IMAGE_DLLCHARACTERISTICS_NX_COMPAT)
+	if img.is64 {
+		w(pe.OptionalHeader64{
+			Magic: 0x20b, MajorLinkerVersion: 14, MinorLinkerVersion: 29,
+			SizeOfCode: codeSize, SizeOfInitializedData: dataSize,
+			AddressOfEntryPoint: img.entry, BaseOfCode: codeBase,
+			ImageBase: 0x140000000, SectionAlignment: sectionAlign, FileAlignment: fileAlign,
+			MajorOperatingSystemVersion: 6, MajorSubsystemVersion: 6,
+			SizeOfImage: imageSize, SizeOfHeaders: headerSize,
+			Subsystem: img.subsystem, DllCharacteristics: dllChars | pe.IMAGE_DLLCHARACTERISTICS_HIGH_ENTROPY_VA,
+			SizeOfStackReserve: 0x100000, SizeOfStackCommit: 0x1000,
+			SizeOfHeapReserve: 0x100000, SizeOfHeapCommit: 0x1000,
+			NumberOfRvaAndSizes: 16, DataDirectory: img.dirs,
+		})
+	} else {
+		w(pe.OptionalHeader32{
+			Magic: 0x10b, MajorLinkerVersion: 6, MinorLinkerVersion: 0,
+			SizeOfCode: codeSize, SizeOfInitializedData: dataSize,
+			AddressOfEntryPoint: img.entry, BaseOfCode: codeBase, BaseOfData: dataBase,
+			ImageBase: 0x10000000, SectionAlignment: sectionAlign, FileAlignment: fileAlign,
+			MajorOperatingSystemVersion: 5, MinorOperatingSystemVersion: 1,
+			MajorSubsystemVersion: 5, MinorSubsystemVersion: 1,
+			SizeOfImage: imageSize, SizeOfHeaders: headerSize,
+			Subsystem: img.subsystem, DllCharacteristics: dllChars,
+			SizeOfStackReserve: 0x100000, SizeOfStackCommit: 0x1000,
+			SizeOfHeapReserve: 0x100000, SizeOfHeapCommit: 0x1000,
+			NumberOfRvaAndSizes: 16, DataDirectory: img.dirs,
+		})
+	}
+	for _, h := range headers {
+		w(h)
+	}
+	out.Write(make([]byte, headerSize-out.Len()))
+
+	for i, s := range img.sections {
+		out.Write(s.buf.Bytes())
+		out.Write(make([]byte, int(headers[i].SizeOfRawData)-s.buf.Len()))
+	}
+	if len(img.strtab) > 0 {
+		var strtab bytes.Buffer
+		for _, name := range img.strtab {
+			strtab.WriteString(name)
+			strtab.WriteByte(0)
+		}
+		w(uint32(strtab.Len() + 4))
+		out.Write(strtab.Bytes())
+	}
+	out.Write(img.overlay)
+
+	data := out.Bytes()
+	if img.checksum {
+		binary.LittleEndian.PutUint32(data[checksumOffset:], checksum(data))
+	}
+	return data
+}
+
+// checksumOffset is the file offset of the optional header's CheckSum.
+const checksumOffset = lfanew + 4 + 20 + 64
+
+// checksum computes the image checksum the way the Windows loader does.
+func checksum(data []byte) uint32 {
+	var sum uint64
+	for i := 0; i+1 < len(data); i += 2 {
+		if i == checksumOffset || i == checksumOffset+2 {
+			continue
+		}
+		sum += uint64(binary.LittleEndian.Uint16(data[i:]))
+		sum = (sum & 0xffff) + sum>>16
+	}
+	if len(data)%2 == 1 {
+		sum += uint64(data[len(data)-1])
+		sum = (sum & 0xffff) + sum>>16
+	}
+	return uint32(sum) + uint32(len(data))
+}
+
+const (
+	code  = pe.IMAGE_SCN_CNT_CODE | pe.IMAGE_SCN_MEM_EXECUTE | pe.IMAGE_SCN_MEM_READ
+	rdata = pe.IMAGE_SCN_CNT_INITIALIZED_DATA | pe.IMAGE_SCN_MEM_READ
+)
+
+func tiny32() []byte {
+	img := &image{
+		machine:   pe.IMAGE_FILE_MACHINE_I386,
+		dll:       true,
+		subsystem: pe.IMAGE_SUBSYSTEM_WINDOWS_GUI,
+		timestamp: 0x5f5e1000,
+		checksum:  true,
+	}
+	text := img.add(".text", code)
+	// DllMain: mov eax, 1; ret 12. The exports return their ordinal.
+	text.buf.Write([]byte{0xb8, 0x01, 0x00, 0x00, 0x00, 0xc2, 0x0c, 0x00})
+	img.entry = text.rva
+	var exports []uint32
+	for i := range 3 {
+		text.align(16)
+		exports = append(exports, text.here())
+		text.buf.Write([]byte{0xb8, byte(i + 1), 0x00, 0x00, 0x00, 0xc3})
+	}
+
+	rd := img.add(".rdata", rdata)
+	img.writeImports(rd, []importLib{
+		{"KERNEL32.dll", []any{"VirtualAlloc", "GetProcAddress", "LoadLibraryA"}},
+		{"USER32.dll", []any{"MessageBoxA"}},
+		{"COMCTL32.dll", []any{uint16(17)}},
+	})
+	img.writeExports(rd, "tiny32.dll", []string{"Hello", "World", ""}, exports)
+
+	rsrc := img.add(".rsrc", rdata)
+	img.writeResources(rsrc, []byte("key=value\n"), []byte(`<assembly manifestVersion="1.0"/>`))
+	return img.bytes()
+}
+
+func tiny64() []byte {
+	img := &image{
+		machine:   pe.IMAGE_FILE_MACHINE_AMD64,
+		is64:      true,
+		subsystem: pe.IMAGE_SUBSYSTEM_WINDOWS_CUI,
+		timestamp: 0x65000000,
+		strtab:    []string{".gnu_debuglink"},
+		overlay:   []byte("OVERLAY!"),
+	}
+	text := img.add(".text", code)
+	// sub rsp, 40; xor ecx, ecx; call [rip+ExitProcess]
+	text.buf.Write([]byte{0x48, 0x83, 0xec, 0x28, 0x31, 0xc9, 0xff, 0x15, 0x00, 0x00, 0x00, 0x00})
+	img.entry = text.rva
+
+	rd := img.add(".rdata", rdata)
+	img.writeImports(rd, []importLib{
+		{"kernel32.dll", []any{"ExitProcess", "VirtualAlloc"}},
+		{"ws2_32.dll", []any{uint16(23)}},
+	})
+
+	debug := img.add("/4", pe.IMAGE_SCN_CNT_INITIALIZED_DATA|pe.IMAGE_SCN_MEM_DISCARDABLE)
+	debug.cstring("tiny64.debug")
+	return img.bytes()
+}
+
+func main() {
+	for name, data := range map[string][]byte{
+		"tiny32.dll": tiny32(),
+		"tiny64.exe": tiny64(),
+	} {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package stringmod implements the string module, which converts and measures
+// strings in conditions:
+//
+//	import "string"
+//
+//	rule version {
+//	    condition:
+//	        string.to_int("0x2a") == 42 and string.length("abc") == 3
+//	}
+//
+// to_int parses a string as an integer, in base 10, 8 (leading 0) or 16
+// (leading 0x) or in an explicit base from 2 to 36, and is undefined when
+// the string is not a valid integer. length returns the length of a string
+// in bytes.
+package stringmod
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sansecio/yargo/scanner"
+)
+
+// Module is the string module.
+type Module struct{}
+
+// New returns the string module, to be passed in
+// scanner.CompileOptions.Modules.
+func New() *Module {
+	return &Module{}
+}
+
+// Name returns "string".
+func (m *Module) Name() string { return "string" }
+
+// functions are the same for every scan.
+var functions = scanner.Struct{
+	"to_int": scanner.Func(toInt),
+	"length": scanner.Func(length),
+}
+
+// Load returns the string functions.
+func (m *Module) Load(*scanner.ScanContext) (scanner.Struct, error) {
+	return functions, nil
+}
+
+// toInt implements to_int(s) and to_int(s, base).
+func toInt(args []any) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, false
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	base := int64(0)
+	if len(args) == 2 {
+		base, ok = args[1].(int64)
+		if !ok || base < 2 || base > 36 {
+			return nil, false
+		}
+	}
+	// strconv also accepts underscores and 0b and 0o prefixes in base 0,
+	// which C's strtoll, and so YARA, does not.
+	if base == 0 {
+		digits := strings.TrimLeft(s, "+-")
+		if strings.Contains(s, "_") || hasPrefixFold(digits, "0b") || hasPrefixFold(digits, "0o") {
+			return nil, false
+		}
+	}
+	n, err := strconv.ParseInt(s, int(base), 64)
+	if err != nil {
+		return nil, false
+	}
+	return n, true
+}
+
+// length implements length(s).
+func length(args []any) (any, bool) {
+	if len(args) != 1 {
+		return nil, false
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, false
+	}
+	return len(s), true
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,46 @@
+package stringmod
+
+import (
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/scanner"
+)
+
+var opts = scanner.CompileOptions{Modules: []scanner.Module{New()}}
+
+func TestConditions(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`string.to_int("1234") == 1234`, true},
+		{`string.to_int("-10") == -10`, true},
+		{`string.to_int("0x2a") == 42`, true},
+		{`string.to_int("010") == 8`, true},
+		{`string.to_int("ff", 16) == 255`, true},
+		{`string.to_int("z", 36) == 35`, true},
+		{`string.to_int("101", 2) == 5`, true},
+		{`string.length("abc") == 3`, true},
+		{`string.length("") == 0`, true},
+		{`string.length("\x00\x01") == 2`, true},
+		{`string.length(string.to_int("5")) == 1`, false},
+
+		// Invalid numbers and bases are undefined.
+		{`string.to_int("12ab") == 12`, false},
+		{`string.to_int("") == 0`, false},
+		{`string.to_int("1_000") == 1000`, false},
+		{`string.to_int("0b101") == 5`, false},
+		{`string.to_int("10", 1) == 1`, false},
+		{`string.to_int("10", 37) == 37`, false},
+		{`string.to_int("99999999999999999999") > 0`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, []byte("data"), opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
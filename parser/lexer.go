@@ -1,7 +1,9 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -19,11 +21,24 @@ const (
 )
 
 type yaraLexer struct {
-	input   string
-	pos     int
-	modes   []int
-	ruleSet *ast.RuleSet
-	err     string
+	input    string
+	file     string // name of the file being parsed, for positions
+	pos      int
+	modes    []int
+	ruleSet  *ast.RuleSet // rules parsed so far
+	errs     ErrorList
+	comments []*ast.Comment
+
+	lines    []int // offsets of the line starts, computed on first use
+	tokStart int   // offset of the last token returned by Lex
+
+	// recovering suppresses errors after the first one until the next
+	// rule starts, and ruleErrs is the number of errors when it started.
+	recovering bool
+	ruleErrs   int
+
+	include      func(name string) (*ast.RuleSet, ErrorList, error) // parses an included file
+	keepIncludes bool                                               // records includes instead, see Options.KeepIncludes
 }
 
 func newLexer(input string) *yaraLexer {
@@ -47,17 +62,32 @@ func (l *yaraLexer) popMode() {
 	}
 }
 
+// Lex returns the next token, with its offsets in lval.start and lval.end.
 func (l *yaraLexer) Lex(lval *yySymType) int {
+	tok := l.lex(lval)
+	if tok == 0 {
+		l.tokStart = l.pos
+	}
+	lval.start, lval.end = l.tokStart, l.pos
+	return tok
+}
+
+func (l *yaraLexer) lex(lval *yySymType) int {
 	for l.pos < len(l.input) {
 		// Skip whitespace
 		if l.skipWhitespace() {
 			continue
 		}
-		// Skip comments
-		if l.skipComment() {
+		// Skip comments, keeping them for the printer
+		if start := l.pos; l.skipComment() {
+			l.comments = append(l.comments, &ast.Comment{
+				Text: strings.TrimRight(l.input[start:l.pos], "\r"),
+				Span: l.span(start, l.pos),
+			})
 			continue
 		}
 
+		l.tokStart = l.pos
 		switch l.mode() {
 		case modeRoot:
 			return l.lexRoot(lval)
@@ -74,8 +104,77 @@ func (l *yaraLexer) Lex(lval *yySymType) int {
 	return 0 // EOF
 }
 
+// Error records a syntax error at the last token returned by Lex.
 func (l *yaraLexer) Error(s string) {
-	l.err = s
+	l.errorAt(l.tokStart, l.pos, s)
+}
+
+// errorAt records an error about the source between offsets start and
+// end. Errors following another one in the same rule are dropped, as they
+// are usually caused by it.
+func (l *yaraLexer) errorAt(start, end int, msg string) {
+	if l.recovering {
+		return
+	}
+	l.recovering = true
+	l.addError(start, end, msg)
+}
+
+// addError records an error about the source between offsets start and
+// end.
+func (l *yaraLexer) addError(start, end int, msg string) {
+	pos := l.position(start)
+	l.errs = append(l.errs, &Error{
+		File:   l.file,
+		Line:   pos.Line,
+		Column: pos.Column,
+		Token:  l.input[start:end],
+		Msg:    msg,
+	})
+}
+
+// startRule is called when the parser starts a rule, after any earlier
+// rule ended or was skipped because of an error.
+func (l *yaraLexer) startRule() {
+	l.recovering = false
+	l.ruleErrs = len(l.errs)
+}
+
+// ruleFailed reports whether there were errors in the current rule.
+func (l *yaraLexer) ruleFailed() bool {
+	return len(l.errs) > l.ruleErrs
+}
+
+// restartRule handles the rule keywords in a rule body or condition,
+// which means the current rule lacks its closing brace: it returns to the
+// root mode and lexes the keyword there, so that the parser reports the
+// error and resumes at the new rule.
+func (l *yaraLexer) restartRule(word string, lval *yySymType) int {
+	l.pos -= len(word)
+	l.modes = l.modes[:1]
+	return l.lexRoot(lval)
+}
+
+// position returns the line and column of an offset in the input.
+func (l *yaraLexer) position(offset int) ast.Position {
+	if l.lines == nil {
+		l.lines = make([]int, 1, strings.Count(l.input, "\n")+1)
+		for i := 0; i < len(l.input); i++ {
+			if l.input[i] == '\n' {
+				l.lines = append(l.lines, i+1)
+			}
+		}
+	}
+	line, found := slices.BinarySearch(l.lines, offset)
+	if !found {
+		line--
+	}
+	return ast.Position{Offset: offset, Line: line + 1, Column: offset - l.lines[line] + 1}
+}
+
+// span returns the span of the input between offsets start and end.
+func (l *yaraLexer) span(start, end int) ast.Span {
+	return ast.Span{File: l.file, Start: l.position(start), End: l.position(end)}
 }
 
 func (l *yaraLexer) skipWhitespace() bool {
@@ -173,16 +272,29 @@ func (l *yaraLexer) lexRoot(lval *yySymType) int {
 	ch := l.peek()
 	if isAlpha(ch) || ch == '_' {
 		word := l.readIdent()
-		if word == "rule" {
+		switch word {
+		case "rule":
 			l.pushMode(modeRuleBody)
 			return RULE
+		case "import":
+			return IMPORT
+		case "include":
+			return INCLUDE
+		case "private":
+			return PRIVATE
+		case "global":
+			return GLOBAL
 		}
 		lval.str = word
 		return IDENT
 	}
+	if ch == '"' {
+		lval.str = l.readQuotedString()
+		return STRING_LIT
+	}
 	l.pos++
-	l.err = fmt.Sprintf("unexpected character %q at position %d", ch, l.pos-1)
-	return 0
+	l.errorAt(l.pos-1, l.pos, "unexpected character")
+	return INVALID
 }
 
 func (l *yaraLexer) lexRuleBody(lval *yySymType) int {
@@ -223,6 +335,8 @@ func (l *yaraLexer) lexRuleBody(lval *yySymType) int {
 		case "condition":
 			l.pushMode(modeCondition)
 			return CONDITION
+		case "rule", "private", "global":
+			return l.restartRule(word, lval)
 		default:
 			lval.str = word
 			return IDENT
@@ -230,8 +344,8 @@ func (l *yaraLexer) lexRuleBody(lval *yySymType) int {
 	}
 
 	l.pos++
-	l.err = fmt.Sprintf("unexpected character %q in rule body", ch)
-	return 0
+	l.errorAt(l.pos-1, l.pos, "unexpected character in rule body")
+	return INVALID
 }
 
 func (l *yaraLexer) lexStringIdent(lval *yySymType) int {
@@ -267,21 +381,50 @@ func (l *yaraLexer) lexStringValue(lval *yySymType) int {
 	if isAlpha(ch) {
 		word := l.readIdent()
 		switch word {
-		case "base64", "base64wide", "fullword", "wide", "ascii", "nocase", "xor", "private":
+		case "fullword", "wide", "ascii", "nocase", "private":
 			lval.str = word
 			return MODIFIER
+		case "base64", "base64wide", "xor":
+			lval.str = word + l.readModifierArgs()
+			return MODIFIER
 		default:
 			// Not a modifier — this belongs to the next section.
 			// Put the word back and pop mode.
 			l.pos -= len(word)
 			l.popMode()
-			return l.Lex(lval)
+			return l.lex(lval)
 		}
 	}
 
 	// Any other character means the string value + modifiers are done
 	l.popMode()
-	return l.Lex(lval)
+	return l.lex(lval)
+}
+
+// readModifierArgs reads an optional parenthesised argument list following a
+// modifier, as in xor(1-255) or base64("..."), and returns it including the
+// parentheses. Whitespace before the list is skipped only if a list follows.
+func (l *yaraLexer) readModifierArgs() string {
+	pos := l.pos
+	for pos < len(l.input) && (l.input[pos] == ' ' || l.input[pos] == '\t') {
+		pos++
+	}
+	if pos >= len(l.input) || l.input[pos] != '(' {
+		return ""
+	}
+	l.pos = pos
+	start := l.pos
+	for l.pos < len(l.input) && l.input[l.pos] != ')' {
+		if l.input[l.pos] == '"' {
+			l.readQuotedString()
+			continue
+		}
+		l.pos++
+	}
+	if l.pos < len(l.input) {
+		l.pos++ // skip )
+	}
+	return l.input[start:l.pos]
 }
 
 func (l *yaraLexer) lexHexString(lval *yySymType) int {
@@ -315,8 +458,8 @@ func (l *yaraLexer) lexHexString(lval *yySymType) int {
 	}
 
 	l.pos++
-	l.err = fmt.Sprintf("unexpected character %q in hex string", ch)
-	return 0
+	l.errorAt(l.pos-1, l.pos, "unexpected character in hex string")
+	return INVALID
 }
 
 func (l *yaraLexer) lexHexJumpToken(lval *yySymType) int {
@@ -372,6 +515,61 @@ func (l *yaraLexer) lexCondition(lval *yySymType) int {
 		}
 		l.pos++
 		return '='
+	case '!':
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+			l.pos += 2
+			return NEQ
+		}
+		return l.lexCondStringAttr(lval, STRING_LENGTH)
+	case '"':
+		lval.str = l.readQuotedString()
+		return STRING_LIT
+	case '/':
+		// Division is \, so a slash in a condition starts a regex.
+		lval.str = l.readRegex()
+		return REGEX_LIT
+	case '#':
+		return l.lexCondStringAttr(lval, STRING_COUNT)
+	case '@':
+		return l.lexCondStringAttr(lval, STRING_OFFSET)
+	case '.':
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '.' {
+			l.pos += 2
+			return DOTDOT
+		}
+		l.pos++
+		return '.'
+	case '[':
+		l.pos++
+		return '['
+	case ']':
+		l.pos++
+		return ']'
+	case '<':
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+			l.pos += 2
+			return LE
+		}
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '<' {
+			l.pos += 2
+			return SHL
+		}
+		l.pos++
+		return LT
+	case '>':
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
+			l.pos += 2
+			return GE
+		}
+		if l.pos+1 < len(l.input) && l.input[l.pos+1] == '>' {
+			l.pos += 2
+			return SHR
+		}
+		l.pos++
+		return GT
+	case '+', '-', '*', '\\', '%', '&', '|', '^', '~':
+		l.pos++
+		return int(ch)
 	case '$':
 		return l.lexCondStringRef(lval)
 	}
@@ -391,16 +589,46 @@ func (l *yaraLexer) lexCondition(lval *yySymType) int {
 			return AND
 		case "or":
 			return OR
+		case "not":
+			return NOT
 		case "at":
 			return AT
+		case "in":
+			return IN
+		case "filesize":
+			return FILESIZE
+		case "entrypoint":
+			return ENTRYPOINT
 		case "any":
 			return ANY
 		case "all":
 			return ALL
+		case "none":
+			return NONE
+		case "for":
+			return FOR
 		case "of":
 			return OF
 		case "them":
 			return THEM
+		case "contains":
+			return CONTAINS
+		case "icontains":
+			return ICONTAINS
+		case "startswith":
+			return STARTSWITH
+		case "istartswith":
+			return ISTARTSWITH
+		case "endswith":
+			return ENDSWITH
+		case "iendswith":
+			return IENDSWITH
+		case "iequals":
+			return IEQUALS
+		case "matches":
+			return MATCHES
+		case "rule", "private", "global":
+			return l.restartRule(word, lval)
 		default:
 			lval.str = word
 			return COND_IDENT
@@ -408,8 +636,8 @@ func (l *yaraLexer) lexCondition(lval *yySymType) int {
 	}
 
 	l.pos++
-	l.err = fmt.Sprintf("unexpected character %q in condition", ch)
-	return 0
+	l.errorAt(l.pos-1, l.pos, "unexpected character in condition")
+	return INVALID
 }
 
 func (l *yaraLexer) lexCondStringRef(lval *yySymType) int {
@@ -428,6 +656,15 @@ func (l *yaraLexer) lexCondStringRef(lval *yySymType) int {
 	return COND_STRING_ID
 }
 
+// lexCondStringAttr lexes a string count (#a), offset (@a) or length (!a)
+// reference. The identifier is returned with a $ prefix so it can be looked
+// up like a regular string reference.
+func (l *yaraLexer) lexCondStringAttr(lval *yySymType, tok int) int {
+	l.pos++ // skip #, @ or !
+	lval.str = "$" + l.readIdent()
+	return tok
+}
+
 func (l *yaraLexer) lexHexInt(lval *yySymType) int {
 	start := l.pos
 	l.pos += 2 // skip 0x
@@ -435,8 +672,8 @@ func (l *yaraLexer) lexHexInt(lval *yySymType) int {
 		l.pos++
 	}
 	s := l.input[start:l.pos]
-	v, _ := strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
-	lval.num = v
+	lval.num = l.parseInt(start, s[2:], 16, 1)
+	lval.str = s
 	return INT_LIT
 }
 
@@ -445,8 +682,30 @@ func (l *yaraLexer) lexCondInt(lval *yySymType) int {
 	for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
 		l.pos++
 	}
-	v, _ := strconv.ParseInt(l.input[start:l.pos], 10, 64)
-	lval.num = v
+	// A dot followed by a digit makes a float; "0..10" is a range.
+	if l.pos+1 < len(l.input) && l.input[l.pos] == '.' && isDigit(l.input[l.pos+1]) {
+		l.pos++
+		for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
+			l.pos++
+		}
+		lval.flt, _ = strconv.ParseFloat(l.input[start:l.pos], 64)
+		return FLOAT_LIT
+	}
+	digits := l.input[start:l.pos]
+	// Size suffixes: 200KB, 2MB
+	scale := int64(1)
+	if l.pos+1 < len(l.input) && l.input[l.pos+1] == 'B' {
+		switch l.input[l.pos] {
+		case 'K':
+			scale = 1024
+			l.pos += 2
+		case 'M':
+			scale = 1024 * 1024
+			l.pos += 2
+		}
+	}
+	lval.num = l.parseInt(start, digits, 10, scale)
+	lval.str = l.input[start:l.pos]
 	return INT_LIT
 }
 
@@ -458,11 +717,25 @@ func (l *yaraLexer) lexInt(lval *yySymType) int {
 	for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
 		l.pos++
 	}
-	v, _ := strconv.ParseInt(l.input[start:l.pos], 10, 64)
-	lval.num = v
+	lval.num = l.parseInt(start, l.input[start:l.pos], 10, 1)
 	return INT_LIT
 }
 
+// parseInt returns the integer s in base times scale, recording an error
+// about the token from start if it is malformed or overflows an int64.
+func (l *yaraLexer) parseInt(start int, s string, base int, scale int64) int64 {
+	v, err := strconv.ParseInt(s, base, 64)
+	switch {
+	case errors.Is(err, strconv.ErrRange) || v > math.MaxInt64/scale || v < math.MinInt64/scale:
+		l.errorAt(start, l.pos, "integer out of range")
+		return 0
+	case err != nil:
+		l.errorAt(start, l.pos, "invalid integer")
+		return 0
+	}
+	return v * scale
+}
+
 func isAlpha(c byte) bool {
 	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
 }
@@ -1,6 +1,9 @@
 package parser
 
-import "testing"
+import (
+	"slices"
+	"testing"
+)
 
 type tokenExpect struct {
 	tok int
@@ -118,6 +121,20 @@ func TestLexModifiers(t *testing.T) {
 	}
 }
 
+func TestLexModifierArgs(t *testing.T) {
+	tokens := collectTokens(`rule t { strings: $ = "x" xor (1-2) base64("a)b") private condition: any of them }`)
+	var mods []string
+	for _, tok := range tokens {
+		if tok.tok == MODIFIER {
+			mods = append(mods, tok.str)
+		}
+	}
+	expected := []string{"xor(1-2)", `base64("a)b")`, "private"}
+	if !slices.Equal(mods, expected) {
+		t.Errorf("expected %q, got %q", expected, mods)
+	}
+}
+
 func TestLexRegex(t *testing.T) {
 	tokens := collectTokens(`rule t { strings: $ = /pattern/sim condition: any of them }`)
 	var found bool
@@ -171,7 +188,7 @@ func TestLexMeta(t *testing.T) {
 }
 
 func TestLexError(t *testing.T) {
-	l := newLexer(`rule t { condition: @ }`)
+	l := newLexer(`rule t { condition: ? }`)
 	for {
 		var lval yySymType
 		tok := l.Lex(&lval)
@@ -179,7 +196,7 @@ func TestLexError(t *testing.T) {
 			break
 		}
 	}
-	if l.err == "" {
+	if len(l.errs) == 0 {
 		t.Error("expected lexer error for invalid character")
 	}
 }
@@ -213,6 +230,151 @@ func TestLexEqOperator(t *testing.T) {
 	}
 }
 
+func TestLexRelationalOperators(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: 1 != 2 and 1 < 2 and 1 <= 2 and 1 > 2 and 1 >= 2 }`)
+	var ops []int
+	for _, tok := range tokens {
+		switch tok.tok {
+		case EQ, NEQ, LT, LE, GT, GE:
+			ops = append(ops, tok.tok)
+		}
+	}
+	expected := []int{NEQ, LT, LE, GT, GE}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %d operators, got %d: %v", len(expected), len(ops), ops)
+	}
+	for i, op := range ops {
+		if op != expected[i] {
+			t.Errorf("operator %d: expected %d, got %d", i, expected[i], op)
+		}
+	}
+}
+
+func TestLexArithmeticOperators(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: 1 + 2 - 3 * 4 \ 5 % 6 & 7 | 8 ^ ~9 << 1 >> 2 }`)
+	var ops []int
+	for _, tok := range tokens {
+		switch tok.tok {
+		case RULE, IDENT, '{', '}', CONDITION, ':', INT_LIT:
+		default:
+			ops = append(ops, tok.tok)
+		}
+	}
+	expected := []int{'+', '-', '*', '\\', '%', '&', '|', '^', '~', SHL, SHR}
+	if len(ops) != len(expected) {
+		t.Fatalf("expected %d operators, got %d: %v", len(expected), len(ops), ops)
+	}
+	for i, op := range ops {
+		if op != expected[i] {
+			t.Errorf("operator %d: expected %d, got %d", i, expected[i], op)
+		}
+	}
+}
+
+func TestLexStringAttributes(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: #a > 3 and @b[1] < 100 and !c != 0 }`)
+	want := []tokenExpect{{tok: STRING_COUNT, str: "$a"}, {tok: STRING_OFFSET, str: "$b"}, {tok: STRING_LENGTH, str: "$c"}}
+	var got []tokenExpect
+	for _, tok := range tokens {
+		switch tok.tok {
+		case STRING_COUNT, STRING_OFFSET, STRING_LENGTH:
+			got = append(got, tokenExpect{tok: tok.tok, str: tok.str})
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestLexRange(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: $a in (0..1024) }`)
+	expected := []int{RULE, IDENT, '{', CONDITION, ':', COND_STRING_ID, IN, '(', INT_LIT, DOTDOT, INT_LIT, ')', '}'}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.tok != expected[i] {
+			t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+		}
+	}
+}
+
+func TestLexSizeSuffix(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{"200KB", 200 * 1024},
+		{"2MB", 2 * 1024 * 1024},
+		{"1024", 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tokens := collectTokens(`rule t { condition: filesize < ` + tt.input + ` }`)
+			expected := []int{RULE, IDENT, '{', CONDITION, ':', FILESIZE, LT, INT_LIT, '}'}
+			if len(tokens) != len(expected) {
+				t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+			}
+			for i, tok := range tokens {
+				if tok.tok != expected[i] {
+					t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+				}
+			}
+			if tokens[7].num != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, tokens[7].num)
+			}
+		})
+	}
+}
+
+func TestLexNone(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: none of them }`)
+	expected := []int{RULE, IDENT, '{', CONDITION, ':', NONE, OF, THEM, '}'}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.tok != expected[i] {
+			t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+		}
+	}
+}
+
+func TestLexForLoop(t *testing.T) {
+	tokens := collectTokens(`rule t { condition: for all i in (1..#a) : (@a[i] > 0) }`)
+	expected := []int{
+		RULE, IDENT, '{', CONDITION, ':',
+		FOR, ALL, COND_IDENT, IN, '(', INT_LIT, DOTDOT, STRING_COUNT, ')', ':',
+		'(', STRING_OFFSET, '[', COND_IDENT, ']', GT, INT_LIT, ')', '}',
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.tok != expected[i] {
+			t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+		}
+	}
+}
+
+func TestLexNot(t *testing.T) {
+	tokens := collectTokens(`rule t { strings: $ = "x" condition: $a and not $b }`)
+	var found bool
+	for _, tok := range tokens {
+		if tok.tok == NOT {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("NOT token not found")
+	}
+}
+
 func TestLexFuncCall(t *testing.T) {
 	tokens := collectTokens(`rule t { strings: $ = "x" condition: uint32be(0) == 0x46 }`)
 	var found bool
@@ -225,3 +387,32 @@ func TestLexFuncCall(t *testing.T) {
 		t.Error("function name COND_IDENT not found")
 	}
 }
+
+func TestLexImport(t *testing.T) {
+	tokens := collectTokens(`import "pe" rule t { condition: pe.sections[0].name }`)
+	expected := []int{IMPORT, STRING_LIT, RULE, IDENT, '{', CONDITION, ':', COND_IDENT, '.', COND_IDENT, '[', INT_LIT, ']', '.', COND_IDENT, '}'}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.tok != expected[i] {
+			t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+		}
+	}
+	if tokens[1].str != `"pe"` {
+		t.Errorf("expected import string %q, got %q", `"pe"`, tokens[1].str)
+	}
+}
+
+func TestLexInclude(t *testing.T) {
+	tokens := collectTokens(`include "common.yar" rule include_rule { condition: true }`)
+	expected := []int{INCLUDE, STRING_LIT, RULE, IDENT, '{', CONDITION, ':', COND_IDENT, '}'}
+	if len(tokens) != len(expected) {
+		t.Fatalf("expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+	for i, tok := range tokens {
+		if tok.tok != expected[i] {
+			t.Errorf("token %d: expected %d, got %d", i, expected[i], tok.tok)
+		}
+	}
+}
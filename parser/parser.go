@@ -3,7 +3,11 @@ package parser
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -12,34 +16,286 @@ import (
 
 //go:generate goyacc -o y.go yara.y
 
+// DefaultNamespace is the namespace of rules parsed without one.
+const DefaultNamespace = "default"
+
 // Parser parses YARA rules.
-type Parser struct{}
+type Parser struct {
+	fsys         fs.FS
+	partial      bool
+	keepIncludes bool
+}
+
+// Options configures a Parser.
+type Options struct {
+	// FS resolves the names passed to ParseFile and ParseFiles and the
+	// files named by include directives. Nil means the operating system's
+	// file system.
+	FS fs.FS
+
+	// Partial makes the Parse methods return the rules that parsed
+	// without errors along with the ErrorList, instead of a nil rule set.
+	Partial bool
+
+	// KeepIncludes makes the parser record the file names of include
+	// directives in RuleSet.Includes instead of parsing the files, as a
+	// formatter needs.
+	KeepIncludes bool
+}
+
+// Error is an error in YARA source, such as a syntax error or an include
+// that cannot be resolved.
+type Error struct {
+	File   string // empty for rules parsed from a string
+	Line   int    // line number, starting at 1
+	Column int    // column number in bytes, starting at 1
+	Token  string // offending token, empty at the end of the input
+	Msg    string
+}
+
+// Error formats the error as "file:line:column: message near token".
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		b.WriteByte(':')
+	}
+	fmt.Fprintf(&b, "%d:%d: %s", e.Line, e.Column, e.Msg)
+	if e.Token != "" {
+		fmt.Fprintf(&b, " near %q", e.Token)
+	}
+	return b.String()
+}
+
+// ErrorList is the list of errors the Parse methods return, in the order
+// they were found. After a syntax error the parser skips to the next rule,
+// so there is at most one error per rule.
+type ErrorList []*Error
+
+// Error formats the errors one per line.
+func (l ErrorList) Error() string {
+	lines := make([]string, len(l))
+	for i, e := range l {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors, for errors.As and errors.Is.
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// File is a rule file to parse into a namespace.
+type File struct {
+	Name      string
+	Namespace string // DefaultNamespace if empty
+}
 
 // New creates a new YARA parser.
 func New() *Parser {
 	return &Parser{}
 }
 
-// Parse parses YARA rules from a string.
+// NewWithOptions creates a new YARA parser with the given options.
+func NewWithOptions(opts Options) *Parser {
+	return &Parser{fsys: opts.FS, partial: opts.Partial, keepIncludes: opts.KeepIncludes}
+}
+
+// Parse parses YARA rules from a string. Include directives are resolved
+// relative to the current directory, or the root of Options.FS. Syntax
+// errors are returned as an ErrorList.
 func (p *Parser) Parse(input string) (*ast.RuleSet, error) {
+	rs, errs := p.parse(input, "", nil)
+	setNamespace(rs, DefaultNamespace)
+	return p.result(rs, errs)
+}
+
+// ParseFile parses YARA rules from a file. Include directives are
+// resolved relative to the directory of the including file.
+func (p *Parser) ParseFile(filename string) (*ast.RuleSet, error) {
+	return p.ParseFiles(File{Name: filename})
+}
+
+// ParseFiles parses several rule files into one rule set. The rules of
+// each file, and of the files it includes, are put in the file's
+// namespace, so rules in different namespaces may share names. Syntax
+// errors in all files are returned as one ErrorList.
+func (p *Parser) ParseFiles(files ...File) (*ast.RuleSet, error) {
+	rs := &ast.RuleSet{}
+	var errs ErrorList
+	for _, f := range files {
+		name := p.clean(f.Name)
+		content, err := p.readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		fileRules, fileErrs := p.parse(content, name, []string{name})
+		ns := f.Namespace
+		if ns == "" {
+			ns = DefaultNamespace
+		}
+		setNamespace(fileRules, ns)
+		mergeRuleSet(rs, fileRules)
+		errs = append(errs, fileErrs...)
+	}
+	return p.result(rs, errs)
+}
+
+// result returns the rules and errors of a parse as the Parse methods do.
+func (p *Parser) result(rs *ast.RuleSet, errs ErrorList) (*ast.RuleSet, error) {
+	if len(errs) == 0 {
+		return rs, nil
+	}
+	if p.partial {
+		return rs, errs
+	}
+	return nil, errs
+}
+
+func (p *Parser) readFile(filename string) (string, error) {
+	var content []byte
+	var err error
+	if p.fsys != nil {
+		content, err = fs.ReadFile(p.fsys, filename)
+	} else {
+		content, err = os.ReadFile(filename)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading file: %w", err)
+	}
+	return string(content), nil
+}
+
+// parse parses rules read from filename, or from a string if filename is
+// empty. It returns the rules that parsed without errors, including those
+// of included files, and the errors of all files. stack holds the files
+// being parsed, from the outermost to filename, to detect include cycles.
+func (p *Parser) parse(input, filename string, stack []string) (*ast.RuleSet, ErrorList) {
 	l := newLexer(input)
-	yyParse(l)
-	if l.err != "" {
-		return nil, fmt.Errorf("parse error: %s", l.err)
+	l.file = filename
+	l.keepIncludes = p.keepIncludes
+	l.include = func(name string) (*ast.RuleSet, ErrorList, error) {
+		path := p.resolve(filename, name)
+		if i := slices.Index(stack, path); i >= 0 {
+			cycle := append(slices.Clone(stack[i:]), path)
+			return nil, nil, fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+		content, err := p.readFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("include %q: %w", name, err)
+		}
+		rs, errs := p.parse(content, path, append(slices.Clip(stack), path))
+		return rs, errs, nil
 	}
+	yyParse(l)
 	if l.ruleSet == nil {
-		return &ast.RuleSet{}, nil
+		l.ruleSet = &ast.RuleSet{}
 	}
-	return l.ruleSet, nil
+	l.ruleSet.Comments = l.comments
+	return l.ruleSet, l.errs
 }
 
-// ParseFile parses YARA rules from a file.
-func (p *Parser) ParseFile(filename string) (*ast.RuleSet, error) {
-	content, err := os.ReadFile(filename)
+// resolve returns the name of a file included from filename: name itself
+// if it is absolute, or name relative to the directory of filename.
+func (p *Parser) resolve(filename, name string) string {
+	if p.fsys != nil {
+		return path.Join(path.Dir(filename), name)
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(filename), name)
+}
+
+// clean returns the canonical form of a file name, so that include cycles
+// are detected whichever way the files name each other.
+func (p *Parser) clean(filename string) string {
+	if p.fsys != nil {
+		return path.Clean(filename)
+	}
+	return filepath.Clean(filename)
+}
+
+// includeFile parses the file named by an include directive at offset
+// start and appends its imports and rules to rs, and its errors to the
+// lexer's. A file that cannot be included is an error at the directive.
+// With Options.KeepIncludes it only records the name in rs.Includes.
+func (l *yaraLexer) includeFile(rs *ast.RuleSet, name string, start int) {
+	if l.keepIncludes {
+		rs.Includes = append(rs.Includes, name)
+		return
+	}
+	included, errs, err := l.include(name)
 	if err != nil {
-		return nil, fmt.Errorf("reading file: %w", err)
+		l.addError(start, start, err.Error())
+		return
 	}
-	return p.Parse(string(content))
+	l.errs = append(l.errs, errs...)
+	mergeRuleSet(rs, included)
+}
+
+// mergeRuleSet appends the imports and rules of src to dst, skipping
+// imports dst already has.
+func mergeRuleSet(dst, src *ast.RuleSet) {
+	for _, name := range src.Imports {
+		if !slices.Contains(dst.Imports, name) {
+			dst.Imports = append(dst.Imports, name)
+		}
+	}
+	dst.Rules = append(dst.Rules, src.Rules...)
+}
+
+// setNamespace puts the rules of rs that have no namespace yet in ns.
+func setNamespace(rs *ast.RuleSet, ns string) {
+	for _, r := range rs.Rules {
+		if r.Namespace == "" {
+			r.Namespace = ns
+		}
+	}
+}
+
+// tokenSpan returns the span of the input between two token offsets.
+func tokenSpan(yylex yyLexer, start, end int) ast.Span {
+	return yylex.(*yaraLexer).span(start, end)
+}
+
+// joinSpans returns the span from the start of from to the end of to.
+func joinSpans(from, to ast.Span) ast.Span {
+	return ast.Span{File: from.File, Start: from.Start, End: to.End}
+}
+
+// newIntLit returns an IntLit for a condition integer written as text.
+func newIntLit(value int64, text string, span ast.Span) ast.IntLit {
+	lit := ast.IntLit{Value: value, Span: span}
+	lit.Hex = strings.HasPrefix(text, "0x") || strings.HasPrefix(text, "0X")
+	if strings.HasSuffix(text, "KB") || strings.HasSuffix(text, "MB") {
+		lit.Suffix = text[len(text)-2:]
+	}
+	return lit
+}
+
+// newBinaryExpr returns a BinaryExpr spanning both operands.
+func newBinaryExpr(op string, left, right ast.Expr) ast.BinaryExpr {
+	return ast.BinaryExpr{Op: op, Left: left, Right: right, Span: joinSpans(ast.SpanOf(left), ast.SpanOf(right))}
+}
+
+// newOfExpr returns an OfExpr over a set of strings or rules. Strings and
+// "them" start with $ or are "them"; anything else names rules.
+func newOfExpr(q ast.Quantifier, set []string, span ast.Span) ast.OfExpr {
+	e := ast.OfExpr{Quantifier: q, Span: span}
+	for _, name := range set {
+		if name == "them" || strings.HasPrefix(name, "$") {
+			e.Strings = append(e.Strings, name)
+		} else {
+			e.Rules = append(e.Rules, name)
+		}
+	}
+	return e
 }
 
 func unquoteString(s string) string {
@@ -142,3 +398,115 @@ func parseHexJump(s string) ast.HexJump {
 	n, _ := strconv.Atoi(s)
 	return ast.HexJump{Min: &n, Max: &n}
 }
+
+// conflictingModifiers lists the string modifier pairs that YARA refuses to
+// combine.
+var conflictingModifiers = [][2]string{
+	{"nocase", "xor"},
+	{"nocase", "base64"},
+	{"nocase", "base64wide"},
+	{"xor", "base64"},
+	{"xor", "base64wide"},
+}
+
+// applyModifier sets the modifier s on mods. The lexer passes arguments
+// along with the modifier name, as in xor(1-255) or base64("...").
+func applyModifier(mods *ast.StringModifiers, s string) error {
+	name, args, hasArgs := strings.Cut(s, "(")
+	name = strings.TrimSpace(name)
+	args = strings.TrimSpace(strings.TrimSuffix(args, ")"))
+
+	flags := modifierFlags(mods)
+	flag, ok := flags[name]
+	if !ok {
+		return fmt.Errorf("unsupported modifier: %s", name)
+	}
+	if *flag {
+		return fmt.Errorf("duplicate modifier: %s", name)
+	}
+	*flag = true
+
+	switch name {
+	case "xor":
+		mods.XorMin, mods.XorMax = 0, 255
+		if hasArgs {
+			lo, hi, err := parseXorRange(args)
+			if err != nil {
+				return err
+			}
+			mods.XorMin, mods.XorMax = lo, hi
+		}
+	case "base64", "base64wide":
+		if hasArgs {
+			alphabet := unquoteString(args)
+			if !strings.HasPrefix(args, `"`) || !validBase64Alphabet(alphabet) {
+				return fmt.Errorf("%s: alphabet must be a string of 64 distinct characters", name)
+			}
+			if mods.Base64Alphabet != "" && mods.Base64Alphabet != alphabet {
+				return fmt.Errorf("%s: alphabet differs from the one already given", name)
+			}
+			mods.Base64Alphabet = alphabet
+		}
+	default:
+		if hasArgs {
+			return fmt.Errorf("%s: modifier takes no arguments", name)
+		}
+	}
+
+	for _, pair := range conflictingModifiers {
+		if *flags[pair[0]] && *flags[pair[1]] {
+			return fmt.Errorf("modifiers %s and %s cannot be combined", pair[0], pair[1])
+		}
+	}
+	return nil
+}
+
+func modifierFlags(mods *ast.StringModifiers) map[string]*bool {
+	return map[string]*bool{
+		"ascii":      &mods.Ascii,
+		"wide":       &mods.Wide,
+		"nocase":     &mods.Nocase,
+		"fullword":   &mods.Fullword,
+		"private":    &mods.Private,
+		"xor":        &mods.Xor,
+		"base64":     &mods.Base64,
+		"base64wide": &mods.Base64Wide,
+	}
+}
+
+// parseXorRange parses the argument of xor(n) or xor(min-max), with keys
+// written in decimal or, like 0x1f, in hex.
+func parseXorRange(s string) (int, int, error) {
+	minStr, maxStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		maxStr = minStr
+	}
+	lo, err := strconv.ParseInt(strings.TrimSpace(minStr), 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("xor: invalid key %q", minStr)
+	}
+	hi, err := strconv.ParseInt(strings.TrimSpace(maxStr), 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("xor: invalid key %q", maxStr)
+	}
+	if lo < 0 || hi > 255 || lo > hi {
+		return 0, 0, fmt.Errorf("xor: invalid key range %d-%d", lo, hi)
+	}
+	return int(lo), int(hi), nil
+}
+
+// validBase64Alphabet reports whether s can serve as a base64 alphabet: 64
+// distinct bytes, none of them a line break.
+func validBase64Alphabet(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	var seen [256]bool
+	for i := 0; i < len(s); i++ {
+		if seen[s[i]] || s[i] == '\n' || s[i] == '\r' {
+			return false
+		}
+		seen[s[i]] = true
+	}
+	return true
+}
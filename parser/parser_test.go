@@ -1,14 +1,19 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"github.com/sansecio/yargo/ast"
 )
 
+// mustParse parses input and clears the spans of the result, for tests
+// comparing it with ASTs built by hand.
 func mustParse(t *testing.T, input string) *ast.RuleSet {
 	t.Helper()
 	p := New()
@@ -16,7 +21,45 @@ func mustParse(t *testing.T, input string) *ast.RuleSet {
 	if err != nil {
 		t.Fatalf("failed to parse: %v", err)
 	}
-	return rs
+	return clearSpans(reflect.ValueOf(rs)).Interface().(*ast.RuleSet)
+}
+
+// clearSpans returns a copy of v with all ast.Span values zeroed.
+func clearSpans(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		elem := clearSpans(v.Elem())
+		if v.Kind() == reflect.Pointer {
+			p := reflect.New(elem.Type())
+			p.Elem().Set(elem)
+			return p
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.Set(elem)
+		return out
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			out.Index(i).Set(clearSpans(v.Index(i)))
+		}
+		return out
+	case reflect.Struct:
+		out := reflect.New(v.Type()).Elem()
+		if v.Type() == reflect.TypeFor[ast.Span]() {
+			return out
+		}
+		for i := range v.NumField() {
+			out.Field(i).Set(clearSpans(v.Field(i)))
+		}
+		return out
+	}
+	return v
 }
 
 func TestParseMinimalRule(t *testing.T) {
@@ -29,8 +72,8 @@ func TestParseMinimalRule(t *testing.T) {
 	if r.Name != "test" {
 		t.Errorf("expected name 'test', got %q", r.Name)
 	}
-	if _, ok := r.Condition.(ast.AnyOf); !ok {
-		t.Errorf("expected condition AnyOf, got %T", r.Condition)
+	if _, ok := r.Condition.(ast.OfExpr); !ok {
+		t.Errorf("expected condition OfExpr, got %T", r.Condition)
 	}
 	if len(r.Strings) != 1 || r.Strings[0].Name != "$" {
 		t.Errorf("expected anonymous string, got %v", r.Strings)
@@ -136,11 +179,29 @@ func TestParseModifiers(t *testing.T) {
 		{`"x" base64 fullword`, ast.StringModifiers{Base64: true, Fullword: true}, false},
 		{`{ FF } base64`, ast.StringModifiers{Base64: true}, false},
 		{`"x" ascii`, ast.StringModifiers{Ascii: true}, false},
-		{`"x" wide`, ast.StringModifiers{}, true},
-		{`"x" nocase`, ast.StringModifiers{}, true},
-		{`"x" xor`, ast.StringModifiers{}, true},
-		{`"x" base64wide`, ast.StringModifiers{}, true},
-		{`"x" private`, ast.StringModifiers{}, true},
+		{`"x" wide`, ast.StringModifiers{Wide: true}, false},
+		{`"x" ascii wide`, ast.StringModifiers{Ascii: true, Wide: true}, false},
+		{`"x" nocase`, ast.StringModifiers{Nocase: true}, false},
+		{`"x" private`, ast.StringModifiers{Private: true}, false},
+		{`"x" xor`, ast.StringModifiers{Xor: true, XorMax: 255}, false},
+		{`"x" xor(7)`, ast.StringModifiers{Xor: true, XorMin: 7, XorMax: 7}, false},
+		{`"x" xor(1-31) wide`, ast.StringModifiers{Xor: true, XorMin: 1, XorMax: 31, Wide: true}, false},
+		{`"x" xor ( 1 - 2 )`, ast.StringModifiers{Xor: true, XorMin: 1, XorMax: 2}, false},
+		{`"x" xor(0x10)`, ast.StringModifiers{Xor: true, XorMin: 16, XorMax: 16}, false},
+		{`"x" xor(0x01-0xff)`, ast.StringModifiers{Xor: true, XorMin: 1, XorMax: 255}, false},
+		{`"x" base64wide`, ast.StringModifiers{Base64Wide: true}, false},
+		{`"x" base64 base64wide`, ast.StringModifiers{Base64: true, Base64Wide: true}, false},
+		{`"x" base64("ZYXWVUTSRQPONMLKJIHGFEDCBAzyxwvutsrqponmlkjihgfedcba9876543210+/")`, ast.StringModifiers{Base64: true, Base64Alphabet: "ZYXWVUTSRQPONMLKJIHGFEDCBAzyxwvutsrqponmlkjihgfedcba9876543210+/"}, false},
+		{`"x" xor(256)`, ast.StringModifiers{}, true},
+		{`"x" xor(9-3)`, ast.StringModifiers{}, true},
+		{`"x" xor(a)`, ast.StringModifiers{}, true},
+		{`"x" base64("short")`, ast.StringModifiers{}, true},
+		{`"x" base64("AACDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/")`, ast.StringModifiers{}, true},
+		{`"x" wide(1)`, ast.StringModifiers{}, true},
+		{`"x" wide wide`, ast.StringModifiers{}, true},
+		{`"x" nocase xor`, ast.StringModifiers{}, true},
+		{`"x" xor base64`, ast.StringModifiers{}, true},
+		{`"x" base64wide nocase`, ast.StringModifiers{}, true},
 	}
 
 	for _, tt := range tests {
@@ -204,6 +265,42 @@ func TestParseMultipleRules(t *testing.T) {
 	}
 }
 
+func TestParseRuleModifiersAndTags(t *testing.T) {
+	rs := mustParse(t, `
+		rule plain { condition: true_cond }
+		private rule hidden : internal { condition: true_cond }
+		global rule gate { condition: true_cond }
+		global private rule both : a b_2 C { condition: true_cond }
+		rule tagged : webshell php { meta: a = 1 condition: true_cond }
+	`)
+
+	tests := []struct {
+		name    string
+		tags    []string
+		private bool
+		global  bool
+	}{
+		{"plain", nil, false, false},
+		{"hidden", []string{"internal"}, true, false},
+		{"gate", nil, false, true},
+		{"both", []string{"a", "b_2", "C"}, true, true},
+		{"tagged", []string{"webshell", "php"}, false, false},
+	}
+	if len(rs.Rules) != len(tests) {
+		t.Fatalf("expected %d rules, got %d", len(tests), len(rs.Rules))
+	}
+	for i, tt := range tests {
+		r := rs.Rules[i]
+		if r.Name != tt.name || !reflect.DeepEqual(r.Tags, tt.tags) || r.Private != tt.private || r.Global != tt.global {
+			t.Errorf("rule %d: got %q tags=%q private=%v global=%v, want %q tags=%q private=%v global=%v",
+				i, r.Name, r.Tags, r.Private, r.Global, tt.name, tt.tags, tt.private, tt.global)
+		}
+	}
+	if len(rs.Rules[4].Meta) != 1 {
+		t.Errorf("expected meta on tagged rule, got %v", rs.Rules[4].Meta)
+	}
+}
+
 func TestParseComments(t *testing.T) {
 	inputs := []string{
 		`// comment
@@ -251,6 +348,280 @@ func TestParseFileNotFound(t *testing.T) {
 	}
 }
 
+func TestParseInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.yar":            {Data: []byte(`import "pe" include "lib/common.yar" rule main { condition: is_php }`)},
+		"lib/common.yar":      {Data: []byte(`import "math" include "helpers/php.yar" rule common { condition: filesize > 0 }`)},
+		"lib/helpers/php.yar": {Data: []byte(`import "pe" rule is_php { strings: $ = "<?php" condition: $ }`)},
+		"cycle/a.yar":         {Data: []byte(`include "b.yar"`)},
+		"cycle/b.yar":         {Data: []byte(`include "../cycle/a.yar"`)},
+		"missing.yar":         {Data: []byte(`rule m { condition: filesize > 0 } include "nope.yar"`)},
+		"bad/main.yar":        {Data: []byte(`include "syntax.yar"`)},
+		"bad/syntax.yar":      {Data: []byte(`rule { condition: true }`)},
+		"string/included.yar": {Data: []byte(`rule included { condition: filesize > 0 }`)},
+	}
+	p := NewWithOptions(Options{FS: fsys})
+
+	rs, err := p.ParseFile("main.yar")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	var names []string
+	for _, r := range rs.Rules {
+		names = append(names, r.Name)
+		if r.Namespace != DefaultNamespace {
+			t.Errorf("rule %s: namespace %q, want %q", r.Name, r.Namespace, DefaultNamespace)
+		}
+	}
+	if want := []string{"is_php", "common", "main"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("rules = %q, want %q", names, want)
+	}
+	if want := []string{"pe", "math"}; !reflect.DeepEqual(rs.Imports, want) {
+		t.Errorf("imports = %q, want %q", rs.Imports, want)
+	}
+
+	rs, err = p.Parse(`include "string/included.yar" rule main { condition: included }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(rs.Rules) != 2 || rs.Rules[0].Name != "included" {
+		t.Errorf("unexpected rules from string: %+v", rs.Rules)
+	}
+
+	errTests := []struct {
+		file string
+		want string
+	}{
+		{"cycle/a.yar", "cycle/b.yar:1:9: include cycle: cycle/a.yar -> cycle/b.yar -> cycle/a.yar"},
+		{"missing.yar", `missing.yar:1:44: include "nope.yar": reading file: open nope.yar: file does not exist`},
+		{"bad/main.yar", `bad/syntax.yar:1:6: syntax error near "{"`},
+	}
+	for _, tt := range errTests {
+		if _, err := p.ParseFile(tt.file); err == nil || err.Error() != tt.want {
+			t.Errorf("ParseFile(%q) error = %v, want %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestParseFilesNamespaces(t *testing.T) {
+	fsys := fstest.MapFS{
+		"php.yar":    {Data: []byte(`include "shared.yar" rule webshell { condition: shared }`)},
+		"js.yar":     {Data: []byte(`rule webshell { condition: filesize > 0 }`)},
+		"shared.yar": {Data: []byte(`rule shared { condition: filesize > 0 }`)},
+	}
+	rs, err := NewWithOptions(Options{FS: fsys}).ParseFiles(
+		File{Name: "php.yar", Namespace: "php"},
+		File{Name: "js.yar"},
+		File{Name: "shared.yar", Namespace: "shared"},
+	)
+	if err != nil {
+		t.Fatalf("ParseFiles() error = %v", err)
+	}
+	var got []string
+	for _, r := range rs.Rules {
+		got = append(got, r.Namespace+":"+r.Name)
+	}
+	want := []string{"php:shared", "php:webshell", "default:webshell", "shared:shared"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	src := "rule a { condition: true_cond }\n" +
+		"private rule spans : tag {\n" +
+		"  meta:\n" +
+		"    author = \"me\"\n" +
+		"  strings:\n" +
+		"    $a = \"abc\" wide nocase\n" +
+		"    $h = { 4D 5A ?? }\n" +
+		"  condition:\n" +
+		"    $a at 0 and\n" +
+		"    2 of ($a, $h)\n" +
+		"}\n"
+	fsys := fstest.MapFS{"spans.yar": {Data: []byte(src)}}
+	rs, err := NewWithOptions(Options{FS: fsys}).ParseFile("spans.yar")
+	if err != nil {
+		t.Fatalf("ParseFile() error = %v", err)
+	}
+	r := rs.Rules[1]
+	cond := r.Condition.(ast.BinaryExpr)
+	hex := r.Strings[1].Value.(ast.HexString)
+
+	tests := []struct {
+		name string
+		span ast.Span
+		text string
+	}{
+		{"rule", r.Span, src[32 : len(src)-1]},
+		{"meta", r.Meta[0].Span, `author = "me"`},
+		{"string", r.Strings[0].Span, `$a = "abc" wide nocase`},
+		{"hex string", r.Strings[1].Span, `$h = { 4D 5A ?? }`},
+		{"hex value", hex.Span, `{ 4D 5A ?? }`},
+		{"hex wildcard", hex.Tokens[2].(ast.HexWildcard).Span, `??`},
+		{"condition", cond.Span, "$a at 0 and\n    2 of ($a, $h)"},
+		{"at", ast.SpanOf(cond.Left), "$a at 0"},
+		{"at ref", cond.Left.(ast.AtExpr).Ref.Span, "$a"},
+		{"of", ast.SpanOf(cond.Right), "2 of ($a, $h)"},
+	}
+	for _, tt := range tests {
+		if tt.span.File != "spans.yar" {
+			t.Errorf("%s: file = %q, want %q", tt.name, tt.span.File, "spans.yar")
+		}
+		if got := src[tt.span.Start.Offset:tt.span.End.Offset]; got != tt.text {
+			t.Errorf("%s: spans %q, want %q", tt.name, got, tt.text)
+		}
+	}
+
+	if got, want := r.Span.Start, (ast.Position{Offset: 32, Line: 2, Column: 1}); got != want {
+		t.Errorf("rule start = %+v, want %+v", got, want)
+	}
+	if got, want := ast.SpanOf(cond.Right).Start, (ast.Position{Offset: 178, Line: 10, Column: 5}); got != want {
+		t.Errorf("of start = %+v, want %+v", got, want)
+	}
+	if got, want := r.Span.End, (ast.Position{Offset: len(src) - 1, Line: 11, Column: 2}); got != want {
+		t.Errorf("rule end = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Error
+	}{
+		{
+			"rule a {\n  condition:\n    $a and\n}",
+			Error{Line: 4, Column: 1, Token: "}", Msg: "syntax error"},
+		},
+		{
+			"rule a { condition: true_cond }\nrule b { condition: ? }",
+			Error{Line: 2, Column: 21, Token: "?", Msg: "unexpected character in condition"},
+		},
+		{
+			"rule a { strings: $a = \"x\" xor(3-1) condition: $a }",
+			Error{Line: 1, Column: 28, Token: "xor(3-1)", Msg: "xor: invalid key range 3-1"},
+		},
+		{
+			"rule a { condition: $a",
+			Error{Line: 1, Column: 23, Msg: "syntax error"},
+		},
+		{
+			"rule a { condition: $a }\n\t#",
+			Error{Line: 2, Column: 2, Token: "#", Msg: "unexpected character"},
+		},
+		{
+			"rule a { condition: filesize < 9223372036854775808 }",
+			Error{Line: 1, Column: 32, Token: "9223372036854775808", Msg: "integer out of range"},
+		},
+		{
+			"rule a { condition: filesize < 9007199254740992KB }",
+			Error{Line: 1, Column: 32, Token: "9007199254740992KB", Msg: "integer out of range"},
+		},
+		{
+			"rule a { condition: filesize < 8796093022208MB }",
+			Error{Line: 1, Column: 32, Token: "8796093022208MB", Msg: "integer out of range"},
+		},
+		{
+			"rule a { condition: filesize < 0x10000000000000000 }",
+			Error{Line: 1, Column: 32, Token: "0x10000000000000000", Msg: "integer out of range"},
+		},
+		{
+			"rule a { meta: n = -9223372036854775809 condition: true_cond }",
+			Error{Line: 1, Column: 20, Token: "-9223372036854775809", Msg: "integer out of range"},
+		},
+	}
+	for _, tt := range tests {
+		_, err := New().Parse(tt.input)
+		var perr *Error
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q) error = %v, want *Error", tt.input, err)
+			continue
+		}
+		if *perr != tt.want {
+			t.Errorf("Parse(%q) error = %+v, want %+v", tt.input, *perr, tt.want)
+		}
+	}
+
+	_, err := New().Parse("rule a { condition: ? }")
+	if want := `1:21: unexpected character in condition near "?"`; err == nil || err.Error() != want {
+		t.Errorf("error = %v, want %q", err, want)
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	input := `rule a { condition: ? }
+rule b { condition: true_cond }
+rule c {
+  strings:
+    $x = "x"
+  condition:
+    $x and
+rule d { strings: $y = "y" xor(3-1) condition: $y }
+import "pe"
+rule e { condition: pe.is_dll() }
+rule f { meta: 12 condition: true_cond }
+`
+	_, err := New().Parse(input)
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("Parse() error = %v, want ErrorList", err)
+	}
+	want := ErrorList{
+		{Line: 1, Column: 21, Token: "?", Msg: "unexpected character in condition"},
+		{Line: 8, Column: 1, Token: "rule", Msg: "syntax error"},
+		{Line: 8, Column: 28, Token: "xor(3-1)", Msg: "xor: invalid key range 3-1"},
+		{Line: 11, Column: 16, Token: "12", Msg: "syntax error"},
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Parse() error =\n%v\nwant %d errors", err, len(want))
+	}
+	for i := range want {
+		if *errs[i] != *want[i] {
+			t.Errorf("error %d = %+v, want %+v", i, *errs[i], *want[i])
+		}
+	}
+
+	rs, err := NewWithOptions(Options{Partial: true}).Parse(input)
+	if !errors.As(err, &errs) || len(errs) != len(want) {
+		t.Fatalf("partial Parse() error = %v", err)
+	}
+	var names []string
+	for _, r := range rs.Rules {
+		names = append(names, r.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "e"}) {
+		t.Errorf("partial rules = %q, want [b e]", names)
+	}
+	if !reflect.DeepEqual(rs.Imports, []string{"pe"}) {
+		t.Errorf("partial imports = %q, want [pe]", rs.Imports)
+	}
+}
+
+func TestParseFilesErrorRecovery(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.yar":   {Data: []byte("include \"inc.yar\"\ninclude \"missing.yar\"\nrule a { condition: ? }\n")},
+		"inc.yar": {Data: []byte("rule inc { condition: }\nrule ok { condition: true_cond }\n")},
+		"b.yar":   {Data: []byte("rule b {")},
+	}
+	p := NewWithOptions(Options{FS: fsys, Partial: true})
+	rs, err := p.ParseFiles(File{Name: "a.yar"}, File{Name: "b.yar"})
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("ParseFiles() error = %v, want ErrorList", err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, fmt.Sprintf("%s:%d:%d", e.File, e.Line, e.Column))
+	}
+	want := []string{"inc.yar:1:23", "a.yar:2:9", "a.yar:3:21", "b.yar:1:9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("error positions = %q, want %q\n%v", got, want, err)
+	}
+	if len(rs.Rules) != 1 || rs.Rules[0].Name != "ok" {
+		t.Errorf("partial rules = %+v, want only ok", rs.Rules)
+	}
+}
+
 func TestParseConditionWithParens(t *testing.T) {
 	// Test that complex conditions with parens are parsed correctly
 	rs := mustParse(t, `rule test { strings: $a = "x" condition: ($a at 0) and any of them }`)
@@ -263,6 +634,429 @@ func TestParseConditionWithParens(t *testing.T) {
 	}
 }
 
+func TestParseNot(t *testing.T) {
+	rs := mustParse(t, `rule test { strings: $a = "x" $b = "y" condition: $a and not $b }`)
+	bin, ok := rs.Rules[0].Condition.(ast.BinaryExpr)
+	if !ok || bin.Op != "and" {
+		t.Fatalf("expected 'and' BinaryExpr, got %#v", rs.Rules[0].Condition)
+	}
+	not, ok := bin.Right.(ast.UnaryExpr)
+	if !ok || not.Op != "not" {
+		t.Fatalf("expected 'not' UnaryExpr, got %#v", bin.Right)
+	}
+	if ref, ok := not.Operand.(ast.StringRef); !ok || ref.Name != "$b" {
+		t.Errorf("expected operand $b, got %#v", not.Operand)
+	}
+}
+
+func TestParseImports(t *testing.T) {
+	rs := mustParse(t, `
+		import "pe"
+		import "math"
+		rule one { condition: pe.is_dll() }
+		import "pe"
+		rule two { condition: math.entropy(0, filesize) > 7 }
+	`)
+	if want := []string{"pe", "math"}; !reflect.DeepEqual(rs.Imports, want) {
+		t.Errorf("expected imports %q, got %q", want, rs.Imports)
+	}
+	if len(rs.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rs.Rules))
+	}
+}
+
+func TestParseModuleAccess(t *testing.T) {
+	tests := []struct {
+		cond string
+		want ast.Expr
+	}{
+		{
+			`pe.machine`,
+			ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "machine"},
+		},
+		{
+			`pe.sections[1].name`,
+			ast.MemberExpr{
+				Object: ast.IndexExpr{
+					Object: ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "sections"},
+					Index:  ast.IntLit{Value: 1},
+				},
+				Member: "name",
+			},
+		},
+		{
+			`pe.exports(2 + 1)`,
+			ast.CallExpr{
+				Func: ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "exports"},
+				Args: []ast.Expr{ast.BinaryExpr{Op: "+", Left: ast.IntLit{Value: 2}, Right: ast.IntLit{Value: 1}}},
+			},
+		},
+		{
+			`pe.rich_signature.toolid(1, 2) == 3`,
+			ast.BinaryExpr{
+				Op: "==",
+				Left: ast.CallExpr{
+					Func: ast.MemberExpr{Object: ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "rich_signature"}, Member: "toolid"},
+					Args: []ast.Expr{ast.IntLit{Value: 1}, ast.IntLit{Value: 2}},
+				},
+				Right: ast.IntLit{Value: 3},
+			},
+		},
+		{
+			`pe.imports("kernel32.dll", "Virtual\x41lloc")`,
+			ast.CallExpr{
+				Func: ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "imports"},
+				Args: []ast.Expr{ast.StringLit{Value: "kernel32.dll"}, ast.StringLit{Value: "VirtualAlloc"}},
+			},
+		},
+		{
+			`uint16(pe.entry_point) == 0x5a4d`,
+			ast.BinaryExpr{
+				Op:    "==",
+				Left:  ast.FuncCall{Name: "uint16", Args: []ast.Expr{ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "entry_point"}}},
+				Right: ast.IntLit{Value: 0x5a4d, Hex: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			rs := mustParse(t, `import "pe" rule test { condition: `+tt.cond+` }`)
+			if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	tests := []struct {
+		cond string
+		want ast.Expr
+	}{
+		{
+			`math.entropy(0, filesize) > 7.25`,
+			ast.BinaryExpr{
+				Op: ">",
+				Left: ast.CallExpr{
+					Func: ast.MemberExpr{Object: ast.Ident{Name: "math"}, Member: "entropy"},
+					Args: []ast.Expr{ast.IntLit{Value: 0}, ast.Filesize{}},
+				},
+				Right: ast.FloatLit{Value: 7.25},
+			},
+		},
+		{
+			`filesize * 0.5 < 10`,
+			ast.BinaryExpr{
+				Op:    "<",
+				Left:  ast.BinaryExpr{Op: "*", Left: ast.Filesize{}, Right: ast.FloatLit{Value: 0.5}},
+				Right: ast.IntLit{Value: 10},
+			},
+		},
+		{
+			`-1.0 < 0`,
+			ast.BinaryExpr{Op: "<", Left: ast.UnaryExpr{Op: "-", Operand: ast.FloatLit{Value: 1}}, Right: ast.IntLit{Value: 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			rs := mustParse(t, `import "math" rule test { condition: `+tt.cond+` }`)
+			if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+
+	// A range's dots still follow an integer.
+	rs := mustParse(t, `rule test { condition: for any i in (0..10) : (i == 5) }`)
+	if _, ok := rs.Rules[0].Condition.(ast.ForInExpr); !ok {
+		t.Errorf("expected ForInExpr, got %#v", rs.Rules[0].Condition)
+	}
+}
+
+func TestParseStringOperators(t *testing.T) {
+	for _, op := range []string{"contains", "icontains", "startswith", "istartswith", "endswith", "iendswith", "iequals"} {
+		t.Run(op, func(t *testing.T) {
+			rs := mustParse(t, `rule test { condition: platform `+op+` "magento" and $a }`)
+			want := ast.BinaryExpr{
+				Op:    "and",
+				Left:  ast.BinaryExpr{Op: op, Left: ast.Ident{Name: "platform"}, Right: ast.StringLit{Value: "magento"}},
+				Right: ast.StringRef{Name: "$a"},
+			}
+			if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %#v, got %#v", want, got)
+			}
+		})
+	}
+
+	rs := mustParse(t, `rule test { condition: pe.sections[0].name matches /^\.te?xt\//is or path matches /a/ }`)
+	want := ast.BinaryExpr{
+		Op: "or",
+		Left: ast.BinaryExpr{
+			Op: "matches",
+			Left: ast.MemberExpr{
+				Object: ast.IndexExpr{
+					Object: ast.MemberExpr{Object: ast.Ident{Name: "pe"}, Member: "sections"},
+					Index:  ast.IntLit{Value: 0},
+				},
+				Member: "name",
+			},
+			Right: ast.RegexLit{Pattern: `^\.te?xt\/`, Modifiers: ast.RegexModifiers{CaseInsensitive: true, DotMatchesAll: true}},
+		},
+		Right: ast.BinaryExpr{Op: "matches", Left: ast.Ident{Name: "path"}, Right: ast.RegexLit{Pattern: "a"}},
+	}
+	if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v, got %#v", want, got)
+	}
+}
+
+func TestParseRuleSets(t *testing.T) {
+	tests := []struct {
+		cond string
+		want ast.OfExpr
+	}{
+		{`any of (is_php)`, ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Rules: []string{"is_php"}}},
+		{`all of (webshell_*)`, ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAll}, Rules: []string{"webshell_*"}}},
+		{`2 of (a, b*, c)`, ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.IntLit{Value: 2}}, Rules: []string{"a", "b*", "c"}}},
+		{`none of ($a, $b*)`, ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantNone}, Strings: []string{"$a", "$b*"}}},
+	}
+	for _, tt := range tests {
+		rs := mustParse(t, `rule test { condition: `+tt.cond+` }`)
+		if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %#v, got %#v", tt.cond, tt.want, got)
+		}
+	}
+}
+
+func TestParseBooleanPrecedence(t *testing.T) {
+	tests := []struct {
+		name string
+		cond string
+		want ast.Expr
+	}{
+		{
+			"and binds tighter than or",
+			`$a or $b and $c`,
+			ast.BinaryExpr{Op: "or", Left: ast.StringRef{Name: "$a"}, Right: ast.BinaryExpr{Op: "and", Left: ast.StringRef{Name: "$b"}, Right: ast.StringRef{Name: "$c"}}},
+		},
+		{
+			"not binds tighter than and",
+			`not $a and $b`,
+			ast.BinaryExpr{Op: "and", Left: ast.UnaryExpr{Op: "not", Operand: ast.StringRef{Name: "$a"}}, Right: ast.StringRef{Name: "$b"}},
+		},
+		{
+			"not applies to comparison",
+			`not uint8(0) == 1`,
+			ast.UnaryExpr{Op: "not", Operand: ast.BinaryExpr{Op: "==", Left: ast.FuncCall{Name: "uint8", Args: []ast.Expr{ast.IntLit{Value: 0}}}, Right: ast.IntLit{Value: 1}}},
+		},
+		{
+			"not of parenthesized or",
+			`$a and not ($b or $c)`,
+			ast.BinaryExpr{Op: "and", Left: ast.StringRef{Name: "$a"}, Right: ast.UnaryExpr{Op: "not", Operand: ast.ParenExpr{Inner: ast.BinaryExpr{Op: "or", Left: ast.StringRef{Name: "$b"}, Right: ast.StringRef{Name: "$c"}}}}},
+		},
+		{
+			"comparison binds tighter than and",
+			`uint16(0) != 0x5A4D and uint8(2) >= 3`,
+			ast.BinaryExpr{
+				Op:    "and",
+				Left:  ast.BinaryExpr{Op: "!=", Left: ast.FuncCall{Name: "uint16", Args: []ast.Expr{ast.IntLit{Value: 0}}}, Right: ast.IntLit{Value: 0x5A4D, Hex: true}},
+				Right: ast.BinaryExpr{Op: ">=", Left: ast.FuncCall{Name: "uint8", Args: []ast.Expr{ast.IntLit{Value: 2}}}, Right: ast.IntLit{Value: 3}},
+			},
+		},
+		{
+			"relational binds tighter than equality",
+			`1 < 2 == 1`,
+			ast.BinaryExpr{Op: "==", Left: ast.BinaryExpr{Op: "<", Left: ast.IntLit{Value: 1}, Right: ast.IntLit{Value: 2}}, Right: ast.IntLit{Value: 1}},
+		},
+		{
+			"multiplication binds tighter than addition",
+			`1 + 2 * 3 == 7`,
+			ast.BinaryExpr{Op: "==", Left: ast.BinaryExpr{Op: "+", Left: ast.IntLit{Value: 1}, Right: ast.BinaryExpr{Op: "*", Left: ast.IntLit{Value: 2}, Right: ast.IntLit{Value: 3}}}, Right: ast.IntLit{Value: 7}},
+		},
+		{
+			"bitwise and binds looser than arithmetic",
+			`uint32(uint32(0x3C) + 0x18) & 0xFFFF == 0x10B`,
+			ast.BinaryExpr{
+				Op: "==",
+				Left: ast.BinaryExpr{
+					Op: "&",
+					Left: ast.FuncCall{Name: "uint32", Args: []ast.Expr{ast.BinaryExpr{
+						Op:    "+",
+						Left:  ast.FuncCall{Name: "uint32", Args: []ast.Expr{ast.IntLit{Value: 0x3C, Hex: true}}},
+						Right: ast.IntLit{Value: 0x18, Hex: true},
+					}}},
+					Right: ast.IntLit{Value: 0xFFFF, Hex: true},
+				},
+				Right: ast.IntLit{Value: 0x10B, Hex: true},
+			},
+		},
+		{
+			"subtraction is left associative",
+			`10 - 4 - 3 == 3`,
+			ast.BinaryExpr{Op: "==", Left: ast.BinaryExpr{Op: "-", Left: ast.BinaryExpr{Op: "-", Left: ast.IntLit{Value: 10}, Right: ast.IntLit{Value: 4}}, Right: ast.IntLit{Value: 3}}, Right: ast.IntLit{Value: 3}},
+		},
+		{
+			"unary minus binds tightest",
+			`-1 * 2 < 0`,
+			ast.BinaryExpr{Op: "<", Left: ast.BinaryExpr{Op: "*", Left: ast.UnaryExpr{Op: "-", Operand: ast.IntLit{Value: 1}}, Right: ast.IntLit{Value: 2}}, Right: ast.IntLit{Value: 0}},
+		},
+		{
+			"shift binds tighter than bitwise or",
+			`1 << 4 | 1 == 17`,
+			ast.BinaryExpr{Op: "==", Left: ast.BinaryExpr{Op: "|", Left: ast.BinaryExpr{Op: "<<", Left: ast.IntLit{Value: 1}, Right: ast.IntLit{Value: 4}}, Right: ast.IntLit{Value: 1}}, Right: ast.IntLit{Value: 17}},
+		},
+		{
+			"at takes an arithmetic offset",
+			`$a at 2 + 2 and $b`,
+			ast.BinaryExpr{Op: "and", Left: ast.AtExpr{Ref: ast.StringRef{Name: "$a"}, Pos: ast.BinaryExpr{Op: "+", Left: ast.IntLit{Value: 2}, Right: ast.IntLit{Value: 2}}}, Right: ast.StringRef{Name: "$b"}},
+		},
+		{
+			"match count",
+			`#a > 3`,
+			ast.BinaryExpr{Op: ">", Left: ast.StringCount{Name: "$a"}, Right: ast.IntLit{Value: 3}},
+		},
+		{
+			"indexed match offset",
+			`@a[1] < 100`,
+			ast.BinaryExpr{Op: "<", Left: ast.StringOffset{Name: "$a", Index: ast.IntLit{Value: 1}}, Right: ast.IntLit{Value: 100}},
+		},
+		{
+			"match offset without index",
+			`@a == 0`,
+			ast.BinaryExpr{Op: "==", Left: ast.StringOffset{Name: "$a"}, Right: ast.IntLit{Value: 0}},
+		},
+		{
+			"match length with expression index",
+			`!a[#a] + @a[#a] == 10`,
+			ast.BinaryExpr{
+				Op:    "==",
+				Left:  ast.BinaryExpr{Op: "+", Left: ast.StringLength{Name: "$a", Index: ast.StringCount{Name: "$a"}}, Right: ast.StringOffset{Name: "$a", Index: ast.StringCount{Name: "$a"}}},
+				Right: ast.IntLit{Value: 10},
+			},
+		},
+		{
+			"match length is not inequality",
+			`!a != 4`,
+			ast.BinaryExpr{Op: "!=", Left: ast.StringLength{Name: "$a"}, Right: ast.IntLit{Value: 4}},
+		},
+		{
+			"in range",
+			`$a in (0..1024) and $b`,
+			ast.BinaryExpr{Op: "and", Left: ast.InExpr{Ref: ast.StringRef{Name: "$a"}, Range: ast.Range{Start: ast.IntLit{Value: 0}, End: ast.IntLit{Value: 1024}}}, Right: ast.StringRef{Name: "$b"}},
+		},
+		{
+			"in range with computed bounds",
+			`$a in (@b[1] + 1..@c - 1)`,
+			ast.InExpr{Ref: ast.StringRef{Name: "$a"}, Range: ast.Range{
+				Start: ast.BinaryExpr{Op: "+", Left: ast.StringOffset{Name: "$b", Index: ast.IntLit{Value: 1}}, Right: ast.IntLit{Value: 1}},
+				End:   ast.BinaryExpr{Op: "-", Left: ast.StringOffset{Name: "$c"}, Right: ast.IntLit{Value: 1}},
+			}},
+		},
+		{
+			"filesize with size suffix",
+			`filesize < 2MB and $a`,
+			ast.BinaryExpr{Op: "and", Left: ast.BinaryExpr{Op: "<", Left: ast.Filesize{}, Right: ast.IntLit{Value: 2 * 1024 * 1024, Suffix: "MB"}}, Right: ast.StringRef{Name: "$a"}},
+		},
+		{
+			"at entrypoint",
+			`$a at entrypoint`,
+			ast.AtExpr{Ref: ast.StringRef{Name: "$a"}, Pos: ast.Entrypoint{}},
+		},
+		{
+			"count quantifier",
+			`3 of them`,
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.IntLit{Value: 3}}, Strings: []string{"them"}},
+		},
+		{
+			"percentage quantifier",
+			`50% of ($a*)`,
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantPercent, Value: ast.IntLit{Value: 50}}, Strings: []string{"$a*"}},
+		},
+		{
+			"none quantifier",
+			`none of them`,
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantNone}, Strings: []string{"them"}},
+		},
+		{
+			"explicit string set",
+			`any of ($a, $b, $c*)`,
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"$a", "$b", "$c*"}},
+		},
+		{
+			"quantifier binds tighter than and",
+			`$a and 2 of ($b, $c)`,
+			ast.BinaryExpr{Op: "and", Left: ast.StringRef{Name: "$a"}, Right: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.IntLit{Value: 2}}, Strings: []string{"$b", "$c"}}},
+		},
+		{
+			"computed count quantifier",
+			`#a - 1 of them`,
+			ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.BinaryExpr{Op: "-", Left: ast.StringCount{Name: "$a"}, Right: ast.IntLit{Value: 1}}}, Strings: []string{"them"}},
+		},
+		{
+			"modulo is not a percentage",
+			`5 % 3 == 2`,
+			ast.BinaryExpr{Op: "==", Left: ast.BinaryExpr{Op: "%", Left: ast.IntLit{Value: 5}, Right: ast.IntLit{Value: 3}}, Right: ast.IntLit{Value: 2}},
+		},
+		{
+			"for of string set",
+			`for any of ($a*) : (@ < 100)`,
+			ast.ForOfExpr{
+				Quantifier: ast.Quantifier{Kind: ast.QuantAny},
+				Strings:    []string{"$a*"},
+				Body:       ast.BinaryExpr{Op: "<", Left: ast.StringOffset{Name: "$"}, Right: ast.IntLit{Value: 100}},
+			},
+		},
+		{
+			"for count of them with anonymous count",
+			`for 2 of them : (# > 1 and $)`,
+			ast.ForOfExpr{
+				Quantifier: ast.Quantifier{Kind: ast.QuantCount, Value: ast.IntLit{Value: 2}},
+				Strings:    []string{"them"},
+				Body:       ast.BinaryExpr{Op: "and", Left: ast.BinaryExpr{Op: ">", Left: ast.StringCount{Name: "$"}, Right: ast.IntLit{Value: 1}}, Right: ast.StringRef{Name: "$"}},
+			},
+		},
+		{
+			"for in range",
+			`for all i in (1..#a) : (@a[i] + 10 < @b[i])`,
+			ast.ForInExpr{
+				Quantifier: ast.Quantifier{Kind: ast.QuantAll},
+				Var:        "i",
+				Iterable:   ast.Range{Start: ast.IntLit{Value: 1}, End: ast.StringCount{Name: "$a"}},
+				Body: ast.BinaryExpr{
+					Op:    "<",
+					Left:  ast.BinaryExpr{Op: "+", Left: ast.StringOffset{Name: "$a", Index: ast.Ident{Name: "i"}}, Right: ast.IntLit{Value: 10}},
+					Right: ast.StringOffset{Name: "$b", Index: ast.Ident{Name: "i"}},
+				},
+			},
+		},
+		{
+			"for in enumeration with percentage",
+			`for 50% n in (0, 2, 4) : (uint8(n) == 0)`,
+			ast.ForInExpr{
+				Quantifier: ast.Quantifier{Kind: ast.QuantPercent, Value: ast.IntLit{Value: 50}},
+				Var:        "n",
+				Iterable:   ast.ValueList{Values: []ast.Expr{ast.IntLit{Value: 0}, ast.IntLit{Value: 2}, ast.IntLit{Value: 4}}},
+				Body:       ast.BinaryExpr{Op: "==", Left: ast.FuncCall{Name: "uint8", Args: []ast.Expr{ast.Ident{Name: "n"}}}, Right: ast.IntLit{Value: 0}},
+			},
+		},
+		{
+			"double not",
+			`not not $a`,
+			ast.UnaryExpr{Op: "not", Operand: ast.UnaryExpr{Op: "not", Operand: ast.StringRef{Name: "$a"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := mustParse(t, `rule test { strings: $a = "x" $b = "y" $c = "z" condition: `+tt.cond+` }`)
+			if got := rs.Rules[0].Condition; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
 // Helpers
 
 func intPtr(i int) *int    { return &i }
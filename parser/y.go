@@ -8,17 +8,21 @@ import __yyfmt__ "fmt"
 //line yara.y:2
 
 import (
+	"slices"
+
 	"github.com/sansecio/yargo/ast"
 )
 
-//line yara.y:9
+//line yara.y:11
 type yySymType struct {
 	yys        int
 	str        string
 	num        int64
+	flt        float64
 	byt        byte
 	rule       *ast.Rule
 	rules      []*ast.Rule
+	ruleSet    *ast.RuleSet
 	meta       []*ast.MetaEntry
 	metaEntry  *ast.MetaEntry
 	stringDef  *ast.StringDef
@@ -29,42 +33,88 @@ type yySymType struct {
 	hexToken   ast.HexToken
 	expr       ast.Expr
 	exprs      []ast.Expr
+	rng        ast.Range
+	quant      ast.Quantifier
+	strs       []string
+	iter       ast.Iterable
+
+	// Offsets of the first and last byte+1 of a token. Nonterminals only
+	// carry them where their actions set them.
+	start int
+	end   int
 }
 
 const RULE = 57346
-const META = 57347
-const STRINGS = 57348
-const CONDITION = 57349
-const IDENT = 57350
-const STRING_LIT = 57351
-const STRING_IDENT = 57352
-const REGEX_LIT = 57353
-const MODIFIER = 57354
-const COND_IDENT = 57355
-const COND_STRING_ID = 57356
-const STRING_PATTERN = 57357
-const HEX_JUMP = 57358
-const HEX_ALT = 57359
-const INT_LIT = 57360
-const HEX_BYTE = 57361
-const HEX_WILDCARD = 57362
-const AND = 57363
-const OR = 57364
-const AT = 57365
-const ANY = 57366
-const ALL = 57367
-const OF = 57368
-const THEM = 57369
-const EQ = 57370
+const IMPORT = 57347
+const INCLUDE = 57348
+const PRIVATE = 57349
+const GLOBAL = 57350
+const META = 57351
+const STRINGS = 57352
+const CONDITION = 57353
+const INVALID = 57354
+const IDENT = 57355
+const STRING_LIT = 57356
+const STRING_IDENT = 57357
+const REGEX_LIT = 57358
+const MODIFIER = 57359
+const COND_IDENT = 57360
+const COND_STRING_ID = 57361
+const STRING_PATTERN = 57362
+const STRING_COUNT = 57363
+const STRING_OFFSET = 57364
+const STRING_LENGTH = 57365
+const HEX_JUMP = 57366
+const HEX_ALT = 57367
+const INT_LIT = 57368
+const FLOAT_LIT = 57369
+const HEX_BYTE = 57370
+const HEX_WILDCARD = 57371
+const AND = 57372
+const OR = 57373
+const NOT = 57374
+const AT = 57375
+const IN = 57376
+const ANY = 57377
+const ALL = 57378
+const NONE = 57379
+const OF = 57380
+const THEM = 57381
+const FOR = 57382
+const FILESIZE = 57383
+const ENTRYPOINT = 57384
+const EQ = 57385
+const NEQ = 57386
+const LT = 57387
+const LE = 57388
+const GT = 57389
+const GE = 57390
+const SHL = 57391
+const SHR = 57392
+const DOTDOT = 57393
+const CONTAINS = 57394
+const ICONTAINS = 57395
+const STARTSWITH = 57396
+const ISTARTSWITH = 57397
+const ENDSWITH = 57398
+const IENDSWITH = 57399
+const IEQUALS = 57400
+const MATCHES = 57401
+const UNARY_MINUS = 57402
 
 var yyToknames = [...]string{
 	"$end",
 	"error",
 	"$unk",
 	"RULE",
+	"IMPORT",
+	"INCLUDE",
+	"PRIVATE",
+	"GLOBAL",
 	"META",
 	"STRINGS",
 	"CONDITION",
+	"INVALID",
 	"IDENT",
 	"STRING_LIT",
 	"STRING_IDENT",
@@ -73,19 +123,55 @@ var yyToknames = [...]string{
 	"COND_IDENT",
 	"COND_STRING_ID",
 	"STRING_PATTERN",
+	"STRING_COUNT",
+	"STRING_OFFSET",
+	"STRING_LENGTH",
 	"HEX_JUMP",
 	"HEX_ALT",
 	"INT_LIT",
+	"FLOAT_LIT",
 	"HEX_BYTE",
 	"HEX_WILDCARD",
 	"AND",
 	"OR",
+	"NOT",
 	"AT",
+	"IN",
 	"ANY",
 	"ALL",
+	"NONE",
 	"OF",
 	"THEM",
+	"FOR",
+	"FILESIZE",
+	"ENTRYPOINT",
 	"EQ",
+	"NEQ",
+	"LT",
+	"LE",
+	"GT",
+	"GE",
+	"SHL",
+	"SHR",
+	"DOTDOT",
+	"CONTAINS",
+	"ICONTAINS",
+	"STARTSWITH",
+	"ISTARTSWITH",
+	"ENDSWITH",
+	"IENDSWITH",
+	"IEQUALS",
+	"MATCHES",
+	"'|'",
+	"'^'",
+	"'&'",
+	"'+'",
+	"'-'",
+	"'*'",
+	"'\\\\'",
+	"'%'",
+	"'~'",
+	"UNARY_MINUS",
 	"'{'",
 	"'}'",
 	"':'",
@@ -93,6 +179,9 @@ var yyToknames = [...]string{
 	"'('",
 	"')'",
 	"','",
+	"'['",
+	"']'",
+	"'.'",
 }
 
 var yyStatenames = [...]string{}
@@ -101,108 +190,232 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line yara.y:314
+//line yara.y:716
 
 //line yacctab:1
-var yyExca = [...]int8{
+var yyExca = [...]int16{
 	-1, 1,
 	1, -1,
 	-2, 0,
+	-1, 149,
+	38, 0,
+	-2, 72,
 }
 
 const yyPrivate = 57344
 
-const yyLast = 90
-
-var yyAct = [...]int8{
-	28, 27, 33, 32, 41, 40, 80, 34, 70, 71,
-	79, 42, 47, 30, 31, 77, 78, 56, 75, 76,
-	59, 57, 29, 48, 39, 35, 60, 58, 19, 73,
-	50, 43, 51, 18, 17, 22, 21, 16, 41, 40,
-	6, 42, 53, 54, 55, 42, 41, 61, 63, 45,
-	52, 25, 44, 42, 46, 64, 69, 9, 68, 72,
-	26, 10, 11, 12, 65, 14, 15, 37, 11, 12,
-	8, 20, 81, 5, 12, 4, 38, 1, 13, 62,
-	74, 67, 66, 49, 24, 36, 23, 7, 3, 2,
+const yyLast = 706
+
+var yyAct = [...]uint8{
+	157, 150, 156, 146, 60, 105, 113, 104, 52, 47,
+	112, 55, 56, 57, 213, 214, 58, 59, 204, 176,
+	190, 191, 44, 175, 176, 48, 49, 50, 145, 212,
+	54, 61, 62, 205, 199, 177, 151, 42, 103, 114,
+	66, 206, 196, 36, 147, 94, 95, 96, 35, 34,
+	18, 30, 102, 19, 45, 188, 189, 209, 46, 186,
+	187, 116, 162, 117, 51, 90, 91, 92, 119, 120,
+	121, 122, 123, 124, 125, 126, 127, 128, 129, 148,
+	131, 132, 133, 134, 135, 136, 137, 138, 139, 140,
+	141, 142, 143, 144, 192, 43, 161, 101, 149, 100,
+	99, 180, 184, 152, 153, 154, 159, 68, 67, 97,
+	98, 40, 158, 163, 164, 93, 160, 118, 183, 130,
+	69, 70, 79, 80, 81, 82, 86, 87, 41, 71,
+	72, 73, 74, 75, 76, 77, 78, 83, 84, 85,
+	88, 89, 90, 91, 92, 202, 200, 201, 12, 169,
+	110, 65, 174, 165, 24, 182, 88, 89, 90, 91,
+	92, 93, 11, 64, 179, 166, 29, 25, 79, 80,
+	81, 82, 86, 87, 173, 171, 172, 194, 31, 21,
+	195, 13, 198, 83, 84, 85, 88, 89, 90, 91,
+	92, 32, 33, 28, 203, 26, 27, 28, 20, 37,
+	208, 27, 28, 68, 67, 14, 211, 17, 15, 16,
+	170, 93, 197, 216, 106, 217, 69, 70, 79, 80,
+	81, 82, 86, 87, 207, 71, 72, 73, 74, 75,
+	76, 77, 78, 83, 84, 85, 88, 89, 90, 91,
+	92, 68, 67, 53, 185, 168, 167, 115, 39, 93,
+	63, 181, 38, 23, 69, 70, 79, 80, 81, 82,
+	86, 87, 22, 71, 72, 73, 74, 75, 76, 77,
+	78, 83, 84, 85, 88, 89, 90, 91, 92, 68,
+	67, 8, 6, 2, 1, 0, 0, 93, 0, 178,
+	0, 0, 69, 70, 79, 80, 81, 82, 86, 87,
+	0, 71, 72, 73, 74, 75, 76, 77, 78, 83,
+	84, 85, 88, 89, 90, 91, 92, 68, 67, 0,
+	0, 0, 0, 0, 218, 93, 0, 0, 0, 0,
+	69, 70, 79, 80, 81, 82, 86, 87, 0, 71,
+	72, 73, 74, 75, 76, 77, 78, 83, 84, 85,
+	88, 89, 90, 91, 92, 68, 67, 0, 0, 0,
+	0, 0, 215, 93, 0, 0, 0, 0, 69, 70,
+	79, 80, 81, 82, 86, 87, 0, 71, 72, 73,
+	74, 75, 76, 77, 78, 83, 84, 85, 88, 89,
+	90, 91, 92, 68, 67, 0, 0, 0, 0, 0,
+	210, 93, 0, 0, 0, 0, 69, 70, 79, 80,
+	81, 82, 86, 87, 0, 71, 72, 73, 74, 75,
+	76, 77, 78, 83, 84, 85, 88, 89, 90, 91,
+	92, 68, 67, 0, 0, 0, 0, 0, 155, 93,
+	0, 0, 0, 0, 69, 70, 79, 80, 81, 82,
+	86, 87, 193, 71, 72, 73, 74, 75, 76, 77,
+	78, 83, 84, 85, 88, 89, 90, 91, 92, 68,
+	67, 0, 0, 0, 0, 0, 0, 93, 0, 0,
+	0, 0, 69, 70, 79, 80, 81, 82, 86, 87,
+	0, 71, 72, 73, 74, 75, 76, 77, 78, 83,
+	84, 85, 88, 89, 90, 91, 92, 68, 5, 0,
+	7, 3, 4, 9, 10, 93, 0, 0, 0, 0,
+	69, 70, 79, 80, 81, 82, 86, 87, 0, 71,
+	72, 73, 74, 75, 76, 77, 78, 83, 84, 85,
+	88, 89, 90, 91, 92, 60, 0, 0, 0, 52,
+	47, 0, 55, 56, 57, 0, 0, 58, 59, 0,
+	0, 0, 0, 44, 93, 0, 48, 49, 50, 0,
+	0, 54, 61, 62, 0, 86, 87, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 83, 84, 85, 88,
+	89, 90, 91, 92, 0, 45, 0, 0, 0, 46,
+	0, 93, 0, 0, 0, 51, 69, 70, 79, 80,
+	81, 82, 86, 87, 0, 71, 72, 73, 74, 75,
+	76, 77, 78, 83, 84, 85, 88, 89, 90, 91,
+	92, 60, 0, 0, 0, 52, 111, 0, 55, 56,
+	57, 0, 0, 58, 59, 0, 0, 0, 0, 86,
+	87, 0, 107, 108, 109, 0, 0, 54, 61, 62,
+	83, 84, 85, 88, 89, 90, 91, 92, 86, 87,
+	0, 0, 0, 0, 0, 0, 0, 0, 86, 87,
+	84, 85, 88, 89, 90, 91, 92, 86, 87, 0,
+	0, 51, 88, 89, 90, 91, 92, 0, 0, 0,
+	85, 88, 89, 90, 91, 92,
 }
 
 var yyPact = [...]int16{
-	-1000, -1000, 71, -1000, 65, 11, 56, 62, 67, 7,
-	3, 2, -3, 67, 6, 5, -1000, -1000, 50, -11,
-	-5, -1000, -1000, 59, 50, -1000, -8, 17, -1000, -11,
-	26, 23, 31, -21, -1000, -1000, -1000, -9, -1000, 21,
-	-11, -11, -11, -17, -6, -7, -11, -11, 46, -1000,
-	-1000, -1000, -1000, 25, 13, -1000, -1000, -1000, 43, -1000,
-	41, -1000, -26, -1000, -1000, -1000, 47, -1, -24, -28,
-	-1000, -11, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
-	-1000, -1000,
+	-1000, 506, -1000, 148, 134, -1000, 168, -1000, 201, -1000,
+	-1000, -1000, -1000, -22, -1000, -1000, -1000, -17, 166, 186,
+	153, -1000, -20, 191, 182, -1000, -23, -24, -29, -1000,
+	-1000, 182, -1000, -1000, -1000, 113, 531, -1000, 150, 113,
+	-1000, -33, 439, -1000, 531, 531, 531, 76, 62, 61,
+	59, 531, -36, -72, 617, -1000, -67, -71, -1000, -1000,
+	-1000, -1000, -1000, -1000, -34, -1000, 47, 531, 531, 531,
+	531, 531, 531, 531, 531, 531, 531, 531, 103, 531,
+	531, 531, 531, 531, 531, 531, 531, 531, 531, 531,
+	531, 531, -10, 5, 563, -1000, -1000, 531, -38, 5,
+	5, 5, 363, 531, 94, 531, 78, -1000, -1000, -1000,
+	-5, -1000, 531, 531, 139, -1000, -1000, -1000, -1000, 477,
+	563, 123, 123, 123, 123, 123, 123, 123, 123, 123,
+	-1000, 526, 526, 526, 526, 619, 638, 629, 93, 93,
+	0, 0, -1000, -1000, -1000, 5, -1000, -1000, 156, 600,
+	-1000, 531, -1000, -1000, -1000, -1000, -52, 439, -39, 211,
+	5, 67, -1000, 173, 77, -1000, -1000, 101, 31, -1000,
+	-55, -1000, -1000, 29, 401, -1000, 531, 531, -1000, -30,
+	-40, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, 127, -1000, 531, 439, -57, -41, -31, -1000, 531,
+	-1000, -1000, -8, 325, -1000, 531, -45, -61, 401, -1000,
+	-1000, 287, 531, -1000, 531, -1000, 249, 439, -1000,
 }
 
-var yyPgo = [...]int8{
-	0, 89, 88, 87, 86, 85, 70, 84, 51, 83,
-	82, 81, 80, 1, 0, 57, 79, 77,
+var yyPgo = [...]int16{
+	0, 284, 283, 282, 281, 262, 253, 252, 250, 154,
+	248, 111, 247, 246, 245, 244, 0, 95, 243, 167,
+	2, 224, 214, 212, 1, 3, 210, 207, 198,
 }
 
 var yyR1 = [...]int8{
-	0, 17, 1, 1, 2, 2, 2, 2, 3, 4,
-	4, 5, 5, 6, 7, 7, 8, 9, 9, 9,
-	10, 10, 11, 11, 12, 12, 12, 12, 15, 13,
-	13, 13, 13, 14, 14, 14, 14, 14, 14, 14,
-	14, 14, 16, 16, 16,
+	0, 1, 1, 1, 1, 1, 2, 3, 3, 4,
+	4, 4, 4, 27, 27, 28, 28, 5, 5, 5,
+	5, 6, 7, 7, 8, 8, 9, 10, 10, 11,
+	12, 12, 12, 13, 13, 14, 14, 15, 15, 15,
+	15, 19, 16, 16, 16, 16, 16, 16, 16, 16,
+	16, 16, 16, 16, 16, 16, 16, 16, 16, 16,
+	16, 16, 16, 16, 16, 16, 16, 16, 16, 16,
+	16, 16, 16, 16, 16, 16, 16, 16, 16, 22,
+	22, 22, 22, 22, 23, 23, 21, 21, 25, 25,
+	26, 26, 26, 26, 26, 26, 26, 26, 24, 17,
+	17, 17, 17, 17, 17, 17, 17, 17, 17, 17,
+	17, 17, 17, 17, 17, 18, 18, 18, 18, 20,
+	20, 20,
 }
 
 var yyR2 = [...]int8{
-	0, 1, 0, 2, 7, 6, 6, 5, 3, 0,
-	2, 3, 3, 3, 1, 2, 4, 1, 1, 3,
-	0, 2, 0, 2, 1, 1, 1, 1, 3, 1,
-	3, 3, 3, 3, 3, 5, 3, 5, 3, 4,
-	1, 1, 0, 1, 3,
+	0, 0, 2, 3, 3, 2, 6, 1, 2, 1,
+	1, 2, 2, 0, 2, 1, 2, 3, 2, 2,
+	1, 3, 0, 2, 3, 3, 3, 1, 2, 4,
+	1, 1, 3, 0, 2, 0, 2, 1, 1, 1,
+	1, 3, 1, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 2,
+	2, 2, 3, 3, 3, 3, 3, 3, 4, 1,
+	1, 1, 1, 2, 1, 3, 1, 3, 1, 3,
+	1, 1, 3, 3, 1, 2, 3, 4, 5, 3,
+	4, 1, 8, 9, 1, 1, 1, 4, 1, 4,
+	1, 1, 1, 1, 1, 1, 3, 4, 6, 0,
+	1, 3,
 }
 
 var yyChk = [...]int16{
-	-1000, -17, -1, -2, 4, 8, 29, -3, -6, -15,
-	5, 6, 7, -6, -15, -15, 30, 31, 31, 31,
-	-15, 30, 30, -4, -7, -8, 10, -13, -14, 33,
-	24, 25, 14, 13, 18, 30, -5, 8, -8, 32,
-	22, 21, 28, -13, 26, 26, 23, 33, 32, -9,
-	9, 11, 29, -13, -13, -13, 34, 27, 33, 27,
-	33, -14, -16, -14, 9, 18, -10, -11, 15, 15,
-	34, 35, 12, 30, -12, 19, 20, 16, 17, 34,
-	34, -14,
+	-1000, -1, -2, 5, 6, 2, -3, 4, -4, 7,
+	8, 14, 14, 13, 4, 7, 8, -27, 72, 70,
+	-28, 13, -5, -6, -9, -19, 9, 10, 11, 13,
+	71, -9, -19, -19, 72, 72, 72, -19, -7, -10,
+	-11, 15, -16, -17, 32, 64, 68, 19, 35, 36,
+	37, 74, 18, -18, 40, 21, 22, 23, 26, 27,
+	14, 41, 42, -8, 13, -11, 73, 31, 30, 43,
+	44, 52, 53, 54, 55, 56, 57, 58, 59, 45,
+	46, 47, 48, 60, 61, 62, 49, 50, 63, 64,
+	65, 66, 67, 38, -16, -16, -16, 33, 34, 38,
+	38, 38, -16, 74, 79, 77, -22, 35, 36, 37,
+	-17, 19, 77, 77, 73, -12, 14, 16, 70, -16,
+	-16, -16, -16, -16, -16, -16, -16, -16, -16, -16,
+	16, -16, -16, -16, -16, -16, -16, -16, -16, -16,
+	-16, -16, -16, -16, -16, 38, -25, 39, 74, -16,
+	-24, 74, -25, -25, -25, 75, -20, -16, 18, -16,
+	38, 18, 67, -16, -16, 14, 26, -13, -14, -25,
+	-26, 19, 20, 18, -16, 75, 76, 74, 78, -25,
+	34, 78, 78, 17, 71, -15, 28, 29, 24, 25,
+	75, 76, 65, 51, -16, -20, 72, -23, -24, 74,
+	19, 20, 18, -16, 75, 74, 72, -21, -16, 65,
+	75, -16, 74, 75, 76, 75, -16, -16, 75,
 }
 
 var yyDef = [...]int8{
-	2, -2, 1, 3, 0, 0, 0, 0, 0, 0,
-	0, 0, 0, 0, 0, 0, 7, 9, 0, 0,
-	0, 6, 5, 8, 13, 14, 0, 28, 29, 0,
-	0, 0, 40, 0, 41, 4, 10, 0, 15, 0,
-	0, 0, 0, 0, 0, 0, 0, 42, 0, 20,
-	17, 18, 22, 30, 31, 32, 33, 34, 0, 36,
-	0, 38, 0, 43, 11, 12, 16, 0, 0, 0,
-	39, 0, 21, 19, 23, 24, 25, 26, 27, 35,
-	37, 44,
+	1, -2, 2, 0, 0, 5, 0, 7, 0, 9,
+	10, 3, 4, 13, 8, 11, 12, 0, 0, 0,
+	14, 15, 0, 0, 0, 20, 0, 0, 0, 16,
+	6, 0, 19, 18, 22, 0, 0, 17, 21, 26,
+	27, 0, 41, 42, 0, 0, 0, 104, 0, 0,
+	0, 0, 115, 101, 0, 105, 106, 108, 110, 111,
+	112, 113, 114, 23, 0, 28, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 69, 70, 71, 0, 0, 0,
+	0, 0, 0, 119, 0, 0, 0, 79, 80, 81,
+	82, 104, 0, 0, 0, 33, 30, 31, 35, 43,
+	44, 45, 46, 47, 48, 49, 50, 51, 52, 53,
+	54, 55, 56, 57, 58, 59, 60, 61, 62, 63,
+	64, 65, 66, 67, 68, 0, 77, 88, 0, -2,
+	73, 0, 74, 75, 76, 99, 0, 120, 116, 0,
+	0, 0, 83, 0, 0, 24, 25, 29, 0, 78,
+	0, 90, 91, 94, 0, 100, 0, 119, 117, 0,
+	0, 107, 109, 34, 32, 36, 37, 38, 39, 40,
+	89, 0, 95, 0, 121, 0, 0, 0, 84, 0,
+	92, 93, 96, 0, 118, 0, 0, 0, 86, 97,
+	98, 0, 0, 85, 0, 102, 0, 87, 103,
 }
 
 var yyTok1 = [...]int8{
 	1, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 67, 62, 3,
+	74, 75, 65, 63, 76, 64, 79, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 72, 3,
+	3, 73, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	33, 34, 3, 3, 35, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 31, 3,
-	3, 32, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 77, 66, 78, 61, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
 	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
-	3, 3, 3, 29, 3, 30,
+	3, 3, 3, 70, 60, 71, 68,
 }
 
 var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
-	22, 23, 24, 25, 26, 27, 28,
+	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+	52, 53, 54, 55, 56, 57, 58, 59, 69,
 }
 
 var yyTok3 = [...]int8{
@@ -547,297 +760,782 @@ yydefault:
 	switch yynt {
 
 	case 1:
-		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:58
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line yara.y:88
 		{
-			yylex.(*yaraLexer).ruleSet = &ast.RuleSet{Rules: yyDollar[1].rules}
+			yyVAL.ruleSet = &ast.RuleSet{}
+			yylex.(*yaraLexer).ruleSet = yyVAL.ruleSet
 		}
 	case 2:
-		yyDollar = yyS[yypt-0 : yypt+1]
-//line yara.y:65
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:93
 		{
-			yyVAL.rules = nil
+			yyVAL.ruleSet = yyDollar[1].ruleSet
+			if yyDollar[2].rule != nil {
+				yyVAL.ruleSet.Rules = append(yyVAL.ruleSet.Rules, yyDollar[2].rule)
+			}
 		}
 	case 3:
-		yyDollar = yyS[yypt-2 : yypt+1]
-//line yara.y:69
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:100
 		{
-			yyVAL.rules = append(yyDollar[1].rules, yyDollar[2].rule)
+			yyVAL.ruleSet = yyDollar[1].ruleSet
+			if name := unquoteString(yyDollar[3].str); !slices.Contains(yyVAL.ruleSet.Imports, name) {
+				yyVAL.ruleSet.Imports = append(yyVAL.ruleSet.Imports, name)
+			}
 		}
 	case 4:
-		yyDollar = yyS[yypt-7 : yypt+1]
-//line yara.y:76
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:107
 		{
-			yyVAL.rule = &ast.Rule{
-				Name:      yyDollar[2].str,
-				Meta:      yyDollar[4].meta,
-				Strings:   yyDollar[5].stringDefs,
-				Condition: yyDollar[6].expr,
-			}
+			yyVAL.ruleSet = yyDollar[1].ruleSet
+			yylex.(*yaraLexer).includeFile(yyVAL.ruleSet, unquoteString(yyDollar[3].str), yyDollar[3].start)
 		}
 	case 5:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:112
+		{
+			// Skip to the next rule, import or include after a syntax error.
+			yyVAL.ruleSet = yyDollar[1].ruleSet
+		}
+	case 6:
 		yyDollar = yyS[yypt-6 : yypt+1]
-//line yara.y:85
+//line yara.y:120
+		{
+			yyVAL.rule = yyDollar[5].rule
+			yyVAL.rule.Name = yyDollar[2].str
+			yyVAL.rule.Tags = yyDollar[3].strs
+			yyVAL.rule.Private = yyDollar[1].rule.Private
+			yyVAL.rule.Global = yyDollar[1].rule.Global
+			yyVAL.rule.Span = tokenSpan(yylex, yyDollar[1].start, yyDollar[6].end)
+			if yylex.(*yaraLexer).ruleFailed() {
+				yyVAL.rule = nil
+			}
+		}
+	case 7:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:140
+		{
+			yyVAL.rule = &ast.Rule{}
+			yylex.(*yaraLexer).startRule()
+			Errflag = 0
+		}
+	case 8:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:146
+		{
+			yyVAL.rule = yyDollar[1].rule
+			yylex.(*yaraLexer).startRule()
+			Errflag = 0
+		}
+	case 9:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:155
+		{
+			yyVAL.rule = &ast.Rule{Private: true}
+		}
+	case 10:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:159
+		{
+			yyVAL.rule = &ast.Rule{Global: true}
+		}
+	case 11:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:163
+		{
+			yyVAL.rule = yyDollar[1].rule
+			yyVAL.rule.Private = true
+		}
+	case 12:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:168
+		{
+			yyVAL.rule = yyDollar[1].rule
+			yyVAL.rule.Global = true
+		}
+	case 13:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line yara.y:176
+		{
+			yyVAL.strs = nil
+		}
+	case 14:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:180
+		{
+			yyVAL.strs = yyDollar[2].strs
+		}
+	case 15:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:187
+		{
+			yyVAL.strs = []string{yyDollar[1].str}
+		}
+	case 16:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:191
+		{
+			yyVAL.strs = append(yyDollar[1].strs, yyDollar[2].str)
+		}
+	case 17:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:198
 		{
 			yyVAL.rule = &ast.Rule{
-				Name:      yyDollar[2].str,
-				Strings:   yyDollar[4].stringDefs,
-				Condition: yyDollar[5].expr,
+				Meta:      yyDollar[1].meta,
+				Strings:   yyDollar[2].stringDefs,
+				Condition: yyDollar[3].expr,
 			}
 		}
-	case 6:
-		yyDollar = yyS[yypt-6 : yypt+1]
-//line yara.y:93
+	case 18:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:206
 		{
 			yyVAL.rule = &ast.Rule{
-				Name:      yyDollar[2].str,
-				Meta:      yyDollar[4].meta,
-				Condition: yyDollar[5].expr,
+				Strings:   yyDollar[1].stringDefs,
+				Condition: yyDollar[2].expr,
 			}
 		}
-	case 7:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line yara.y:101
+	case 19:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:213
 		{
 			yyVAL.rule = &ast.Rule{
-				Name:      yyDollar[2].str,
-				Condition: yyDollar[4].expr,
+				Meta:      yyDollar[1].meta,
+				Condition: yyDollar[2].expr,
 			}
 		}
-	case 8:
+	case 20:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:220
+		{
+			yyVAL.rule = &ast.Rule{
+				Condition: yyDollar[1].expr,
+			}
+		}
+	case 21:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:111
+//line yara.y:229
 		{
 			yyVAL.meta = yyDollar[3].meta
 		}
-	case 9:
+	case 22:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line yara.y:118
+//line yara.y:236
 		{
 			yyVAL.meta = nil
 		}
-	case 10:
+	case 23:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line yara.y:122
+//line yara.y:240
 		{
 			yyVAL.meta = append(yyDollar[1].meta, yyDollar[2].metaEntry)
 		}
-	case 11:
+	case 24:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:129
+//line yara.y:247
 		{
-			yyVAL.metaEntry = &ast.MetaEntry{Key: yyDollar[1].str, Value: unquoteString(yyDollar[3].str)}
+			yyVAL.metaEntry = &ast.MetaEntry{Key: yyDollar[1].str, Value: unquoteString(yyDollar[3].str), Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end)}
 		}
-	case 12:
+	case 25:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:133
+//line yara.y:251
 		{
-			yyVAL.metaEntry = &ast.MetaEntry{Key: yyDollar[1].str, Value: yyDollar[3].num}
+			yyVAL.metaEntry = &ast.MetaEntry{Key: yyDollar[1].str, Value: yyDollar[3].num, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end)}
 		}
-	case 13:
+	case 26:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:140
+//line yara.y:258
 		{
 			yyVAL.stringDefs = yyDollar[3].stringDefs
 		}
-	case 14:
+	case 27:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:147
+//line yara.y:265
 		{
 			yyVAL.stringDefs = []*ast.StringDef{yyDollar[1].stringDef}
 		}
-	case 15:
+	case 28:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line yara.y:151
+//line yara.y:269
 		{
 			yyVAL.stringDefs = append(yyDollar[1].stringDefs, yyDollar[2].stringDef)
 		}
-	case 16:
+	case 29:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line yara.y:158
+//line yara.y:276
 		{
+			end := yyDollar[4].end
+			if end < 0 {
+				end = yyDollar[3].end
+			}
 			yyVAL.stringDef = &ast.StringDef{
 				Name:      yyDollar[1].str,
 				Value:     yyDollar[3].strVal,
 				Modifiers: yyDollar[4].mods,
+				Span:      tokenSpan(yylex, yyDollar[1].start, end),
 			}
 		}
-	case 17:
+	case 30:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:169
+//line yara.y:292
 		{
-			yyVAL.strVal = ast.TextString{Value: unquoteString(yyDollar[1].str)}
+			yyVAL.strVal = ast.TextString{Value: unquoteString(yyDollar[1].str), Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 18:
+	case 31:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:173
+//line yara.y:296
 		{
 			pattern, mods := parseRegex(yyDollar[1].str)
-			yyVAL.strVal = ast.RegexString{Pattern: pattern, Modifiers: mods}
+			yyVAL.strVal = ast.RegexString{Pattern: pattern, Modifiers: mods, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 19:
+	case 32:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:178
+//line yara.y:301
 		{
-			yyVAL.strVal = ast.HexString{Tokens: yyDollar[2].hexTokens}
+			yyVAL.strVal = ast.HexString{Tokens: yyDollar[2].hexTokens, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end)}
+			yyVAL.end = yyDollar[3].end
 		}
-	case 20:
+	case 33:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line yara.y:185
+//line yara.y:309
 		{
 			yyVAL.mods = ast.StringModifiers{}
+			yyVAL.end = -1
 		}
-	case 21:
+	case 34:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line yara.y:189
+//line yara.y:314
 		{
 			yyVAL.mods = yyDollar[1].mods
-			switch yyDollar[2].str {
-			case "ascii":
-				yyVAL.mods.Ascii = true
-			case "base64":
-				yyVAL.mods.Base64 = true
-			case "fullword":
-				yyVAL.mods.Fullword = true
-			default:
-				yylex.Error("unsupported modifier: " + yyDollar[2].str)
+			if err := applyModifier(&yyVAL.mods, yyDollar[2].str); err != nil {
+				yylex.(*yaraLexer).errorAt(yyDollar[2].start, yyDollar[2].end, err.Error())
 			}
+			yyVAL.end = yyDollar[2].end
 		}
-	case 22:
+	case 35:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line yara.y:206
+//line yara.y:325
 		{
 			yyVAL.hexTokens = nil
 		}
-	case 23:
+	case 36:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line yara.y:210
+//line yara.y:329
 		{
 			yyVAL.hexTokens = append(yyDollar[1].hexTokens, yyDollar[2].hexToken)
 		}
-	case 24:
+	case 37:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:217
+//line yara.y:336
 		{
-			yyVAL.hexToken = ast.HexByte{Value: yyDollar[1].byt}
+			yyVAL.hexToken = ast.HexByte{Value: yyDollar[1].byt, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 25:
+	case 38:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:221
+//line yara.y:340
 		{
-			yyVAL.hexToken = ast.HexWildcard{}
+			yyVAL.hexToken = ast.HexWildcard{Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 26:
+	case 39:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:225
+//line yara.y:344
 		{
-			yyVAL.hexToken = parseHexJump(yyDollar[1].str)
+			jump := parseHexJump(yyDollar[1].str)
+			jump.Span = tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)
+			yyVAL.hexToken = jump
 		}
-	case 27:
+	case 40:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:229
+//line yara.y:350
 		{
-			yyVAL.hexToken = parseHexAlt(yyDollar[1].str)
+			alt := parseHexAlt(yyDollar[1].str)
+			alt.Span = tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)
+			yyVAL.hexToken = alt
 		}
-	case 28:
+	case 41:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:236
+//line yara.y:359
 		{
 			yyVAL.expr = yyDollar[3].expr
 		}
-	case 29:
+	case 42:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:243
+//line yara.y:366
 		{
 			yyVAL.expr = yyDollar[1].expr
 		}
-	case 30:
+	case 43:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:247
+//line yara.y:370
 		{
-			yyVAL.expr = ast.BinaryExpr{Op: "or", Left: yyDollar[1].expr, Right: yyDollar[3].expr}
+			yyVAL.expr = newBinaryExpr("or", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 31:
+	case 44:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:251
+//line yara.y:374
 		{
-			yyVAL.expr = ast.BinaryExpr{Op: "and", Left: yyDollar[1].expr, Right: yyDollar[3].expr}
+			yyVAL.expr = newBinaryExpr("and", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 32:
+	case 45:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:255
+//line yara.y:378
 		{
-			yyVAL.expr = ast.BinaryExpr{Op: "==", Left: yyDollar[1].expr, Right: yyDollar[3].expr}
+			yyVAL.expr = newBinaryExpr("==", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 33:
+	case 46:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:262
+//line yara.y:382
 		{
-			yyVAL.expr = ast.ParenExpr{Inner: yyDollar[2].expr}
+			yyVAL.expr = newBinaryExpr("!=", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 34:
+	case 47:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:266
+//line yara.y:386
 		{
-			yyVAL.expr = ast.AnyOf{Pattern: "them"}
+			yyVAL.expr = newBinaryExpr("contains", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 35:
-		yyDollar = yyS[yypt-5 : yypt+1]
-//line yara.y:270
+	case 48:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:390
 		{
-			yyVAL.expr = ast.AnyOf{Pattern: yyDollar[4].str}
+			yyVAL.expr = newBinaryExpr("icontains", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 36:
+	case 49:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:274
+//line yara.y:394
 		{
-			yyVAL.expr = ast.AllOf{Pattern: "them"}
+			yyVAL.expr = newBinaryExpr("startswith", yyDollar[1].expr, yyDollar[3].expr)
 		}
-	case 37:
+	case 50:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:398
+		{
+			yyVAL.expr = newBinaryExpr("istartswith", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 51:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:402
+		{
+			yyVAL.expr = newBinaryExpr("endswith", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:406
+		{
+			yyVAL.expr = newBinaryExpr("iendswith", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 53:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:410
+		{
+			yyVAL.expr = newBinaryExpr("iequals", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 54:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:414
+		{
+			pattern, mods := parseRegex(yyDollar[3].str)
+			yyVAL.expr = newBinaryExpr("matches", yyDollar[1].expr, ast.RegexLit{Pattern: pattern, Modifiers: mods, Span: tokenSpan(yylex, yyDollar[3].start, yyDollar[3].end)})
+		}
+	case 55:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:419
+		{
+			yyVAL.expr = newBinaryExpr("<", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 56:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:423
+		{
+			yyVAL.expr = newBinaryExpr("<=", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 57:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:427
+		{
+			yyVAL.expr = newBinaryExpr(">", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 58:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:431
+		{
+			yyVAL.expr = newBinaryExpr(">=", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 59:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:435
+		{
+			yyVAL.expr = newBinaryExpr("|", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 60:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:439
+		{
+			yyVAL.expr = newBinaryExpr("^", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 61:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:443
+		{
+			yyVAL.expr = newBinaryExpr("&", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 62:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:447
+		{
+			yyVAL.expr = newBinaryExpr("<<", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 63:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:451
+		{
+			yyVAL.expr = newBinaryExpr(">>", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 64:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:455
+		{
+			yyVAL.expr = newBinaryExpr("+", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 65:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:459
+		{
+			yyVAL.expr = newBinaryExpr("-", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 66:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:463
+		{
+			yyVAL.expr = newBinaryExpr("*", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 67:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:467
+		{
+			yyVAL.expr = newBinaryExpr("\\", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 68:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:471
+		{
+			yyVAL.expr = newBinaryExpr("%", yyDollar[1].expr, yyDollar[3].expr)
+		}
+	case 69:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:475
+		{
+			yyVAL.expr = ast.UnaryExpr{Op: "not", Operand: yyDollar[2].expr, Span: joinSpans(tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end), ast.SpanOf(yyDollar[2].expr))}
+		}
+	case 70:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:479
+		{
+			yyVAL.expr = ast.UnaryExpr{Op: "-", Operand: yyDollar[2].expr, Span: joinSpans(tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end), ast.SpanOf(yyDollar[2].expr))}
+		}
+	case 71:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:483
+		{
+			yyVAL.expr = ast.UnaryExpr{Op: "~", Operand: yyDollar[2].expr, Span: joinSpans(tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end), ast.SpanOf(yyDollar[2].expr))}
+		}
+	case 72:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:487
+		{
+			ref := ast.StringRef{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+			yyVAL.expr = ast.AtExpr{Ref: ref, Pos: yyDollar[3].expr, Span: joinSpans(ref.Span, ast.SpanOf(yyDollar[3].expr))}
+		}
+	case 73:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:492
+		{
+			ref := ast.StringRef{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+			yyVAL.expr = ast.InExpr{Ref: ref, Range: yyDollar[3].rng, Span: joinSpans(ref.Span, yyDollar[3].rng.Span)}
+		}
+	case 74:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:497
+		{
+			yyVAL.expr = newOfExpr(ast.Quantifier{Kind: ast.QuantAny}, yyDollar[3].strs, tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end))
+		}
+	case 75:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:501
+		{
+			yyVAL.expr = newOfExpr(ast.Quantifier{Kind: ast.QuantAll}, yyDollar[3].strs, tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end))
+		}
+	case 76:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:505
+		{
+			yyVAL.expr = newOfExpr(ast.Quantifier{Kind: ast.QuantNone}, yyDollar[3].strs, tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end))
+		}
+	case 77:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:509
+		{
+			yyVAL.expr = newOfExpr(ast.Quantifier{Kind: ast.QuantCount, Value: yyDollar[1].expr}, yyDollar[3].strs, joinSpans(ast.SpanOf(yyDollar[1].expr), tokenSpan(yylex, yyDollar[3].end, yyDollar[3].end)))
+		}
+	case 78:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yara.y:513
+		{
+			yyVAL.expr = newOfExpr(ast.Quantifier{Kind: ast.QuantPercent, Value: yyDollar[1].expr}, yyDollar[4].strs, joinSpans(ast.SpanOf(yyDollar[1].expr), tokenSpan(yylex, yyDollar[4].end, yyDollar[4].end)))
+		}
+	case 79:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:520
+		{
+			yyVAL.quant = ast.Quantifier{Kind: ast.QuantAny}
+		}
+	case 80:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:524
+		{
+			yyVAL.quant = ast.Quantifier{Kind: ast.QuantAll}
+		}
+	case 81:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:528
+		{
+			yyVAL.quant = ast.Quantifier{Kind: ast.QuantNone}
+		}
+	case 82:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:532
+		{
+			yyVAL.quant = ast.Quantifier{Kind: ast.QuantCount, Value: yyDollar[1].expr}
+		}
+	case 83:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:536
+		{
+			yyVAL.quant = ast.Quantifier{Kind: ast.QuantPercent, Value: yyDollar[1].expr}
+		}
+	case 84:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:543
+		{
+			yyVAL.iter = yyDollar[1].rng
+		}
+	case 85:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:547
+		{
+			yyVAL.iter = ast.ValueList{Values: yyDollar[2].exprs, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end)}
+		}
+	case 86:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:554
+		{
+			yyVAL.exprs = []ast.Expr{yyDollar[1].expr}
+		}
+	case 87:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:558
+		{
+			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
+		}
+	case 88:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:565
+		{
+			yyVAL.strs = []string{"them"}
+		}
+	case 89:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:569
+		{
+			yyVAL.strs = yyDollar[2].strs
+			yyVAL.end = yyDollar[3].end
+		}
+	case 90:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:577
+		{
+			yyVAL.strs = []string{yyDollar[1].str}
+		}
+	case 91:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:581
+		{
+			yyVAL.strs = []string{yyDollar[1].str}
+		}
+	case 92:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:585
+		{
+			yyVAL.strs = append(yyDollar[1].strs, yyDollar[3].str)
+		}
+	case 93:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:589
+		{
+			yyVAL.strs = append(yyDollar[1].strs, yyDollar[3].str)
+		}
+	case 94:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:593
+		{
+			yyVAL.strs = []string{yyDollar[1].str}
+		}
+	case 95:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line yara.y:597
+		{
+			yyVAL.strs = []string{yyDollar[1].str + "*"}
+		}
+	case 96:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:601
+		{
+			yyVAL.strs = append(yyDollar[1].strs, yyDollar[3].str)
+		}
+	case 97:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yara.y:605
+		{
+			yyVAL.strs = append(yyDollar[1].strs, yyDollar[3].str+"*")
+		}
+	case 98:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line yara.y:278
+//line yara.y:612
 		{
-			yyVAL.expr = ast.AllOf{Pattern: yyDollar[4].str}
+			yyVAL.rng = ast.Range{Start: yyDollar[2].expr, End: yyDollar[4].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[5].end)}
 		}
-	case 38:
+	case 99:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:282
+//line yara.y:619
 		{
-			yyVAL.expr = ast.AtExpr{Ref: ast.StringRef{Name: yyDollar[1].str}, Pos: yyDollar[3].expr}
+			yyVAL.expr = ast.ParenExpr{Inner: yyDollar[2].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[3].end)}
 		}
-	case 39:
+	case 100:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line yara.y:286
+//line yara.y:623
 		{
-			yyVAL.expr = ast.FuncCall{Name: yyDollar[1].str, Args: yyDollar[3].exprs}
+			yyVAL.expr = ast.FuncCall{Name: yyDollar[1].str, Args: yyDollar[3].exprs, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[4].end)}
 		}
-	case 40:
+	case 102:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line yara.y:628
+		{
+			yyVAL.expr = ast.ForOfExpr{Quantifier: yyDollar[2].quant, Strings: yyDollar[4].strs, Body: yyDollar[7].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[8].end)}
+		}
+	case 103:
+		yyDollar = yyS[yypt-9 : yypt+1]
+//line yara.y:632
+		{
+			yyVAL.expr = ast.ForInExpr{Quantifier: yyDollar[2].quant, Var: yyDollar[3].str, Iterable: yyDollar[5].iter, Body: yyDollar[8].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[9].end)}
+		}
+	case 104:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:290
+//line yara.y:636
 		{
-			yyVAL.expr = ast.StringRef{Name: yyDollar[1].str}
+			yyVAL.expr = ast.StringRef{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 41:
+	case 105:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:294
+//line yara.y:640
 		{
-			yyVAL.expr = ast.IntLit{Value: yyDollar[1].num}
+			yyVAL.expr = ast.StringCount{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
 		}
-	case 42:
+	case 106:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:644
+		{
+			yyVAL.expr = ast.StringOffset{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 107:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yara.y:648
+		{
+			yyVAL.expr = ast.StringOffset{Name: yyDollar[1].str, Index: yyDollar[3].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[4].end)}
+		}
+	case 108:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:652
+		{
+			yyVAL.expr = ast.StringLength{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 109:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yara.y:656
+		{
+			yyVAL.expr = ast.StringLength{Name: yyDollar[1].str, Index: yyDollar[3].expr, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[4].end)}
+		}
+	case 110:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:660
+		{
+			yyVAL.expr = newIntLit(yyDollar[1].num, yyDollar[1].str, tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end))
+		}
+	case 111:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:664
+		{
+			yyVAL.expr = ast.FloatLit{Value: yyDollar[1].flt, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 112:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:668
+		{
+			yyVAL.expr = ast.StringLit{Value: unquoteString(yyDollar[1].str), Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 113:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:672
+		{
+			yyVAL.expr = ast.Filesize{Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 114:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:676
+		{
+			yyVAL.expr = ast.Entrypoint{Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 115:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line yara.y:683
+		{
+			yyVAL.expr = ast.Ident{Name: yyDollar[1].str, Span: tokenSpan(yylex, yyDollar[1].start, yyDollar[1].end)}
+		}
+	case 116:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line yara.y:687
+		{
+			yyVAL.expr = ast.MemberExpr{Object: yyDollar[1].expr, Member: yyDollar[3].str, Span: joinSpans(ast.SpanOf(yyDollar[1].expr), tokenSpan(yylex, yyDollar[3].start, yyDollar[3].end))}
+		}
+	case 117:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line yara.y:691
+		{
+			yyVAL.expr = ast.IndexExpr{Object: yyDollar[1].expr, Index: yyDollar[3].expr, Span: joinSpans(ast.SpanOf(yyDollar[1].expr), tokenSpan(yylex, yyDollar[4].start, yyDollar[4].end))}
+		}
+	case 118:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line yara.y:695
+		{
+			member := ast.MemberExpr{Object: yyDollar[1].expr, Member: yyDollar[3].str, Span: joinSpans(ast.SpanOf(yyDollar[1].expr), tokenSpan(yylex, yyDollar[3].start, yyDollar[3].end))}
+			yyVAL.expr = ast.CallExpr{Func: member, Args: yyDollar[5].exprs, Span: joinSpans(member.Span, tokenSpan(yylex, yyDollar[6].start, yyDollar[6].end))}
+		}
+	case 119:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line yara.y:301
+//line yara.y:703
 		{
 			yyVAL.exprs = nil
 		}
-	case 43:
+	case 120:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line yara.y:305
+//line yara.y:707
 		{
 			yyVAL.exprs = []ast.Expr{yyDollar[1].expr}
 		}
-	case 44:
+	case 121:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line yara.y:309
+//line yara.y:711
 		{
 			yyVAL.exprs = append(yyDollar[1].exprs, yyDollar[3].expr)
 		}
@@ -2,6 +2,8 @@
 package parser
 
 import (
+	"slices"
+
 	"github.com/sansecio/yargo/ast"
 )
 %}
@@ -9,9 +11,11 @@ import (
 %union {
 	str       string
 	num       int64
+	flt       float64
 	byt       byte
 	rule      *ast.Rule
 	rules     []*ast.Rule
+	ruleSet   *ast.RuleSet
 	meta      []*ast.MetaEntry
 	metaEntry *ast.MetaEntry
 	stringDef *ast.StringDef
@@ -22,24 +26,46 @@ import (
 	hexToken  ast.HexToken
 	expr      ast.Expr
 	exprs     []ast.Expr
+	rng       ast.Range
+	quant     ast.Quantifier
+	strs      []string
+	iter      ast.Iterable
+
+	// Offsets of the first and last byte+1 of a token. Nonterminals only
+	// carry them where their actions set them.
+	start int
+	end   int
 }
 
-%token RULE META STRINGS CONDITION
+%token RULE IMPORT INCLUDE PRIVATE GLOBAL META STRINGS CONDITION
+%token INVALID
 %token <str> IDENT STRING_LIT STRING_IDENT REGEX_LIT MODIFIER
 %token <str> COND_IDENT COND_STRING_ID STRING_PATTERN
+%token <str> STRING_COUNT STRING_OFFSET STRING_LENGTH
 %token <str> HEX_JUMP HEX_ALT
 %token <num> INT_LIT
+%token <flt> FLOAT_LIT
 %token <byt> HEX_BYTE
 %token HEX_WILDCARD
-%token AND OR AT ANY ALL OF THEM EQ
+%token AND OR NOT AT IN ANY ALL NONE OF THEM FOR FILESIZE ENTRYPOINT EQ NEQ LT LE GT GE SHL SHR DOTDOT
+%token CONTAINS ICONTAINS STARTSWITH ISTARTSWITH ENDSWITH IENDSWITH IEQUALS MATCHES
 
 %left OR
 %left AND
-%left EQ
-%nonassoc AT
+%right NOT
+%left EQ NEQ CONTAINS ICONTAINS STARTSWITH ISTARTSWITH ENDSWITH IENDSWITH IEQUALS MATCHES
+%left LT LE GT GE
+%nonassoc AT IN OF
+%left '|'
+%left '^'
+%left '&'
+%left SHL SHR
+%left '+' '-'
+%left '*' '\\' '%'
+%right '~' UNARY_MINUS
 
-%type <rules> rule_list
-%type <rule> rule
+%type <ruleSet> definitions
+%type <rule> rule rule_start rule_modifiers rule_body
 %type <meta> meta_section meta_entries
 %type <metaEntry> meta_entry
 %type <stringDefs> strings_section string_defs
@@ -48,60 +74,152 @@ import (
 %type <mods> modifiers
 %type <hexTokens> hex_tokens
 %type <hexToken> hex_token
-%type <expr> expr primary_expr condition_section
-%type <exprs> func_args
+%type <expr> expr primary_expr module_expr condition_section
+%type <exprs> func_args expr_list
+%type <quant> for_quantifier
+%type <iter> iterable
+%type <rng> range
+%type <strs> string_set string_enum tags tag_list
 
 %%
 
-file:
-	rule_list
+definitions:
+	/* empty */
+	{
+		$$ = &ast.RuleSet{}
+		yylex.(*yaraLexer).ruleSet = $$
+	}
+	| definitions rule
+	{
+		$$ = $1
+		if $2 != nil {
+			$$.Rules = append($$.Rules, $2)
+		}
+	}
+	| definitions IMPORT STRING_LIT
+	{
+		$$ = $1
+		if name := unquoteString($3); !slices.Contains($$.Imports, name) {
+			$$.Imports = append($$.Imports, name)
+		}
+	}
+	| definitions INCLUDE STRING_LIT
 	{
-		yylex.(*yaraLexer).ruleSet = &ast.RuleSet{Rules: $1}
+		$$ = $1
+		yylex.(*yaraLexer).includeFile($$, unquoteString($3), $<start>3)
+	}
+	| definitions error
+	{
+		// Skip to the next rule, import or include after a syntax error.
+		$$ = $1
 	}
 	;
 
-rule_list:
+rule:
+	rule_start IDENT tags '{' rule_body '}'
+	{
+		$$ = $5
+		$$.Name = $2
+		$$.Tags = $3
+		$$.Private = $1.Private
+		$$.Global = $1.Global
+		$$.Span = tokenSpan(yylex, $<start>1, $<end>6)
+		if yylex.(*yaraLexer).ruleFailed() {
+			$$ = nil
+		}
+	}
+	;
+
+/*
+ * rule_start resumes error reporting after a syntax error, as yyerrok
+ * does in other yaccs, so that an error at the start of the next rule is
+ * reported too.
+ */
+rule_start:
+	RULE
+	{
+		$$ = &ast.Rule{}
+		yylex.(*yaraLexer).startRule()
+		Errflag = 0
+	}
+	| rule_modifiers RULE
+	{
+		$$ = $1
+		yylex.(*yaraLexer).startRule()
+		Errflag = 0
+	}
+	;
+
+rule_modifiers:
+	PRIVATE
+	{
+		$$ = &ast.Rule{Private: true}
+	}
+	| GLOBAL
+	{
+		$$ = &ast.Rule{Global: true}
+	}
+	| rule_modifiers PRIVATE
+	{
+		$$ = $1
+		$$.Private = true
+	}
+	| rule_modifiers GLOBAL
+	{
+		$$ = $1
+		$$.Global = true
+	}
+	;
+
+tags:
 	/* empty */
 	{
 		$$ = nil
 	}
-	| rule_list rule
+	| ':' tag_list
+	{
+		$$ = $2
+	}
+	;
+
+tag_list:
+	IDENT
+	{
+		$$ = []string{$1}
+	}
+	| tag_list IDENT
 	{
 		$$ = append($1, $2)
 	}
 	;
 
-rule:
-	RULE IDENT '{' meta_section strings_section condition_section '}'
+rule_body:
+	meta_section strings_section condition_section
 	{
 		$$ = &ast.Rule{
-			Name:      $2,
-			Meta:      $4,
-			Strings:   $5,
-			Condition: $6,
+			Meta:      $1,
+			Strings:   $2,
+			Condition: $3,
 		}
 	}
-	| RULE IDENT '{' strings_section condition_section '}'
+	| strings_section condition_section
 	{
 		$$ = &ast.Rule{
-			Name:      $2,
-			Strings:   $4,
-			Condition: $5,
+			Strings:   $1,
+			Condition: $2,
 		}
 	}
-	| RULE IDENT '{' meta_section condition_section '}'
+	| meta_section condition_section
 	{
 		$$ = &ast.Rule{
-			Name:      $2,
-			Meta:      $4,
-			Condition: $5,
+			Meta:      $1,
+			Condition: $2,
 		}
 	}
-	| RULE IDENT '{' condition_section '}'
+	| condition_section
 	{
 		$$ = &ast.Rule{
-			Name:      $2,
-			Condition: $4,
+			Condition: $1,
 		}
 	}
 	;
@@ -127,11 +245,11 @@ meta_entries:
 meta_entry:
 	IDENT '=' STRING_LIT
 	{
-		$$ = &ast.MetaEntry{Key: $1, Value: unquoteString($3)}
+		$$ = &ast.MetaEntry{Key: $1, Value: unquoteString($3), Span: tokenSpan(yylex, $<start>1, $<end>3)}
 	}
 	| IDENT '=' INT_LIT
 	{
-		$$ = &ast.MetaEntry{Key: $1, Value: $3}
+		$$ = &ast.MetaEntry{Key: $1, Value: $3, Span: tokenSpan(yylex, $<start>1, $<end>3)}
 	}
 	;
 
@@ -156,10 +274,15 @@ string_defs:
 string_def:
 	STRING_IDENT '=' string_value modifiers
 	{
+		end := $<end>4
+		if end < 0 {
+			end = $<end>3
+		}
 		$$ = &ast.StringDef{
 			Name:      $1,
 			Value:     $3,
 			Modifiers: $4,
+			Span:      tokenSpan(yylex, $<start>1, end),
 		}
 	}
 	;
@@ -167,16 +290,17 @@ string_def:
 string_value:
 	STRING_LIT
 	{
-		$$ = ast.TextString{Value: unquoteString($1)}
+		$$ = ast.TextString{Value: unquoteString($1), Span: tokenSpan(yylex, $<start>1, $<end>1)}
 	}
 	| REGEX_LIT
 	{
 		pattern, mods := parseRegex($1)
-		$$ = ast.RegexString{Pattern: pattern, Modifiers: mods}
+		$$ = ast.RegexString{Pattern: pattern, Modifiers: mods, Span: tokenSpan(yylex, $<start>1, $<end>1)}
 	}
 	| '{' hex_tokens '}'
 	{
-		$$ = ast.HexString{Tokens: $2}
+		$$ = ast.HexString{Tokens: $2, Span: tokenSpan(yylex, $<start>1, $<end>3)}
+		$<end>$ = $<end>3
 	}
 	;
 
@@ -184,20 +308,15 @@ modifiers:
 	/* empty */
 	{
 		$$ = ast.StringModifiers{}
+		$<end>$ = -1
 	}
 	| modifiers MODIFIER
 	{
 		$$ = $1
-		switch $2 {
-		case "ascii":
-			$$.Ascii = true
-		case "base64":
-			$$.Base64 = true
-		case "fullword":
-			$$.Fullword = true
-		default:
-			yylex.Error("unsupported modifier: " + $2)
+		if err := applyModifier(&$$, $2); err != nil {
+			yylex.(*yaraLexer).errorAt($<start>2, $<end>2, err.Error())
 		}
+		$<end>$ = $<end>2
 	}
 	;
 
@@ -215,19 +334,23 @@ hex_tokens:
 hex_token:
 	HEX_BYTE
 	{
-		$$ = ast.HexByte{Value: $1}
+		$$ = ast.HexByte{Value: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
 	}
 	| HEX_WILDCARD
 	{
-		$$ = ast.HexWildcard{}
+		$$ = ast.HexWildcard{Span: tokenSpan(yylex, $<start>1, $<end>1)}
 	}
 	| HEX_JUMP
 	{
-		$$ = parseHexJump($1)
+		jump := parseHexJump($1)
+		jump.Span = tokenSpan(yylex, $<start>1, $<end>1)
+		$$ = jump
 	}
 	| HEX_ALT
 	{
-		$$ = parseHexAlt($1)
+		alt := parseHexAlt($1)
+		alt.Span = tokenSpan(yylex, $<start>1, $<end>1)
+		$$ = alt
 	}
 	;
 
@@ -245,54 +368,333 @@ expr:
 	}
 	| expr OR expr
 	{
-		$$ = ast.BinaryExpr{Op: "or", Left: $1, Right: $3}
+		$$ = newBinaryExpr("or", $1, $3)
 	}
 	| expr AND expr
 	{
-		$$ = ast.BinaryExpr{Op: "and", Left: $1, Right: $3}
+		$$ = newBinaryExpr("and", $1, $3)
 	}
 	| expr EQ expr
 	{
-		$$ = ast.BinaryExpr{Op: "==", Left: $1, Right: $3}
+		$$ = newBinaryExpr("==", $1, $3)
+	}
+	| expr NEQ expr
+	{
+		$$ = newBinaryExpr("!=", $1, $3)
+	}
+	| expr CONTAINS expr
+	{
+		$$ = newBinaryExpr("contains", $1, $3)
+	}
+	| expr ICONTAINS expr
+	{
+		$$ = newBinaryExpr("icontains", $1, $3)
+	}
+	| expr STARTSWITH expr
+	{
+		$$ = newBinaryExpr("startswith", $1, $3)
+	}
+	| expr ISTARTSWITH expr
+	{
+		$$ = newBinaryExpr("istartswith", $1, $3)
+	}
+	| expr ENDSWITH expr
+	{
+		$$ = newBinaryExpr("endswith", $1, $3)
+	}
+	| expr IENDSWITH expr
+	{
+		$$ = newBinaryExpr("iendswith", $1, $3)
+	}
+	| expr IEQUALS expr
+	{
+		$$ = newBinaryExpr("iequals", $1, $3)
+	}
+	| expr MATCHES REGEX_LIT
+	{
+		pattern, mods := parseRegex($3)
+		$$ = newBinaryExpr("matches", $1, ast.RegexLit{Pattern: pattern, Modifiers: mods, Span: tokenSpan(yylex, $<start>3, $<end>3)})
+	}
+	| expr LT expr
+	{
+		$$ = newBinaryExpr("<", $1, $3)
+	}
+	| expr LE expr
+	{
+		$$ = newBinaryExpr("<=", $1, $3)
+	}
+	| expr GT expr
+	{
+		$$ = newBinaryExpr(">", $1, $3)
+	}
+	| expr GE expr
+	{
+		$$ = newBinaryExpr(">=", $1, $3)
+	}
+	| expr '|' expr
+	{
+		$$ = newBinaryExpr("|", $1, $3)
+	}
+	| expr '^' expr
+	{
+		$$ = newBinaryExpr("^", $1, $3)
+	}
+	| expr '&' expr
+	{
+		$$ = newBinaryExpr("&", $1, $3)
+	}
+	| expr SHL expr
+	{
+		$$ = newBinaryExpr("<<", $1, $3)
+	}
+	| expr SHR expr
+	{
+		$$ = newBinaryExpr(">>", $1, $3)
+	}
+	| expr '+' expr
+	{
+		$$ = newBinaryExpr("+", $1, $3)
+	}
+	| expr '-' expr
+	{
+		$$ = newBinaryExpr("-", $1, $3)
+	}
+	| expr '*' expr
+	{
+		$$ = newBinaryExpr("*", $1, $3)
+	}
+	| expr '\\' expr
+	{
+		$$ = newBinaryExpr("\\", $1, $3)
+	}
+	| expr '%' expr
+	{
+		$$ = newBinaryExpr("%", $1, $3)
+	}
+	| NOT expr
+	{
+		$$ = ast.UnaryExpr{Op: "not", Operand: $2, Span: joinSpans(tokenSpan(yylex, $<start>1, $<end>1), ast.SpanOf($2))}
+	}
+	| '-' expr %prec UNARY_MINUS
+	{
+		$$ = ast.UnaryExpr{Op: "-", Operand: $2, Span: joinSpans(tokenSpan(yylex, $<start>1, $<end>1), ast.SpanOf($2))}
+	}
+	| '~' expr
+	{
+		$$ = ast.UnaryExpr{Op: "~", Operand: $2, Span: joinSpans(tokenSpan(yylex, $<start>1, $<end>1), ast.SpanOf($2))}
+	}
+	| COND_STRING_ID AT expr
+	{
+		ref := ast.StringRef{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+		$$ = ast.AtExpr{Ref: ref, Pos: $3, Span: joinSpans(ref.Span, ast.SpanOf($3))}
+	}
+	| COND_STRING_ID IN range
+	{
+		ref := ast.StringRef{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+		$$ = ast.InExpr{Ref: ref, Range: $3, Span: joinSpans(ref.Span, $3.Span)}
+	}
+	| ANY OF string_set
+	{
+		$$ = newOfExpr(ast.Quantifier{Kind: ast.QuantAny}, $3, tokenSpan(yylex, $<start>1, $<end>3))
+	}
+	| ALL OF string_set
+	{
+		$$ = newOfExpr(ast.Quantifier{Kind: ast.QuantAll}, $3, tokenSpan(yylex, $<start>1, $<end>3))
+	}
+	| NONE OF string_set
+	{
+		$$ = newOfExpr(ast.Quantifier{Kind: ast.QuantNone}, $3, tokenSpan(yylex, $<start>1, $<end>3))
+	}
+	| expr OF string_set
+	{
+		$$ = newOfExpr(ast.Quantifier{Kind: ast.QuantCount, Value: $1}, $3, joinSpans(ast.SpanOf($1), tokenSpan(yylex, $<end>3, $<end>3)))
+	}
+	| expr '%' OF string_set
+	{
+		$$ = newOfExpr(ast.Quantifier{Kind: ast.QuantPercent, Value: $1}, $4, joinSpans(ast.SpanOf($1), tokenSpan(yylex, $<end>4, $<end>4)))
 	}
 	;
 
-primary_expr:
-	'(' expr ')'
+for_quantifier:
+	ANY
+	{
+		$$ = ast.Quantifier{Kind: ast.QuantAny}
+	}
+	| ALL
+	{
+		$$ = ast.Quantifier{Kind: ast.QuantAll}
+	}
+	| NONE
+	{
+		$$ = ast.Quantifier{Kind: ast.QuantNone}
+	}
+	| primary_expr
+	{
+		$$ = ast.Quantifier{Kind: ast.QuantCount, Value: $1}
+	}
+	| primary_expr '%'
+	{
+		$$ = ast.Quantifier{Kind: ast.QuantPercent, Value: $1}
+	}
+	;
+
+iterable:
+	range
+	{
+		$$ = $1
+	}
+	| '(' expr_list ')'
+	{
+		$$ = ast.ValueList{Values: $2, Span: tokenSpan(yylex, $<start>1, $<end>3)}
+	}
+	;
+
+expr_list:
+	expr
+	{
+		$$ = []ast.Expr{$1}
+	}
+	| expr_list ',' expr
+	{
+		$$ = append($1, $3)
+	}
+	;
+
+string_set:
+	THEM
+	{
+		$$ = []string{"them"}
+	}
+	| '(' string_enum ')'
+	{
+		$$ = $2
+		$<end>$ = $<end>3
+	}
+	;
+
+string_enum:
+	COND_STRING_ID
 	{
-		$$ = ast.ParenExpr{Inner: $2}
+		$$ = []string{$1}
 	}
-	| ANY OF THEM
+	| STRING_PATTERN
 	{
-		$$ = ast.AnyOf{Pattern: "them"}
+		$$ = []string{$1}
 	}
-	| ANY OF '(' STRING_PATTERN ')'
+	| string_enum ',' COND_STRING_ID
 	{
-		$$ = ast.AnyOf{Pattern: $4}
+		$$ = append($1, $3)
+	}
+	| string_enum ',' STRING_PATTERN
+	{
+		$$ = append($1, $3)
 	}
-	| ALL OF THEM
+	| COND_IDENT
 	{
-		$$ = ast.AllOf{Pattern: "them"}
+		$$ = []string{$1}
 	}
-	| ALL OF '(' STRING_PATTERN ')'
+	| COND_IDENT '*'
 	{
-		$$ = ast.AllOf{Pattern: $4}
+		$$ = []string{$1 + "*"}
+	}
+	| string_enum ',' COND_IDENT
+	{
+		$$ = append($1, $3)
 	}
-	| COND_STRING_ID AT primary_expr
+	| string_enum ',' COND_IDENT '*'
 	{
-		$$ = ast.AtExpr{Ref: ast.StringRef{Name: $1}, Pos: $3}
+		$$ = append($1, $3+"*")
+	}
+	;
+
+range:
+	'(' expr DOTDOT expr ')'
+	{
+		$$ = ast.Range{Start: $2, End: $4, Span: tokenSpan(yylex, $<start>1, $<end>5)}
+	}
+	;
+
+primary_expr:
+	'(' expr ')'
+	{
+		$$ = ast.ParenExpr{Inner: $2, Span: tokenSpan(yylex, $<start>1, $<end>3)}
 	}
 	| COND_IDENT '(' func_args ')'
 	{
-		$$ = ast.FuncCall{Name: $1, Args: $3}
+		$$ = ast.FuncCall{Name: $1, Args: $3, Span: tokenSpan(yylex, $<start>1, $<end>4)}
+	}
+	| module_expr
+	| FOR for_quantifier OF string_set ':' '(' expr ')'
+	{
+		$$ = ast.ForOfExpr{Quantifier: $2, Strings: $4, Body: $7, Span: tokenSpan(yylex, $<start>1, $<end>8)}
+	}
+	| FOR for_quantifier COND_IDENT IN iterable ':' '(' expr ')'
+	{
+		$$ = ast.ForInExpr{Quantifier: $2, Var: $3, Iterable: $5, Body: $8, Span: tokenSpan(yylex, $<start>1, $<end>9)}
 	}
 	| COND_STRING_ID
 	{
-		$$ = ast.StringRef{Name: $1}
+		$$ = ast.StringRef{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| STRING_COUNT
+	{
+		$$ = ast.StringCount{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| STRING_OFFSET
+	{
+		$$ = ast.StringOffset{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| STRING_OFFSET '[' expr ']'
+	{
+		$$ = ast.StringOffset{Name: $1, Index: $3, Span: tokenSpan(yylex, $<start>1, $<end>4)}
+	}
+	| STRING_LENGTH
+	{
+		$$ = ast.StringLength{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| STRING_LENGTH '[' expr ']'
+	{
+		$$ = ast.StringLength{Name: $1, Index: $3, Span: tokenSpan(yylex, $<start>1, $<end>4)}
 	}
 	| INT_LIT
 	{
-		$$ = ast.IntLit{Value: $1}
+		$$ = newIntLit($1, $<str>1, tokenSpan(yylex, $<start>1, $<end>1))
+	}
+	| FLOAT_LIT
+	{
+		$$ = ast.FloatLit{Value: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| STRING_LIT
+	{
+		$$ = ast.StringLit{Value: unquoteString($1), Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| FILESIZE
+	{
+		$$ = ast.Filesize{Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| ENTRYPOINT
+	{
+		$$ = ast.Entrypoint{Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	;
+
+module_expr:
+	COND_IDENT
+	{
+		$$ = ast.Ident{Name: $1, Span: tokenSpan(yylex, $<start>1, $<end>1)}
+	}
+	| module_expr '.' COND_IDENT
+	{
+		$$ = ast.MemberExpr{Object: $1, Member: $3, Span: joinSpans(ast.SpanOf($1), tokenSpan(yylex, $<start>3, $<end>3))}
+	}
+	| module_expr '[' expr ']'
+	{
+		$$ = ast.IndexExpr{Object: $1, Index: $3, Span: joinSpans(ast.SpanOf($1), tokenSpan(yylex, $<start>4, $<end>4))}
+	}
+	| module_expr '.' COND_IDENT '(' func_args ')'
+	{
+		member := ast.MemberExpr{Object: $1, Member: $3, Span: joinSpans(ast.SpanOf($1), tokenSpan(yylex, $<start>3, $<end>3))}
+		$$ = ast.CallExpr{Func: member, Args: $5, Span: joinSpans(member.Span, tokenSpan(yylex, $<start>6, $<end>6))}
 	}
 	;
 
@@ -301,11 +703,11 @@ func_args:
 	{
 		$$ = nil
 	}
-	| primary_expr
+	| expr
 	{
 		$$ = []ast.Expr{$1}
 	}
-	| func_args ',' primary_expr
+	| func_args ',' expr
 	{
 		$$ = append($1, $3)
 	}
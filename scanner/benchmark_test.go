@@ -23,7 +23,7 @@ func BenchmarkCompileStringLiterals(b *testing.B) {
 		rules[i] = &ast.Rule{
 			Name:      fmt.Sprintf("rule%d", i),
 			Strings:   strs,
-			Condition: ast.AnyOf{Pattern: "them"},
+			Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 		}
 	}
 	rs := &ast.RuleSet{Rules: rules}
@@ -45,7 +45,7 @@ func BenchmarkCompileRegexPatterns(b *testing.B) {
 					{Name: "$a", Value: ast.RegexString{Pattern: `https?://[^\s]+`}},
 					{Name: "$b", Value: ast.RegexString{Pattern: `password\s*=\s*"[^"]+"`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "rule2",
@@ -53,7 +53,7 @@ func BenchmarkCompileRegexPatterns(b *testing.B) {
 					{Name: "$a", Value: ast.RegexString{Pattern: `eval\s*\(`}},
 					{Name: "$b", Value: ast.RegexString{Pattern: `base64.+decode`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -76,7 +76,7 @@ func BenchmarkScanStringLiterals(b *testing.B) {
 					{Name: "$b", Value: ast.TextString{Value: "virus"}},
 					{Name: "$c", Value: ast.TextString{Value: "trojan"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "rule2",
@@ -85,7 +85,7 @@ func BenchmarkScanStringLiterals(b *testing.B) {
 					{Name: "$b", Value: ast.TextString{Value: "base64_decode"}},
 					{Name: "$c", Value: ast.TextString{Value: "exec("}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -112,6 +112,34 @@ func BenchmarkScanStringLiterals(b *testing.B) {
 	}
 }
 
+// BenchmarkScanManyRules scans a small buffer that matches none of many
+// rules, where the cost is dominated by deciding which rules to evaluate.
+func BenchmarkScanManyRules(b *testing.B) {
+	rules := make([]*ast.Rule, 5000)
+	for i := range rules {
+		rules[i] = &ast.Rule{
+			Name: fmt.Sprintf("rule%d", i),
+			Strings: []*ast.StringDef{
+				{Name: "$a", Value: ast.TextString{Value: fmt.Sprintf("pattern_rule%d_a", i)}},
+				{Name: "$b", Value: ast.TextString{Value: fmt.Sprintf("pattern_rule%d_b", i)}},
+			},
+			Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
+		}
+	}
+	compiled, err := Compile(&ast.RuleSet{Rules: rules})
+	if err != nil {
+		b.Fatalf("Compile() error = %v", err)
+	}
+	data := make([]byte, 1024)
+
+	for b.Loop() {
+		var matches MatchRules
+		if err := compiled.ScanMem(data, 0, 30*time.Second, &matches); err != nil {
+			b.Fatalf("ScanMem() error = %v", err)
+		}
+	}
+}
+
 func BenchmarkScanRegexPatterns(b *testing.B) {
 	rs := &ast.RuleSet{
 		Rules: []*ast.Rule{
@@ -121,14 +149,14 @@ func BenchmarkScanRegexPatterns(b *testing.B) {
 					{Name: "$a", Value: ast.RegexString{Pattern: `https?://[^\s]+`}},
 					{Name: "$b", Value: ast.RegexString{Pattern: `password\s*=\s*"[^"]+"`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "rule2",
 				Strings: []*ast.StringDef{
 					{Name: "$a", Value: ast.RegexString{Pattern: `eval\s*\(`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -165,7 +193,7 @@ func BenchmarkScanMixed(b *testing.B) {
 					{Name: "$regex", Value: ast.RegexString{Pattern: `eval\s*\(`}},
 					{Name: "$url", Value: ast.RegexString{Pattern: `https?://[^\s]+`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -4,6 +4,8 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"strings"
 
 	"github.com/sansecio/yargo/ahocorasick"
@@ -23,9 +25,29 @@ type CompileOptions struct {
 	// empty subtype value are never filtered.
 	SkipSubtypes []string
 
+	// SkipValidation skips the semantic checks of Validate, such as for
+	// undefined references and unused strings, compiling whatever rules
+	// can be compiled.
+	SkipValidation bool
+
 	// RegexCompiler overrides the function used to compile regex patterns.
 	// When nil, defaults to go-re2's experimental.CompileLatin1.
 	RegexCompiler CompileFunc
+
+	// Modules are the modules rules may import. Importing a module that is
+	// not listed is a compile error.
+	Modules []Module
+
+	// Externals defines the external variables conditions can refer to by
+	// name, with their default values. Values are integers (any Go integer
+	// type), floats, bools or strings. Rules.WithExternals overrides them
+	// for a scan.
+	Externals map[string]any
+
+	// Console receives the messages modules write while rules are
+	// evaluated, such as those of console.log. When nil, messages are
+	// discarded. Scans running concurrently write to it concurrently.
+	Console io.Writer
 }
 
 const (
@@ -49,11 +71,33 @@ func CompileWithOptions(rs *ast.RuleSet, opts CompileOptions) (*Rules, error) {
 	}
 	opts.RegexCompiler = recoverCompile(opts.RegexCompiler)
 
+	modules, err := resolveModules(rs.Imports, opts.Modules)
+	if err != nil {
+		return nil, err
+	}
+
+	externals, err := compileExternals(opts.Externals, modules)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.SkipValidation {
+		if err := Validate(rs, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Console == nil {
+		opts.Console = io.Discard
+	}
 	rules := &Rules{
-		rules: make([]*compiledRule, 0, len(rs.Rules)),
+		rules:     make([]*compiledRule, 0, len(rs.Rules)),
+		modules:   modules,
+		externals: externals,
+		regexLits: make(map[ast.RegexLit]Regexp),
+		console:   opts.Console,
 	}
 
-	var allPatterns [][]byte
 	var errs []error
 	ruleIdx := 0
 
@@ -76,36 +120,49 @@ func CompileWithOptions(rs *ast.RuleSet, opts CompileOptions) (*Rules, error) {
 		}
 
 		cr := &compiledRule{
-			name:      r.Name,
-			metas:     make([]Meta, len(r.Meta)),
-			condition: r.Condition,
+			name:       r.Name,
+			namespace:  r.Namespace,
+			tags:       r.Tags,
+			private:    r.Private,
+			global:     r.Global,
+			metas:      make([]Meta, len(r.Meta)),
+			condition:  r.Condition,
+			allMatches: inspectsMatches(r.Condition),
 		}
+		cr.minSize, cr.maxSize = filesizeBounds(r.Condition)
 		for i, m := range r.Meta {
 			cr.metas[i] = Meta{Identifier: m.Key, Value: m.Value}
 		}
-		for _, s := range r.Strings {
+		for i, s := range r.Strings {
 			cr.stringNames = append(cr.stringNames, s.Name)
+			cr.allStrings = append(cr.allStrings, i)
+			cr.privateStrings = append(cr.privateStrings, s.Modifiers.Private)
 		}
 		rules.rules = append(rules.rules, cr)
+		rules.needsMatches = append(rules.needsMatches, needsMatches(r.Condition))
+		if r.Global {
+			rules.globals = append(rules.globals, ruleIdx)
+		}
+		if err := compileRegexLits(rules, r.Condition, r.Name, opts); err != nil {
+			errs = append(errs, err)
+		}
 
 		for si, s := range r.Strings {
 			patterns, isRegex := generatePatterns(s)
 			if isRegex {
-				var err error
-				allPatterns, err = compileRegex(rules, s, si, r.Name, ruleIdx, allPatterns, opts)
-				if err != nil {
+				if err := compileRegex(rules, s, si, r.Name, ruleIdx, opts); err != nil {
 					errs = append(errs, err)
 				}
 				continue
 			}
 			for _, p := range patterns {
-				rules.patternMap = append(rules.patternMap, patternRef{
+				rules.addPattern(p.data, patternRef{
 					ruleIndex:   ruleIdx,
 					stringIndex: si,
 					fullword:    s.Modifiers.Fullword,
+					wide:        p.wide,
 					regexIdx:    -1,
-				})
-				allPatterns = append(allPatterns, p)
+				}, s.Modifiers.Nocase)
 			}
 		}
 		ruleIdx++
@@ -114,38 +171,64 @@ func CompileWithOptions(rs *ast.RuleSet, opts CompileOptions) (*Rules, error) {
 	if len(errs) > 0 {
 		return nil, errors.Join(errs...)
 	}
+	if err := linkRules(rules); err != nil {
+		return nil, err
+	}
 
-	rules.patterns = allPatterns
-	if len(allPatterns) > 0 {
+	if len(rules.patterns) > 0 {
 		builder := ahocorasick.NewAhoCorasickBuilder()
-		ac := builder.BuildByte(allPatterns)
+		ac := builder.BuildByte(rules.patterns)
 		rules.matcher = &ac
 	}
+	if len(rules.nocasePatterns) > 0 {
+		builder := ahocorasick.NewAhoCorasickBuilder()
+		builder.AsciiCaseInsensitive(true)
+		ac := builder.BuildByte(rules.nocasePatterns)
+		rules.nocaseMatcher = &ac
+	}
 
 	return rules, nil
 }
 
-func compileRegex(rules *Rules, s *ast.StringDef, stringIndex int, ruleName string, ruleIdx int, allPatterns [][]byte, opts CompileOptions) ([][]byte, error) {
+// addPattern registers an Aho-Corasick pattern, in the case-folding
+// automaton if nocase is set.
+func (r *Rules) addPattern(p []byte, ref patternRef, nocase bool) {
+	if nocase {
+		r.nocasePatterns = append(r.nocasePatterns, p)
+		r.nocasePatternMap = append(r.nocasePatternMap, ref)
+		return
+	}
+	r.patterns = append(r.patterns, p)
+	r.patternMap = append(r.patternMap, ref)
+}
+
+func compileRegex(rules *Rules, s *ast.StringDef, stringIndex int, ruleName string, ruleIdx int, opts CompileOptions) error {
 	var rePattern string
 	var caseInsensitive bool
 
 	switch v := s.Value.(type) {
 	case ast.RegexString:
-		rePattern = buildRE2Pattern(v.Pattern, v.Modifiers)
-		caseInsensitive = v.Modifiers.CaseInsensitive
+		if s.Modifiers.Wide {
+			if opts.SkipInvalidRegex {
+				return nil
+			}
+			return fmt.Errorf("rule %q string %s: wide regular expressions are not supported", ruleName, s.Name)
+		}
+		mods := v.Modifiers
+		mods.CaseInsensitive = mods.CaseInsensitive || s.Modifiers.Nocase
+		rePattern = buildRE2Pattern(v.Pattern, mods)
+		caseInsensitive = mods.CaseInsensitive || hasCaseInsensitiveFlag(v.Pattern)
 	case ast.HexString:
 		rePattern = "(?s)" + hexStringToRegex(v)
-		caseInsensitive = false
 	default:
-		return allPatterns, nil
+		return nil
 	}
 	atoms, hasAtoms := extractAtoms(rePattern, minAtomLength)
-	requiresFullScan := !hasAtoms || caseInsensitive
-	if requiresFullScan {
+	if !hasAtoms {
 		if opts.SkipInvalidRegex {
-			return allPatterns, nil
+			return nil
 		}
-		return nil, fmt.Errorf("rule %q string %s: regex requires full buffer scan", ruleName, s.Name)
+		return fmt.Errorf("rule %q string %s: regex requires full buffer scan", ruleName, s.Name)
 	}
 
 	rp := &regexPattern{
@@ -153,31 +236,62 @@ func compileRegex(rules *Rules, s *ast.StringDef, stringIndex int, ruleName stri
 		compile:     opts.RegexCompiler,
 		ruleIndex:   ruleIdx,
 		stringIndex: stringIndex,
+		fullword:    s.Modifiers.Fullword,
 	}
 	regexIdx := len(rules.regexPatterns)
 	rules.regexPatterns = append(rules.regexPatterns, rp)
 
+	// Atoms of case-insensitive regexes go into the case-folding automaton,
+	// so that every casing of the atom leads to verification.
 	for _, atom := range atoms {
-		rules.patternMap = append(rules.patternMap, patternRef{
-			regexIdx: regexIdx,
-		})
-		allPatterns = append(allPatterns, atom)
+		rules.addPattern(atom, patternRef{regexIdx: regexIdx}, caseInsensitive)
 	}
-	return allPatterns, nil
+	return nil
+}
+
+// compileRegexLits compiles the regular expressions of the matches
+// operators in the condition into rules.regexLits.
+func compileRegexLits(rules *Rules, cond ast.Expr, ruleName string, opts CompileOptions) error {
+	var err error
+	walkExpr(cond, func(e ast.Expr) bool {
+		if err != nil {
+			return false
+		}
+		lit, ok := e.(ast.RegexLit)
+		if !ok {
+			return true
+		}
+		if _, ok := rules.regexLits[lit]; ok {
+			return true
+		}
+		re, cerr := opts.RegexCompiler(buildRE2Pattern(lit.Pattern, lit.Modifiers))
+		if cerr != nil {
+			err = fmt.Errorf("rule %q: regex /%s/: %w", ruleName, lit.Pattern, cerr)
+			return false
+		}
+		rules.regexLits[lit] = re
+		return true
+	})
+	return err
+}
+
+// literal is a byte sequence searched for on behalf of a string.
+type literal struct {
+	data []byte
+	wide bool // UTF-16LE encoded text, so word boundaries span two bytes
 }
 
-func generatePatterns(s *ast.StringDef) ([][]byte, bool) {
+// generatePatterns returns the literals to search for the string, or true
+// if it must be verified with a regex instead.
+func generatePatterns(s *ast.StringDef) ([]literal, bool) {
 	switch v := s.Value.(type) {
 	case ast.TextString:
-		if s.Modifiers.Base64 {
-			return generateBase64Patterns([]byte(v.Value)), false
-		}
-		return [][]byte{[]byte(v.Value)}, false
+		return textLiterals([]byte(v.Value), s.Modifiers), false
 	case ast.RegexString:
 		return nil, true
 	case ast.HexString:
 		if isSimpleHexString(v) {
-			return [][]byte{hexStringToBytes(v)}, false
+			return []literal{{data: hexStringToBytes(v)}}, false
 		}
 		return nil, true
 	default:
@@ -185,6 +299,64 @@ func generatePatterns(s *ast.StringDef) ([][]byte, bool) {
 	}
 }
 
+// textLiterals returns the byte sequences a text string can appear as,
+// according to its ascii, wide, xor and base64 modifiers.
+func textLiterals(data []byte, mods ast.StringModifiers) []literal {
+	var variants []literal
+	if mods.Ascii || !mods.Wide {
+		variants = append(variants, literal{data: data})
+	}
+	if mods.Wide {
+		variants = append(variants, literal{data: widen(data), wide: true})
+	}
+
+	switch {
+	case mods.Xor:
+		xored := make([]literal, 0, len(variants)*(mods.XorMax-mods.XorMin+1))
+		for _, v := range variants {
+			for key := mods.XorMin; key <= mods.XorMax; key++ {
+				xored = append(xored, literal{data: xorBytes(v.data, byte(key)), wide: v.wide})
+			}
+		}
+		return xored
+	case mods.Base64 || mods.Base64Wide:
+		enc := base64.RawStdEncoding
+		if mods.Base64Alphabet != "" {
+			enc = base64.NewEncoding(mods.Base64Alphabet).WithPadding(base64.NoPadding)
+		}
+		var encoded []literal
+		for _, v := range variants {
+			for _, p := range generateBase64Patterns(v.data, enc) {
+				if mods.Base64 {
+					encoded = append(encoded, literal{data: p})
+				}
+				if mods.Base64Wide {
+					encoded = append(encoded, literal{data: widen(p), wide: true})
+				}
+			}
+		}
+		return encoded
+	}
+	return variants
+}
+
+// widen interleaves data with zero bytes, the UTF-16LE form of ASCII text.
+func widen(data []byte) []byte {
+	wide := make([]byte, 0, 2*len(data))
+	for _, b := range data {
+		wide = append(wide, b, 0)
+	}
+	return wide
+}
+
+func xorBytes(data []byte, key byte) []byte {
+	xored := make([]byte, len(data))
+	for i, b := range data {
+		xored[i] = b ^ key
+	}
+	return xored
+}
+
 func isSimpleHexString(h ast.HexString) bool {
 	for _, t := range h.Tokens {
 		if _, ok := t.(ast.HexByte); !ok {
@@ -270,7 +442,9 @@ func writeAlt(sb *strings.Builder, a ast.HexAlt) {
 	sb.WriteByte(')')
 }
 
-func generateBase64Patterns(data []byte) [][]byte {
+// generateBase64Patterns returns the stable parts of the base64 encodings of
+// data at each alignment. enc must not use padding.
+func generateBase64Patterns(data []byte, enc *base64.Encoding) [][]byte {
 	// Each offset aligns data differently within the base64 3-byte groups.
 	// The prefix padding bytes and the number of leading base64 chars to skip
 	// (which depend on the unknown preceding context) vary per offset.
@@ -279,11 +453,11 @@ func generateBase64Patterns(data []byte) [][]byte {
 
 	for _, o := range offsets {
 		padded := append(make([]byte, o.pad), data...)
-		enc := base64.StdEncoding.EncodeToString(padded)
-		if len(enc) <= o.skip {
+		encoded := enc.EncodeToString(padded)
+		if len(encoded) <= o.skip {
 			continue
 		}
-		trimmed := strings.TrimRight(enc[o.skip:], "=")
+		trimmed := encoded[o.skip:]
 		if trim := trailingUnstableChars(len(data) + o.pad); trim > 0 && len(trimmed) > trim {
 			trimmed = trimmed[:len(trimmed)-trim]
 		}
@@ -337,6 +511,177 @@ func recoverCompile(compile CompileFunc) CompileFunc {
 	}
 }
 
+// inspectsMatches reports whether a condition looks at individual match
+// offsets, lengths or counts, in which case every occurrence of a regex string
+// must be collected rather than just the first.
+func inspectsMatches(cond ast.Expr) bool {
+	found := false
+	walkExpr(cond, func(e ast.Expr) bool {
+		switch e.(type) {
+		case ast.AtExpr, ast.InExpr, ast.StringCount, ast.StringOffset, ast.StringLength:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// needsMatches reports whether a condition is false unless one of the
+// rule's strings matches. It is true for string references, and for "and"
+// and "or" of conditions that need matches; conditions like "not $a",
+// "none of them", "#a == 0" or references to filesize, modules, externals
+// and other rules can hold without a match.
+func needsMatches(cond ast.Expr) bool {
+	switch e := cond.(type) {
+	case ast.StringRef, ast.AtExpr, ast.InExpr:
+		return true
+	case ast.ParenExpr:
+		return needsMatches(e.Inner)
+	case ast.BinaryExpr:
+		switch e.Op {
+		case "and":
+			return needsMatches(e.Left) || needsMatches(e.Right)
+		case "or":
+			return needsMatches(e.Left) && needsMatches(e.Right)
+		}
+	case ast.OfExpr:
+		if len(e.Strings) == 0 {
+			return false
+		}
+		switch e.Quantifier.Kind {
+		case ast.QuantAny, ast.QuantAll:
+			return true
+		case ast.QuantCount, ast.QuantPercent:
+			n, ok := e.Quantifier.Value.(ast.IntLit)
+			return ok && n.Value > 0
+		}
+	}
+	return false
+}
+
+// filesizeBounds derives the inclusive range of file sizes for which cond can
+// be true, from comparisons of filesize against integer literals that are
+// joined by "and" at the top level. Other expressions leave the range open.
+func filesizeBounds(cond ast.Expr) (lo, hi int64) {
+	lo, hi = 0, math.MaxInt64
+	switch e := cond.(type) {
+	case ast.ParenExpr:
+		return filesizeBounds(e.Inner)
+	case ast.BinaryExpr:
+		if e.Op == "and" {
+			llo, lhi := filesizeBounds(e.Left)
+			rlo, rhi := filesizeBounds(e.Right)
+			return max(llo, rlo), min(lhi, rhi)
+		}
+		op, lit, ok := filesizeComparison(e)
+		if !ok {
+			return lo, hi
+		}
+		switch op {
+		case "==":
+			return lit.Value, lit.Value
+		case "<":
+			if lit.Value == math.MinInt64 {
+				return 1, 0 // never holds, and lit.Value - 1 wraps
+			}
+			return lo, lit.Value - 1
+		case "<=":
+			return lo, lit.Value
+		case ">":
+			if lit.Value == math.MaxInt64 {
+				return 1, 0 // never holds, and lit.Value + 1 wraps
+			}
+			return lit.Value + 1, hi
+		case ">=":
+			return lit.Value, hi
+		}
+	}
+	return lo, hi
+}
+
+// filesizeComparison matches "filesize op N" or "N op filesize" and returns
+// the comparison normalised to the first form.
+func filesizeComparison(e ast.BinaryExpr) (string, ast.IntLit, bool) {
+	if _, ok := e.Left.(ast.Filesize); ok {
+		lit, ok := e.Right.(ast.IntLit)
+		return e.Op, lit, ok
+	}
+	if _, ok := e.Right.(ast.Filesize); ok {
+		lit, ok := e.Left.(ast.IntLit)
+		switch e.Op {
+		case "<":
+			return ">", lit, ok
+		case "<=":
+			return ">=", lit, ok
+		case ">":
+			return "<", lit, ok
+		case ">=":
+			return "<=", lit, ok
+		}
+		return e.Op, lit, ok
+	}
+	return "", ast.IntLit{}, false
+}
+
+// walkExpr calls fn for expr and its subexpressions in depth-first order.
+// Children of a node are skipped when fn returns false.
+func walkExpr(expr ast.Expr, fn func(ast.Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+	switch e := expr.(type) {
+	case ast.AtExpr:
+		walkExpr(e.Ref, fn)
+		walkExpr(e.Pos, fn)
+	case ast.InExpr:
+		walkExpr(e.Ref, fn)
+		walkExpr(e.Range.Start, fn)
+		walkExpr(e.Range.End, fn)
+	case ast.FuncCall:
+		for _, arg := range e.Args {
+			walkExpr(arg, fn)
+		}
+	case ast.MemberExpr:
+		walkExpr(e.Object, fn)
+	case ast.IndexExpr:
+		walkExpr(e.Object, fn)
+		walkExpr(e.Index, fn)
+	case ast.CallExpr:
+		walkExpr(e.Func, fn)
+		for _, arg := range e.Args {
+			walkExpr(arg, fn)
+		}
+	case ast.BinaryExpr:
+		walkExpr(e.Left, fn)
+		walkExpr(e.Right, fn)
+	case ast.UnaryExpr:
+		walkExpr(e.Operand, fn)
+	case ast.ParenExpr:
+		walkExpr(e.Inner, fn)
+	case ast.OfExpr:
+		walkExpr(e.Quantifier.Value, fn)
+	case ast.ForOfExpr:
+		walkExpr(e.Quantifier.Value, fn)
+		walkExpr(e.Body, fn)
+	case ast.ForInExpr:
+		walkExpr(e.Quantifier.Value, fn)
+		switch it := e.Iterable.(type) {
+		case ast.Range:
+			walkExpr(it.Start, fn)
+			walkExpr(it.End, fn)
+		case ast.ValueList:
+			for _, v := range it.Values {
+				walkExpr(v, fn)
+			}
+		}
+		walkExpr(e.Body, fn)
+	case ast.StringOffset:
+		walkExpr(e.Index, fn)
+	case ast.StringLength:
+		walkExpr(e.Index, fn)
+	}
+}
+
 func metaValue(r *ast.Rule, key string) string {
 	for _, m := range r.Meta {
 		if m.Key == key {
@@ -1,10 +1,13 @@
 package scanner
 
 import (
+	"math"
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/sansecio/yargo/ast"
+	"github.com/sansecio/yargo/parser"
 	"github.com/wasilibs/go-re2/experimental"
 )
 
@@ -16,7 +19,7 @@ func TestCommaQuantifier(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -35,6 +38,27 @@ func TestCommaQuantifier(t *testing.T) {
 	}
 }
 
+func Test_hasCaseInsensitiveFlag(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`(?i)eval\(`, true},
+		{`(?si)eval`, true},
+		{`foo(?i:bar)`, true},
+		{`(?s)eval`, false},
+		{`(?-s:x)`, false},
+		{`\(?i\)`, false},
+		{`[(?i)]abc`, false},
+		{`(eval|exec)`, false},
+	}
+	for _, tt := range tests {
+		if got := hasCaseInsensitiveFlag(tt.pattern); got != tt.want {
+			t.Errorf("hasCaseInsensitiveFlag(%q) = %v, want %v", tt.pattern, got, tt.want)
+		}
+	}
+}
+
 func TestSkipSubtypes(t *testing.T) {
 	rs := &ast.RuleSet{
 		Rules: []*ast.Rule{
@@ -46,7 +70,7 @@ func TestSkipSubtypes(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "evil"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "pii_rule",
@@ -56,7 +80,7 @@ func TestSkipSubtypes(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "ssn"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "generic_rule",
@@ -66,14 +90,14 @@ func TestSkipSubtypes(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "hello"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "no_meta_rule",
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "world"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "empty_subtype_rule",
@@ -83,7 +107,7 @@ func TestSkipSubtypes(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "empty"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -165,7 +189,7 @@ func TestRegexCompilerPanicRecovery(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{0,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -198,7 +222,7 @@ func TestRegexCompilerPanicRecoverySkipInvalid(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{0,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -233,7 +257,7 @@ func TestCustomRegexCompiler(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{0,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -273,7 +297,7 @@ func TestDefaultRegexCompiler(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{0,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -398,3 +422,100 @@ func Test_hexStringToRegex(t *testing.T) {
 		})
 	}
 }
+
+func TestFilesizeBounds(t *testing.T) {
+	tests := []struct {
+		cond   string
+		lo, hi int64
+	}{
+		{`$x`, 0, math.MaxInt64},
+		{`filesize < 2MB and $x`, 0, 2*1024*1024 - 1},
+		{`$x and filesize <= 100`, 0, 100},
+		{`filesize > 10 and (filesize < 20 and $x)`, 11, 19},
+		{`100 > filesize and $x`, 0, 99},
+		{`10 <= filesize and $x`, 10, math.MaxInt64},
+		{`filesize == 42`, 42, 42},
+		{`filesize < 10 or $x`, 0, math.MaxInt64},
+		{`not filesize < 10`, 0, math.MaxInt64},
+		{`filesize > 0x7FFFFFFFFFFFFFFF`, 1, 0},
+		{`filesize <= 0x7FFFFFFFFFFFFFFF`, 0, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			lo, hi := filesizeBounds(parseTestCondition(t, tt.cond))
+			if lo != tt.lo || hi != tt.hi {
+				t.Errorf("filesizeBounds(%s) = [%d, %d], want [%d, %d]", tt.cond, lo, hi, tt.lo, tt.hi)
+			}
+		})
+	}
+
+	cond := ast.BinaryExpr{Op: "<", Left: ast.Filesize{}, Right: ast.IntLit{Value: math.MinInt64}}
+	if lo, hi := filesizeBounds(cond); lo <= hi {
+		t.Errorf("filesizeBounds(filesize < MinInt64) = [%d, %d], want an empty range", lo, hi)
+	}
+}
+
+func TestNeedsMatches(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`$x`, true},
+		{`$x at 0 and filesize < 10`, true},
+		{`any of them or $x in (0..10)`, true},
+		{`2 of them`, true},
+		{`filesize > 10 or $x`, false},
+		{`not $x`, false},
+		{`none of them`, false},
+		{`0 of them`, false},
+		{`#x == 0`, false},
+		{`for any of them : (# == 0)`, false},
+		{`any of (test)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			if got := needsMatches(parseTestCondition(t, tt.cond)); got != tt.want {
+				t.Errorf("needsMatches(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesizeShortCircuit(t *testing.T) {
+	var compiled int
+	compile := func(pattern string) (Regexp, error) {
+		compiled++
+		return regexp.Compile(pattern)
+	}
+
+	rs, err := parser.New().Parse(`
+		rule small { strings: $a = /eval\([a-z]+\)/ condition: filesize < 16 and $a }
+		rule large { strings: $b = "eval" condition: filesize > 1KB and $b }
+	`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := CompileWithOptions(rs, CompileOptions{RegexCompiler: compile})
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	var matches MatchRules
+	if err := rules.ScanMem([]byte("padding... eval(x)"), 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches, got %v", matches)
+	}
+	if compiled != 0 {
+		t.Errorf("expected regex of size-excluded rule not to be compiled, compiled %d times", compiled)
+	}
+
+	matches = nil
+	if err := rules.ScanMem([]byte("eval(x)"), 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	if len(matches) != 1 || matches[0].Rule != "small" {
+		t.Errorf("expected rule 'small' to match, got %v", matches)
+	}
+}
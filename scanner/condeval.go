@@ -2,6 +2,7 @@ package scanner
 
 import (
 	"encoding/binary"
+	"slices"
 	"strings"
 
 	"github.com/sansecio/yargo/ast"
@@ -9,9 +10,25 @@ import (
 
 // evalContext holds the context for evaluating a condition.
 type evalContext struct {
-	matches     map[int][]int // string index -> list of match positions
-	buf         []byte        // the buffer being scanned
-	stringNames []string      // all string names defined in the rule
+	matches     map[int][]int     // string index -> list of match positions
+	lengths     map[int][]int     // string index -> list of match lengths, parallel to matches
+	buf         []byte            // the buffer being scanned
+	stringNames []string          // all string names defined in the rule
+	allStrings  []int             // indices of all strings in the rule, the set "them"
+	modules     map[string]Struct // module name -> values loaded for this scan
+	externals   map[string]any    // external variable name -> value
+	regexLits   map[ast.RegexLit]Regexp
+	ruleIndex   map[string]int   // rule name -> index into ruleResults, in the rule's namespace
+	ruleSets    map[string][]int // rule set element -> rule indices, in the rule's namespace
+	ruleResults []bool           // results of the rules evaluated so far
+	entryPoint  func() (int64, bool)
+	done        <-chan struct{} // closed when the scan times out, stopping loops
+
+	// Loop state: for..of binds the anonymous $, #, @ and ! references to
+	// the string being iterated, for..in binds named integer variables.
+	loopString   int
+	inStringLoop bool
+	vars         map[string]int64
 }
 
 // evalExpr evaluates a condition expression and returns true if it matches.
@@ -34,7 +51,10 @@ func evalExpr(expr ast.Expr, ctx *evalContext) bool {
 		if !ok {
 			return false
 		}
-		pos := evalExprInt(e.Pos, ctx)
+		pos, ok := evalExprInt(e.Pos, ctx)
+		if !ok {
+			return false
+		}
 		for _, p := range positions {
 			if int64(p) == pos {
 				return true
@@ -42,48 +62,162 @@ func evalExpr(expr ast.Expr, ctx *evalContext) bool {
 		}
 		return false
 
+	case ast.InExpr:
+		return evalInExpr(e, ctx)
+
 	case ast.IntLit:
 		return e.Value != 0
 
 	case ast.FuncCall:
 		return evalFuncCall(e, ctx) != 0
 
-	case ast.BinaryExpr:
-		return evalBinaryExpr(e, ctx)
+	case ast.Filesize, ast.Entrypoint, ast.StringCount, ast.StringOffset,
+		ast.StringLength:
+		v, ok := evalExprInt(e, ctx)
+		return ok && v != 0
 
-	case ast.ParenExpr:
-		return evalExpr(e.Inner, ctx)
+	case ast.Ident, ast.MemberExpr, ast.IndexExpr, ast.CallExpr, ast.StringLit,
+		ast.FloatLit, ast.BinaryExpr, ast.UnaryExpr, ast.ParenExpr:
+		v, _ := evalCond(e, ctx)
+		return v
+
+	case ast.OfExpr:
+		return evalOfExpr(e, ctx)
 
-	case ast.AnyOf:
-		return evalAnyOf(e, ctx)
+	case ast.ForOfExpr:
+		return evalForOfExpr(e, ctx)
 
-	case ast.AllOf:
-		return evalAllOf(e, ctx)
+	case ast.ForInExpr:
+		return evalForInExpr(e, ctx)
 
 	default:
 		return false
 	}
 }
 
-// evalExprInt evaluates an expression that should return an integer.
-func evalExprInt(expr ast.Expr, ctx *evalContext) int64 {
+// evalCond evaluates a boolean expression like evalExpr. The second result
+// is false when the value is undefined: as in YARA, an undefined operand
+// makes a comparison or value undefined, "not" keeps it undefined, "and"
+// is false and "or" takes the other operand. An undefined condition does
+// not match.
+func evalCond(expr ast.Expr, ctx *evalContext) (bool, bool) {
+	switch e := expr.(type) {
+	case ast.Ident, ast.MemberExpr, ast.IndexExpr, ast.CallExpr, ast.StringLit,
+		ast.FloatLit:
+		return evalTruthy(e, ctx)
+	case ast.BinaryExpr:
+		return evalBinaryExpr(e, ctx)
+	case ast.UnaryExpr:
+		return evalUnaryExpr(e, ctx)
+	case ast.ParenExpr:
+		return evalCond(e.Inner, ctx)
+	case ast.Filesize, ast.Entrypoint, ast.StringCount, ast.StringOffset,
+		ast.StringLength:
+		v, ok := evalExprInt(e, ctx)
+		return ok && v != 0, ok
+	}
+	return evalExpr(expr, ctx), true
+}
+
+// evalInExpr reports whether the string matched anywhere within the
+// inclusive range. Undefined bounds never match.
+func evalInExpr(e ast.InExpr, ctx *evalContext) bool {
+	idx := ctx.stringIndex(e.Ref.Name)
+	if idx < 0 {
+		return false
+	}
+	positions, ok := ctx.matches[idx]
+	if !ok {
+		return false
+	}
+	start, ok := evalExprInt(e.Range.Start, ctx)
+	if !ok {
+		return false
+	}
+	end, ok := evalExprInt(e.Range.End, ctx)
+	if !ok {
+		return false
+	}
+	for _, p := range positions {
+		if int64(p) >= start && int64(p) <= end {
+			return true
+		}
+	}
+	return false
+}
+
+// evalExprInt evaluates an expression that should return an integer. The
+// second result is false when the value is undefined, for example after a
+// division by zero.
+func evalExprInt(expr ast.Expr, ctx *evalContext) (int64, bool) {
 	switch e := expr.(type) {
 	case ast.IntLit:
-		return e.Value
+		return e.Value, true
 	case ast.FuncCall:
-		return evalFuncCall(e, ctx)
+		return evalFuncCall(e, ctx), true
+	case ast.ParenExpr:
+		return evalExprInt(e.Inner, ctx)
+	case ast.Filesize:
+		return int64(len(ctx.buf)), true
+	case ast.Entrypoint:
+		if ctx.entryPoint == nil {
+			return 0, false
+		}
+		return ctx.entryPoint()
+	case ast.Ident, ast.MemberExpr, ast.IndexExpr, ast.CallExpr:
+		return evalModuleInt(e, ctx)
+	case ast.StringCount:
+		idx := ctx.stringIndex(e.Name)
+		if idx < 0 {
+			return 0, false
+		}
+		return int64(len(ctx.matches[idx])), true
+	case ast.StringOffset:
+		return evalMatchAttr(e.Name, e.Index, ctx.matches, ctx)
+	case ast.StringLength:
+		return evalMatchAttr(e.Name, e.Index, ctx.lengths, ctx)
+	case ast.UnaryExpr:
+		return evalUnaryInt(e, ctx)
+	case ast.BinaryExpr:
+		if isArithmeticOp(e.Op) {
+			return evalArithmetic(e, ctx)
+		}
+		v, ok := evalBinaryExpr(e, ctx)
+		return boolToInt(v), ok
 	default:
-		return 0
+		return 0, false
 	}
 }
 
+// evalMatchAttr returns the offset or length of the index-th (1-based) match
+// of the named string from attrs. A nil index selects the first match. The
+// result is undefined when the string has fewer matches than requested.
+func evalMatchAttr(name string, index ast.Expr, attrs map[int][]int, ctx *evalContext) (int64, bool) {
+	idx := ctx.stringIndex(name)
+	if idx < 0 {
+		return 0, false
+	}
+	i := int64(1)
+	if index != nil {
+		var ok bool
+		if i, ok = evalExprInt(index, ctx); !ok {
+			return 0, false
+		}
+	}
+	values := attrs[idx]
+	if i < 1 || i > int64(len(values)) {
+		return 0, false
+	}
+	return int64(values[i-1]), true
+}
+
 // evalFuncCall evaluates a function call and returns its integer result.
 func evalFuncCall(fn ast.FuncCall, ctx *evalContext) int64 {
 	if len(fn.Args) == 0 {
 		return 0
 	}
-	pos := evalExprInt(fn.Args[0], ctx)
-	if pos < 0 || int(pos) >= len(ctx.buf) {
+	pos, ok := evalExprInt(fn.Args[0], ctx)
+	if !ok || pos < 0 || int(pos) >= len(ctx.buf) {
 		return 0
 	}
 
@@ -120,22 +254,322 @@ func evalFuncCall(fn ast.FuncCall, ctx *evalContext) int64 {
 	}
 }
 
-// evalBinaryExpr evaluates a binary expression.
-func evalBinaryExpr(e ast.BinaryExpr, ctx *evalContext) bool {
+// evalBinaryExpr evaluates a binary expression in boolean context, like
+// evalCond. Arithmetic results are true when non-zero.
+func evalBinaryExpr(e ast.BinaryExpr, ctx *evalContext) (bool, bool) {
 	switch e.Op {
 	case "and":
-		return evalExpr(e.Left, ctx) && evalExpr(e.Right, ctx)
+		return evalExpr(e.Left, ctx) && evalExpr(e.Right, ctx), true
 	case "or":
-		return evalExpr(e.Left, ctx) || evalExpr(e.Right, ctx)
+		left, leftOK := evalCond(e.Left, ctx)
+		if left {
+			return true, true
+		}
+		right, rightOK := evalCond(e.Right, ctx)
+		return right, leftOK || rightOK
+	case "==", "!=", "<", "<=", ">", ">=":
+		return evalComparison(e, ctx)
+	case "contains", "icontains", "startswith", "istartswith", "endswith", "iendswith", "iequals", "matches":
+		return evalStringOp(e, ctx)
+	default:
+		return evalTruthy(e, ctx)
+	}
+}
+
+// evalStringOp evaluates a string operator. The i-prefixed operators fold
+// ASCII case, as in YARA. Undefined operands make it undefined, and
+// non-string operands false.
+func evalStringOp(e ast.BinaryExpr, ctx *evalContext) (bool, bool) {
+	v, ok := evalValue(e.Left, ctx)
+	if !ok {
+		return false, false
+	}
+	left, ok := v.(string)
+	if !ok {
+		return false, true
+	}
+	if e.Op == "matches" {
+		lit, ok := e.Right.(ast.RegexLit)
+		if !ok {
+			return false, true
+		}
+		re := ctx.regexLits[lit]
+		return re != nil && re.FindIndex([]byte(left)) != nil, true
+	}
+	v, ok = evalValue(e.Right, ctx)
+	if !ok {
+		return false, false
+	}
+	right, ok := v.(string)
+	if !ok {
+		return false, true
+	}
+	switch e.Op {
+	case "contains":
+		return strings.Contains(left, right), true
+	case "icontains":
+		return strings.Contains(lowerASCII(left), lowerASCII(right)), true
+	case "startswith":
+		return strings.HasPrefix(left, right), true
+	case "istartswith":
+		return strings.HasPrefix(lowerASCII(left), lowerASCII(right)), true
+	case "endswith":
+		return strings.HasSuffix(left, right), true
+	case "iendswith":
+		return strings.HasSuffix(lowerASCII(left), lowerASCII(right)), true
+	case "iequals":
+		return lowerASCII(left) == lowerASCII(right), true
+	default:
+		return false, true
+	}
+}
+
+// lowerASCII maps the ASCII upper-case letters of s to lower case and
+// leaves all other bytes alone.
+func lowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+// evalComparison evaluates a comparison of two numbers or two strings. An
+// integer compared with a float is promoted to float, and strings compare
+// bytewise. Comparisons involving an undefined operand are undefined, and
+// those of a number and a string false.
+func evalComparison(e ast.BinaryExpr, ctx *evalContext) (bool, bool) {
+	left, ok := evalValue(e.Left, ctx)
+	if !ok {
+		return false, false
+	}
+	right, ok := evalValue(e.Right, ctx)
+	if !ok {
+		return false, false
+	}
+	switch l := left.(type) {
+	case string:
+		r, ok := right.(string)
+		return ok && compare(e.Op, l, r), true
+	case int64:
+		if r, ok := right.(int64); ok {
+			return compare(e.Op, l, r), true
+		}
+	}
+	l, ok := toFloat(left)
+	if !ok {
+		return false, true
+	}
+	r, ok := toFloat(right)
+	return ok && compare(e.Op, l, r), true
+}
+
+func compare[T int64 | float64 | string](op string, left, right T) bool {
+	switch op {
 	case "==":
-		return evalExprInt(e.Left, ctx) == evalExprInt(e.Right, ctx)
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
 	default:
 		return false
 	}
 }
 
+// isArithmeticOp reports whether op is an integer arithmetic or bitwise operator.
+func isArithmeticOp(op string) bool {
+	switch op {
+	case "+", "-", "*", "\\", "%", "&", "|", "^", "<<", ">>":
+		return true
+	}
+	return false
+}
+
+// evalArithmetic evaluates an arithmetic or bitwise expression using 64-bit
+// two's complement wraparound. Division or modulo by zero and negative shift
+// counts are undefined; shifts of 64 bits or more yield 0, as in YARA.
+func evalArithmetic(e ast.BinaryExpr, ctx *evalContext) (int64, bool) {
+	left, ok := evalExprInt(e.Left, ctx)
+	if !ok {
+		return 0, false
+	}
+	right, ok := evalExprInt(e.Right, ctx)
+	if !ok {
+		return 0, false
+	}
+	return intArithmetic(e.Op, left, right)
+}
+
+func intArithmetic(op string, left, right int64) (int64, bool) {
+	switch op {
+	case "+":
+		return left + right, true
+	case "-":
+		return left - right, true
+	case "*":
+		return left * right, true
+	case "\\":
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	case "%":
+		if right == 0 {
+			return 0, false
+		}
+		return left % right, true
+	case "&":
+		return left & right, true
+	case "|":
+		return left | right, true
+	case "^":
+		return left ^ right, true
+	case "<<":
+		if right < 0 {
+			return 0, false
+		}
+		if right >= 64 {
+			return 0, true
+		}
+		return left << right, true
+	case ">>":
+		if right < 0 {
+			return 0, false
+		}
+		if right >= 64 {
+			return 0, true
+		}
+		return left >> right, true
+	default:
+		return 0, false
+	}
+}
+
+// evalArithmeticValue evaluates an arithmetic expression whose operands
+// may be floats. As in YARA, +, -, * and \ promote an integer operand to
+// float when the other operand is a float; the remaining operators take
+// integers only. Float division by zero follows IEEE 754.
+func evalArithmeticValue(e ast.BinaryExpr, ctx *evalContext) (any, bool) {
+	left, ok := evalValue(e.Left, ctx)
+	if !ok {
+		return nil, false
+	}
+	right, ok := evalValue(e.Right, ctx)
+	if !ok {
+		return nil, false
+	}
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			return intArithmetic(e.Op, l, r)
+		}
+	}
+	l, ok := toFloat(left)
+	if !ok {
+		return nil, false
+	}
+	r, ok := toFloat(right)
+	if !ok {
+		return nil, false
+	}
+	switch e.Op {
+	case "+":
+		return l + r, true
+	case "-":
+		return l - r, true
+	case "*":
+		return l * r, true
+	case "\\":
+		return l / r, true
+	default:
+		return nil, false
+	}
+}
+
+// toFloat converts a numeric value to float64.
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// evalTruthy evaluates an expression in a boolean context, where numbers
+// are true when non-zero and strings when non-empty.
+func evalTruthy(expr ast.Expr, ctx *evalContext) (bool, bool) {
+	v, ok := evalValue(expr, ctx)
+	if !ok {
+		return false, false
+	}
+	switch v := v.(type) {
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		return v != "", true
+	default:
+		return false, true
+	}
+}
+
+// evalUnaryExpr evaluates a unary expression in boolean context. "not"
+// of an undefined operand is undefined.
+func evalUnaryExpr(e ast.UnaryExpr, ctx *evalContext) (bool, bool) {
+	switch e.Op {
+	case "not":
+		v, ok := evalCond(e.Operand, ctx)
+		return ok && !v, ok
+	default:
+		return evalTruthy(e, ctx)
+	}
+}
+
+// evalUnaryInt evaluates unary minus, bitwise not, or boolean not as an integer.
+func evalUnaryInt(e ast.UnaryExpr, ctx *evalContext) (int64, bool) {
+	if e.Op == "not" {
+		v, ok := evalUnaryExpr(e, ctx)
+		return boolToInt(v), ok
+	}
+	v, ok := evalExprInt(e.Operand, ctx)
+	if !ok {
+		return 0, false
+	}
+	switch e.Op {
+	case "-":
+		return -v, true
+	case "~":
+		return ^v, true
+	default:
+		return 0, false
+	}
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 // stringIndex returns the index of the named string, or -1 if not found.
+// Inside a for..of loop the anonymous name "$" refers to the current string.
 func (ctx *evalContext) stringIndex(name string) int {
+	if name == "$" && ctx.inStringLoop {
+		return ctx.loopString
+	}
 	for i, n := range ctx.stringNames {
 		if n == name {
 			return i
@@ -144,28 +578,200 @@ func (ctx *evalContext) stringIndex(name string) int {
 	return -1
 }
 
-// evalAnyOf evaluates "any of" expressions.
-func evalAnyOf(e ast.AnyOf, ctx *evalContext) bool {
-	for _, idx := range matchingStringIndices(e.Pattern, ctx.stringNames) {
-		if _, ok := ctx.matches[idx]; ok {
-			return true
+// evalOfExpr evaluates quantified string sets like "2 of ($a*)" and rule
+// sets like "any of (is_*)".
+func evalOfExpr(e ast.OfExpr, ctx *evalContext) bool {
+	if len(e.Rules) > 0 {
+		indices := ctx.ruleSets[e.Rules[0]]
+		if len(e.Rules) > 1 {
+			indices = slices.Clone(indices)
+			for _, name := range e.Rules[1:] {
+				for _, i := range ctx.ruleSets[name] {
+					if !slices.Contains(indices, i) {
+						indices = append(indices, i)
+					}
+				}
+			}
 		}
+		return evalForLoop(e.Quantifier, int64(len(indices)), ctx, func(i int64) bool {
+			return ctx.ruleResults[indices[i]]
+		})
 	}
-	return false
+	indices := ctx.stringSet(e.Strings)
+	return evalForLoop(e.Quantifier, int64(len(indices)), ctx, func(i int64) bool {
+		_, ok := ctx.matches[indices[i]]
+		return ok
+	})
+}
+
+// evalForOfExpr evaluates "for <quantifier> of <set> : (<body>)", binding the
+// anonymous string references to each member of the set in turn.
+func evalForOfExpr(e ast.ForOfExpr, ctx *evalContext) bool {
+	indices := ctx.stringSet(e.Strings)
+	prevString, prevIn := ctx.loopString, ctx.inStringLoop
+	defer func() { ctx.loopString, ctx.inStringLoop = prevString, prevIn }()
+
+	return evalForLoop(e.Quantifier, int64(len(indices)), ctx, func(i int64) bool {
+		ctx.loopString, ctx.inStringLoop = indices[i], true
+		return evalExpr(e.Body, ctx)
+	})
+}
+
+// evalForInExpr evaluates "for <quantifier> <var> in <iterable> : (<body>)".
+// The iterable is evaluated in the enclosing scope; the variable shadows any
+// outer variable of the same name until the loop ends.
+func evalForInExpr(e ast.ForInExpr, ctx *evalContext) bool {
+	var n int64
+	var value func(i int64) (int64, bool)
+
+	switch it := e.Iterable.(type) {
+	case ast.Range:
+		start, ok := evalExprInt(it.Start, ctx)
+		if !ok {
+			return false
+		}
+		end, ok := evalExprInt(it.End, ctx)
+		if !ok {
+			return false
+		}
+		n = max(0, end-start+1)
+		value = func(i int64) (int64, bool) { return start + i, true }
+	case ast.ValueList:
+		values := make([]int64, len(it.Values))
+		defined := make([]bool, len(it.Values))
+		for i, v := range it.Values {
+			values[i], defined[i] = evalExprInt(v, ctx)
+		}
+		n = int64(len(values))
+		value = func(i int64) (int64, bool) { return values[i], defined[i] }
+	default:
+		return false
+	}
+
+	prev, shadowed := ctx.vars[e.Var]
+	if ctx.vars == nil {
+		ctx.vars = make(map[string]int64)
+	}
+	defer func() {
+		if shadowed {
+			ctx.vars[e.Var] = prev
+		} else {
+			delete(ctx.vars, e.Var)
+		}
+	}()
+
+	return evalForLoop(e.Quantifier, n, ctx, func(i int64) bool {
+		v, ok := value(i)
+		if !ok {
+			return false
+		}
+		ctx.vars[e.Var] = v
+		return evalExpr(e.Body, ctx)
+	})
 }
 
-// evalAllOf evaluates "all of" expressions.
-func evalAllOf(e ast.AllOf, ctx *evalContext) bool {
-	indices := matchingStringIndices(e.Pattern, ctx.stringNames)
-	if len(indices) == 0 {
+// evalForLoop reports whether the number of iterations out of n for which
+// body holds satisfies the quantifier. Iteration stops as soon as the outcome
+// is decided. An undefined count or percentage is never satisfied.
+func evalForLoop(q ast.Quantifier, n int64, ctx *evalContext, body func(i int64) bool) bool {
+	if q.Kind == ast.QuantNone {
+		for i := int64(0); i < n; i++ {
+			if ctx.interrupted(i) || body(i) {
+				return false
+			}
+		}
+		return true
+	}
+
+	need, ok := quantifierNeed(q, n, ctx)
+	if !ok {
 		return false
 	}
-	for _, idx := range indices {
-		if _, ok := ctx.matches[idx]; !ok {
+	var satisfied int64
+	for i := int64(0); i < n; i++ {
+		if satisfied >= need {
+			return true
+		}
+		if satisfied+n-i < need || ctx.interrupted(i) {
 			return false
 		}
+		if body(i) {
+			satisfied++
+		}
+	}
+	return satisfied >= need
+}
+
+// loopCheckInterval is the number of loop iterations between checks for
+// the end of the scan.
+const loopCheckInterval = 1024
+
+// interrupted reports whether the scan timed out, checking at every
+// loopCheckInterval-th iteration i. The scan then returns the timeout
+// error, whatever the loop evaluates to.
+func (ctx *evalContext) interrupted(i int64) bool {
+	if i%loopCheckInterval != 0 || ctx.done == nil {
+		return false
+	}
+	select {
+	case <-ctx.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// quantifierNeed returns how many of total items must satisfy a quantifier
+// other than none. A negative count is undefined.
+func quantifierNeed(q ast.Quantifier, total int64, ctx *evalContext) (int64, bool) {
+	switch q.Kind {
+	case ast.QuantAny:
+		return 1, true
+	case ast.QuantAll:
+		return total, total > 0
+	case ast.QuantCount:
+		n, ok := evalExprInt(q.Value, ctx)
+		return n, ok && n >= 0
+	case ast.QuantPercent:
+		pct, ok := evalExprInt(q.Value, ctx)
+		if !ok || total == 0 {
+			return 0, false
+		}
+		// Round up so that 50% of 3 requires 2 items.
+		return (pct*total + 99) / 100, true
+	default:
+		return 0, false
 	}
-	return true
+}
+
+// stringSet returns the indices of the strings in a set like "them" or
+// "($a, $b*)".
+func (ctx *evalContext) stringSet(patterns []string) []int {
+	if len(patterns) == 1 && patterns[0] == "them" && ctx.allStrings != nil {
+		return ctx.allStrings
+	}
+	return stringSetIndices(patterns, ctx.stringNames)
+}
+
+// stringSetIndices returns the indices of strings matching any of the
+// patterns, without duplicates and in definition order.
+func stringSetIndices(patterns []string, stringNames []string) []int {
+	if len(patterns) == 1 {
+		return matchingStringIndices(patterns[0], stringNames)
+	}
+	seen := make([]bool, len(stringNames))
+	for _, pattern := range patterns {
+		for _, idx := range matchingStringIndices(pattern, stringNames) {
+			seen[idx] = true
+		}
+	}
+	var result []int
+	for idx, ok := range seen {
+		if ok {
+			result = append(result, idx)
+		}
+	}
+	return result
 }
 
 // matchingStringIndices returns the indices of strings that match the pattern.
@@ -160,6 +160,216 @@ func TestEvalComparison(t *testing.T) {
 	}
 }
 
+func TestEvalRelational(t *testing.T) {
+	buf := []byte("MZ\x90\x00")
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`uint16(0) == 0x5A4D`, true},
+		{`uint16(0) != 0x5A4D`, false},
+		{`uint16(0) != 0x4D5A`, true},
+		{`uint8(2) < 0x91`, true},
+		{`uint8(2) < 0x90`, false},
+		{`uint8(2) <= 0x90`, true},
+		{`uint8(2) > 0x8F`, true},
+		{`uint8(2) > 0x90`, false},
+		{`uint8(2) >= 0x90`, true},
+		{`uint8(2) >= 0x91`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{buf: buf}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalArithmetic(t *testing.T) {
+	// PE-style header: e_lfanew at 0x3C points to offset 0x40,
+	// and the optional header magic lives at 0x40+0x18.
+	buf := make([]byte, 0x60)
+	buf[0x3C] = 0x40
+	buf[0x58] = 0x0B
+	buf[0x59] = 0x01
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`1 + 2 * 3 == 7`, true},
+		{`(1 + 2) * 3 == 9`, true},
+		{`10 - 4 - 3 == 3`, true},
+		{`7 \ 2 == 3`, true},
+		{`-7 \ 2 == -3`, true},
+		{`7 % 3 == 1`, true},
+		{`-1 < 0`, true},
+		{`0xF0 & 0x3C == 0x30`, true},
+		{`0xF0 | 0x0F == 0xFF`, true},
+		{`0xFF ^ 0x0F == 0xF0`, true},
+		{`~0 == -1`, true},
+		{`1 << 4 == 16`, true},
+		{`256 >> 4 == 16`, true},
+		{`1 << 64 == 0`, true},
+		{`-16 >> 2 == -4`, true},
+		{`0x7FFFFFFFFFFFFFFF + 1 < 0`, true},
+		{`uint16(uint32(0x3C) + 0x18) & 0xFFFF == 0x10B`, true},
+		{`uint16(uint32(0x3C) + 0x18) == 0x20B`, false},
+		{`1 + 1`, true},
+		{`1 - 1`, false},
+		{`1 \ 0 == 0`, false},
+		{`1 \ 0 != 0`, false},
+		{`1 % 0 == 0`, false},
+		{`1 << -1 == 0`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{buf: buf}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalFloat(t *testing.T) {
+	buf := []byte("0123456789")
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`7.5 > 7`, true},
+		{`7.5 < 7`, false},
+		{`2.0 == 2`, true},
+		{`1.5 + 1.5 == 3`, true},
+		{`filesize * 0.5 == 5.0`, true},
+		{`filesize \ 4.0 == 2.5`, true},
+		{`filesize \ 4 == 2`, true},
+		{`-1.5 < -1`, true},
+		{`-(0.5 - 1.0) == 0.5`, true},
+		{`1.0 \ 0 > 1000000`, true},
+		{`0.5`, true},
+		{`0.0`, false},
+		{`0.5 - 0.5`, false},
+		{`not 0.0`, true},
+
+		// Integer-only operators and functions do not take floats.
+		{`5.5 % 2 == 1.5`, false},
+		{`1.0 & 1 == 1`, false},
+		{`uint8(1.0) == 0x31`, false},
+		{`1.0 == "1"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{buf: buf}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalStringAttributes(t *testing.T) {
+	stringNames := []string{"$eval", "$marker", "$none"}
+	matches := map[int][]int{0: {10, 50, 90, 130}, 1: {5, 200}}
+	lengths := map[int][]int{0: {4, 4, 4, 4}, 1: {6, 8}}
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`#eval > 3`, true},
+		{`#eval == 4`, true},
+		{`#eval > 4`, false},
+		{`#none == 0`, true},
+		{`#marker`, true},
+		{`#none`, false},
+		{`@marker[1] < 100`, true},
+		{`@marker[2] < 100`, false},
+		{`@marker == 5`, true},
+		{`@eval[#eval] == 130`, true},
+		{`@eval[0] == 0`, false},
+		{`@eval[5] == 0`, false},
+		{`@eval[5] != 0`, false},
+		{`@none[1] == 0`, false},
+		{`!marker[2] == 8`, true},
+		{`!marker == 6`, true},
+		{`@marker[2] + !marker[2] == 208`, true},
+		{`!none == 0`, false},
+		{`#missing == 0`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: matches, lengths: lengths, stringNames: stringNames}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalInRange(t *testing.T) {
+	stringNames := []string{"$a", "$b", "$none"}
+	matches := map[int][]int{0: {100, 2048}, 1: {50}}
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`$a in (0..1024)`, true},
+		{`$a in (0..99)`, false},
+		{`$a in (100..100)`, true},
+		{`$a in (101..2047)`, false},
+		{`$a in (2048..4096)`, true},
+		{`$a in (@b..@b + 50)`, true},
+		{`$a in (@b..@b + 49)`, false},
+		{`$a in (@none..4096)`, false},
+		{`$a in (0..1 \ 0)`, false},
+		{`$none in (0..4096)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: matches, stringNames: stringNames}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalFilesize(t *testing.T) {
+	buf := make([]byte, 200*1024)
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`filesize == 204800`, true},
+		{`filesize == 200KB`, true},
+		{`filesize < 200KB`, false},
+		{`filesize <= 200KB`, true},
+		{`filesize < 2MB`, true},
+		{`filesize > 1MB`, false},
+		{`$a in (0..filesize - 1)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: map[int][]int{0: {10}}, buf: buf, stringNames: []string{"$a"}}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestEvalAnd(t *testing.T) {
 	stringNames := []string{"$a", "$b"}
 	tests := []struct {
@@ -231,7 +441,7 @@ func TestEvalAnyOf(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			expr := ast.AnyOf{Pattern: tt.pattern}
+			expr := ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{tt.pattern}}
 			ctx := &evalContext{matches: tt.matches, buf: nil, stringNames: tt.strings}
 			got := evalExpr(expr, ctx)
 			if got != tt.want {
@@ -255,7 +465,7 @@ func TestEvalAllOf(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			expr := ast.AllOf{Pattern: tt.pattern}
+			expr := ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAll}, Strings: []string{tt.pattern}}
 			ctx := &evalContext{matches: tt.matches, buf: nil, stringNames: tt.strings}
 			got := evalExpr(expr, ctx)
 			if got != tt.want {
@@ -265,6 +475,124 @@ func TestEvalAllOf(t *testing.T) {
 	}
 }
 
+func TestEvalNot(t *testing.T) {
+	stringNames := []string{"$a", "$b", "$c"}
+	tests := []struct {
+		name    string
+		cond    string
+		matches map[int][]int
+		want    bool
+	}{
+		{"not_unmatched", `not $a`, map[int][]int{}, true},
+		{"not_matched", `not $a`, map[int][]int{0: {0}}, false},
+		{"exclusion_hit", `$a and not $b`, map[int][]int{0: {0}}, true},
+		{"exclusion_miss", `$a and not $b`, map[int][]int{0: {0}, 1: {3}}, false},
+		{"not_group", `$a and not ($b or $c)`, map[int][]int{0: {0}, 2: {5}}, false},
+		{"not_group_none", `$a and not ($b or $c)`, map[int][]int{0: {0}}, true},
+		{"double_not", `not not $a`, map[int][]int{0: {0}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: tt.matches, stringNames: stringNames}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalQuantifiers(t *testing.T) {
+	stringNames := []string{"$a1", "$a2", "$a3", "$b", "$c"}
+	matches := map[int][]int{0: {0}, 1: {1}, 3: {3}}
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`3 of them`, true},
+		{`4 of them`, false},
+		{`2 of ($a*)`, true},
+		{`3 of ($a*)`, false},
+		{`0 of ($c)`, true},
+		{`none of them`, false},
+		{`none of ($a3, $c)`, true},
+		{`none of ($c)`, true},
+		{`any of ($a3, $c)`, false},
+		{`any of ($a3, $b, $c)`, true},
+		{`all of ($a1, $a2, $b)`, true},
+		{`all of ($a*, $b)`, false},
+		{`2 of ($a1, $a*)`, true},
+		{`3 of ($a1, $a*)`, false},
+		{`60% of them`, true},
+		{`61% of them`, false},
+		{`66% of ($a*)`, true},
+		{`67% of ($a*)`, false},
+		{`100% of ($a1, $a2)`, true},
+		{`1 \ 0 of them`, false},
+		{`-1 of them`, false},
+		{`(#a1 - 5) of them`, false},
+		{`for (-1) of them : (# == 1)`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: matches, stringNames: stringNames}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalForLoops(t *testing.T) {
+	stringNames := []string{"$a", "$b", "$c"}
+	matches := map[int][]int{0: {10, 50, 90}, 1: {25, 70, 105}, 2: {500}}
+	lengths := map[int][]int{0: {3, 3, 3}, 1: {4, 4, 4}, 2: {9}}
+	buf := []byte{0, 1, 0, 1, 0}
+
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`for any of ($a, $b) : (@ < 20)`, true},
+		{`for all of ($a, $b) : (@ < 30)`, true},
+		{`for all of them : (@ < 100)`, false},
+		{`for none of them : (@ > 1000)`, true},
+		{`for 2 of them : (# == 3)`, true},
+		{`for 3 of them : (# == 3)`, false},
+		{`for any of them : ($ at 500)`, true},
+		{`for all of ($a, $c) : (! >= 3)`, true},
+		{`for all of ($a*, $b) : ($ in (0..200))`, true},
+		{`for all i in (1..#a) : (@a[i] + 10 < @b[i])`, true},
+		{`for all i in (1..#a) : (@a[i] + 20 < @b[i])`, false},
+		{`for all i in (1..#a) : (@a[i] + 10 <= @b[i] + 5)`, true},
+		{`for any i in (1..3) : (@b[i] == 105)`, true},
+		{`for none i in (1..3) : (@c[i] == 105)`, true},
+		{`for 2 i in (1..3) : (@a[i] > 40)`, true},
+		{`for 3 i in (1..3) : (@a[i] > 40)`, false},
+		{`for 50% n in (0, 2, 4) : (uint8(n) == 0)`, true},
+		{`for 50% n in (0, 1, 3) : (uint8(n) == 0)`, false},
+		{`for all i in (5..1) : (i > 100)`, false},
+		{`for any i in (1..2) : (for any j in (i..2) : (j == 2 and i == 1))`, true},
+		{`for all i in (1..2) : (for all i in (3..4) : (i > 2)) and i == 0`, false},
+		{`for any of ($a) : (for any of ($b) : (@ == 25 and @[3] > 100))`, true},
+		{`for all of ($a) : (#a == 3 and # == 3)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			expr := parseTestCondition(t, tt.cond)
+			ctx := &evalContext{matches: matches, lengths: lengths, buf: buf, stringNames: stringNames}
+			if got := evalExpr(expr, ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+			if len(ctx.vars) != 0 || ctx.inStringLoop {
+				t.Errorf("loop state leaked: vars=%v inStringLoop=%v", ctx.vars, ctx.inStringLoop)
+			}
+		})
+	}
+}
+
 func TestEvalParen(t *testing.T) {
 	// stringNames: $a=0, $b=1, $c=2; matches: $a and $c
 	matches := map[int][]int{0: {0}, 2: {2}}
@@ -366,3 +694,37 @@ func TestEvalComplexCondition3(t *testing.T) {
 		t.Errorf("evalExpr() with no b64 = %v, want false", gotNoB64)
 	}
 }
+
+func TestEvalNotUndefined(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`not (7 \ 0 == 1)`, false},
+		{`not not (7 \ 0 == 1)`, false},
+		{`not (7 \ 1 == 1)`, true},
+		{`not (7 \ 0 == 1) or filesize == 3`, true},
+		{`not (7 \ 0 == 1) and filesize == 3`, false},
+		{`not (pe.missing == 0)`, false},
+		{`not pe.missing`, false},
+		{`not pe.unknown.field`, false},
+		{`not pe.is_dll`, true},
+		{`(not pe.missing) + 1 == 1`, false},
+	}
+	modules := map[string]Struct{"pe": {"missing": nil, "is_dll": int64(0)}}
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			ctx := &evalContext{buf: []byte("abc"), modules: modules}
+			if got := evalExpr(parseTestCondition(t, tt.cond), ctx); got != tt.want {
+				t.Errorf("evalExpr(%s) = %v, want %v", tt.cond, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalMatchesWithoutRegex(t *testing.T) {
+	e := ast.BinaryExpr{Op: "matches", Left: ast.StringLit{Value: "abc"}, Right: ast.StringLit{Value: "abc"}}
+	if v, _ := evalStringOp(e, &evalContext{}); v {
+		t.Error(`"abc" matches "abc" = true, want false`)
+	}
+}
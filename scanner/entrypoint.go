@@ -0,0 +1,83 @@
+package scanner
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+
+	"github.com/sansecio/yargo/internal/exe"
+)
+
+// entryPoint returns the file offset of the entry point of the PE or ELF
+// executable in buf, for the entrypoint keyword. The second result is
+// false for other data or when the entry point lies outside the file.
+func entryPoint(buf []byte) (int64, bool) {
+	switch {
+	case len(buf) >= 0x40 && buf[0] == 'M' && buf[1] == 'Z':
+		return peEntryPoint(buf)
+	case len(buf) >= 4 && string(buf[:4]) == elf.ELFMAG:
+		return elfEntryPoint(buf)
+	}
+	return 0, false
+}
+
+// peEntryPoint maps the optional header's AddressOfEntryPoint to a file
+// offset through the section table. Addresses below the first section
+// fall in the headers.
+func peEntryPoint(buf []byte) (int64, bool) {
+	size := int64(len(buf))
+	u16 := func(off int64) uint16 {
+		if off < 0 || off+2 > size {
+			return 0
+		}
+		return binary.LittleEndian.Uint16(buf[off:])
+	}
+	u32 := func(off int64) uint32 {
+		if off < 0 || off+4 > size {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(buf[off:])
+	}
+
+	nt := int64(u32(0x3c))
+	if nt+24 > size || string(buf[nt:nt+4]) != "PE\x00\x00" {
+		return 0, false
+	}
+	numSections := int64(u16(nt + 6))
+	optSize := int64(u16(nt + 20))
+	if optSize < 20 || nt+24+optSize > size {
+		return 0, false
+	}
+	rva := u32(nt + 24 + 16)
+
+	var sections []exe.Section
+	for i := range numSections {
+		sh := nt + 24 + optSize + 40*i
+		if sh+40 > size {
+			break
+		}
+		sections = append(sections, exe.Section{
+			VirtualSize:    u32(sh + 8),
+			VirtualAddress: u32(sh + 12),
+			RawSize:        u32(sh + 16),
+			RawOffset:      u32(sh + 20),
+		})
+	}
+	return exe.RVAToOffset(sections, rva, size)
+}
+
+// elfEntryPoint maps the entry address to a file offset through the
+// loadable segments, or through the sections when there are no segments.
+func elfEntryPoint(buf []byte) (offset int64, ok bool) {
+	// debug/elf is not hardened against malformed input.
+	defer func() {
+		if recover() != nil {
+			offset, ok = 0, false
+		}
+	}()
+	f, err := elf.NewFile(bytes.NewReader(buf))
+	if err != nil {
+		return 0, false
+	}
+	return exe.AddrToOffset(f, f.Entry, int64(len(buf)))
+}
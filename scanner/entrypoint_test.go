@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/pe"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sansecio/yargo/parser"
+)
+
+var entryCode = []byte{0xe8, 0x00, 0x00, 0x00, 0x00, 0xc3}
+
+// testPE returns a PE image with one section mapping RVA 0x1000 to file
+// offset 0x200 and the entry point at RVA entry.
+func testPE(entry uint32) []byte {
+	var b bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	binary.Write(&b, binary.LittleEndian, pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_I386,
+		NumberOfSections:     1,
+		SizeOfOptionalHeader: uint16(binary.Size(pe.OptionalHeader32{})),
+	})
+	binary.Write(&b, binary.LittleEndian, pe.OptionalHeader32{Magic: 0x10b, AddressOfEntryPoint: entry})
+	section := pe.SectionHeader32{VirtualSize: 0x100, VirtualAddress: 0x1000, SizeOfRawData: 0x200, PointerToRawData: 0x200}
+	copy(section.Name[:], ".text")
+	binary.Write(&b, binary.LittleEndian, section)
+	b.Write(make([]byte, 0x210-b.Len()))
+	b.Write(entryCode)
+	b.Write(make([]byte, 0x400-b.Len()))
+	return b.Bytes()
+}
+
+// testELF returns an ELF executable loaded at 0x400000 with its code right
+// after the program header and the entry point at entry.
+func testELF(entry uint64) []byte {
+	var b bytes.Buffer
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Entry:     entry,
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     1,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	binary.Write(&b, binary.LittleEndian, hdr)
+	size := uint64(64 + 56 + len(entryCode))
+	binary.Write(&b, binary.LittleEndian, elf.Prog64{
+		Type:   uint32(elf.PT_LOAD),
+		Flags:  uint32(elf.PF_R | elf.PF_X),
+		Vaddr:  0x400000,
+		Paddr:  0x400000,
+		Filesz: size,
+		Memsz:  size,
+		Align:  0x1000,
+	})
+	b.Write(entryCode)
+	return b.Bytes()
+}
+
+func TestEntryPoint(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   int64
+		wantOK bool
+	}{
+		{"pe", testPE(0x1010), 0x210, true},
+		{"pe entry in headers", testPE(0x10), 0x10, true},
+		{"pe entry outside sections", testPE(0x5000), 0, false},
+		{"pe truncated", testPE(0x1010)[:0x60], 0, false},
+		{"elf", testELF(0x400078), 0x78, true},
+		{"elf entry outside segments", testELF(0x500000), 0, false},
+		{"elf truncated", testELF(0x400078)[:20], 0, false},
+		{"text", []byte("MZ is not enough"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := entryPoint(tt.data)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("entryPoint() = %#x, %v, want %#x, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEntryPointCondition(t *testing.T) {
+	rs, err := parser.New().Parse(`
+		rule at_entry {
+			strings: $call = { E8 00 00 00 00 }
+			condition: $call at entrypoint
+		}
+		rule entry_byte {
+			strings: $call = { E8 00 00 00 00 }
+			condition: $call and uint8(entrypoint + 5) == 0xc3
+		}
+		rule has_entry {
+			strings: $call = { E8 00 00 00 00 }
+			condition: $call and (entrypoint >= 0 or not (entrypoint >= 0))
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"pe", testPE(0x1010), []string{"at_entry", "entry_byte", "has_entry"}},
+		{"elf", testELF(0x400078), []string{"at_entry", "entry_byte", "has_entry"}},
+		// Without an entry point, a comparison and its negation are both
+		// undefined.
+		{"raw", append([]byte("code: "), entryCode...), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matches MatchRules
+			if err := rules.ScanMem(tt.data, 0, time.Second, &matches); err != nil {
+				t.Fatalf("ScanMem() error = %v", err)
+			}
+			var got []string
+			for _, m := range matches {
+				got = append(got, m.Rule)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"fmt"
+	"maps"
+)
+
+// compileExternals validates the external variable defaults and converts
+// them to the values conditions evaluate. An external may not share its
+// name with an imported module.
+func compileExternals(externals map[string]any, modules []Module) (map[string]any, error) {
+	values := make(map[string]any, len(externals))
+	for name, v := range externals {
+		n, ok := externalValue(v)
+		if !ok {
+			return nil, fmt.Errorf("external %q: unsupported type %T", name, v)
+		}
+		for _, m := range modules {
+			if m.Name() == name {
+				return nil, fmt.Errorf("external %q: conflicts with module %s", name, name)
+			}
+		}
+		values[name] = n
+	}
+	return values, nil
+}
+
+// externalValue converts an external variable value to an int64 (for
+// integers and bools), float64 or string.
+func externalValue(v any) (any, bool) {
+	switch v.(type) {
+	case Struct, Array, Dict, Func:
+		return nil, false
+	}
+	return normalizeValue(v)
+}
+
+// WithExternals returns a copy of the rules in which the given external
+// variables take new values. Only externals defined in
+// CompileOptions.Externals can be set, to a value of the same kind: an
+// integer or bool, a float, or a string. The copy shares everything else
+// with r, so it is cheap to create for a single scan:
+//
+//	scoped, err := rules.WithExternals(map[string]any{"platform": "magento2"})
+//	if err != nil {
+//	    return err
+//	}
+//	err = scoped.ScanMem(buf, 0, time.Minute, &matches)
+func (r *Rules) WithExternals(values map[string]any) (*Rules, error) {
+	externals := maps.Clone(r.externals)
+	for name, v := range values {
+		def, ok := r.externals[name]
+		if !ok {
+			return nil, fmt.Errorf("undefined external %q", name)
+		}
+		n, ok := externalValue(v)
+		if !ok || externalKind(n) != externalKind(def) {
+			return nil, fmt.Errorf("external %q: cannot set %s variable to %T", name, externalKind(def), v)
+		}
+		externals[name] = n
+	}
+	scoped := *r
+	scoped.externals = externals
+	return &scoped, nil
+}
+
+func externalKind(v any) string {
+	switch v.(type) {
+	case int64:
+		return "integer"
+	case float64:
+		return "float"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,152 @@
+package scanner_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/parser"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// externalOpts skips validation to test how conditions on undefined or
+// mistyped externals evaluate.
+var externalOpts = scanner.CompileOptions{Externals: testExternals, SkipValidation: true}
+
+var testExternals = map[string]any{
+	"platform":      "magento2",
+	"version":       2,
+	"ratio":         0.5,
+	"is_admin_path": false,
+	"path":          "/Admin/Index.PHP",
+}
+
+func TestExternalConditions(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`platform == "magento2"`, true},
+		{`platform != "magento2"`, false},
+		{`version == 2 and version + 1 == 3`, true},
+		{`ratio < 1 and ratio * 4 == 2`, true},
+		{`is_admin_path`, false},
+		{`not is_admin_path`, true},
+		{`undefined_name == 0`, false},
+
+		{`platform contains "gento"`, true},
+		{`platform contains "GENTO"`, false},
+		{`platform icontains "GENTO"`, true},
+		{`platform startswith "magento"`, true},
+		{`platform istartswith "MAGENTO"`, true},
+		{`platform endswith "2"`, true},
+		{`path endswith ".php"`, false},
+		{`path iendswith ".php"`, true},
+		{`platform iequals "Magento2"`, true},
+		{`platform iequals "magento"`, false},
+		{`path matches /^\/admin\//`, false},
+		{`path matches /^\/admin\//i`, true},
+		{`path matches /index\.(php|html)$/i and platform matches /magento[12]/`, true},
+		{`version contains "2"`, false},
+		{`platform contains version`, false},
+		{`"/var/www/magento" contains "magento" and platform == "magento2"`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			if got := scantest.Match(t, tt.cond, []byte("data"), externalOpts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalsWithStrings(t *testing.T) {
+	rules := scantest.Compile(t, `rule t { strings: $ = "<?php" condition: $ and platform == "magento2" }`, externalOpts)
+	if len(scantest.Scan(t, rules, []byte("<?php echo 1;"))) == 0 {
+		t.Error("expected match with string and external")
+	}
+	if len(scantest.Scan(t, rules, []byte("<html>"))) > 0 {
+		t.Error("expected no match without the string")
+	}
+}
+
+func TestWithExternals(t *testing.T) {
+	rules := scantest.Compile(t, `
+		rule magento { condition: platform == "magento2" and not is_admin_path }
+		rule wordpress { condition: platform == "wordpress" and version >= 6 }
+	`, externalOpts)
+
+	scoped, err := rules.WithExternals(map[string]any{"platform": "wordpress", "version": uint8(6)})
+	if err != nil {
+		t.Fatalf("WithExternals() error = %v", err)
+	}
+	if matches := scantest.Scan(t, scoped, []byte("data")); !slices.Equal(matches, []string{"wordpress"}) {
+		t.Errorf("expected only wordpress to match, got %v", matches)
+	}
+
+	// The original rules keep their defaults.
+	if matches := scantest.Scan(t, rules, []byte("data")); !slices.Equal(matches, []string{"magento"}) {
+		t.Errorf("expected only magento to match, got %v", matches)
+	}
+
+	scoped, err = rules.WithExternals(map[string]any{"is_admin_path": true})
+	if err != nil {
+		t.Fatalf("WithExternals() error = %v", err)
+	}
+	if len(scantest.Scan(t, scoped, []byte("data"))) > 0 {
+		t.Error("expected no match for an admin path")
+	}
+}
+
+func TestWithExternalsErrors(t *testing.T) {
+	rules := scantest.Compile(t, `rule t { condition: platform == "magento2" }`, externalOpts)
+
+	tests := []struct {
+		values map[string]any
+		want   string
+	}{
+		{map[string]any{"unknown": 1}, `undefined external "unknown"`},
+		{map[string]any{"platform": 1}, `external "platform": cannot set string variable to int`},
+		{map[string]any{"version": "2"}, `external "version": cannot set integer variable to string`},
+		{map[string]any{"ratio": 1}, `external "ratio": cannot set float variable to int`},
+		{map[string]any{"version": []int{1}}, `external "version": cannot set integer variable to []int`},
+	}
+	for _, tt := range tests {
+		if _, err := rules.WithExternals(tt.values); err == nil || err.Error() != tt.want {
+			t.Errorf("WithExternals(%v) error = %v, want %q", tt.values, err, tt.want)
+		}
+	}
+}
+
+func TestCompileExternalsErrors(t *testing.T) {
+	rs, err := parser.New().Parse(`import "test" rule t { condition: test.size > 0 }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tests := []struct {
+		externals map[string]any
+		want      string
+	}{
+		{map[string]any{"bad": struct{}{}}, `external "bad": unsupported type struct {}`},
+		{map[string]any{"test": 1}, `external "test": conflicts with module test`},
+	}
+	for _, tt := range tests {
+		_, err := scanner.CompileWithOptions(rs, scanner.CompileOptions{Modules: []scanner.Module{&testModule{}}, Externals: tt.externals})
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("CompileWithOptions(%v) error = %v, want %q", tt.externals, err, tt.want)
+		}
+	}
+}
+
+func TestMatchesInvalidRegex(t *testing.T) {
+	rs, err := parser.New().Parse(`rule t { condition: platform matches /(unclosed/ }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	_, err = scanner.CompileWithOptions(rs, scanner.CompileOptions{Externals: testExternals})
+	if err == nil || !strings.Contains(err.Error(), `rule "t": regex /(unclosed/`) {
+		t.Errorf("expected regex error, got %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sansecio/yargo/ast"
+)
+
+// Severity is the importance of a lint diagnostic.
+type Severity int
+
+const (
+	// SeverityInfo marks strings that are slower to verify than needed,
+	// such as regexes with .*, but that are only verified near a match of
+	// their atom.
+	SeverityInfo Severity = iota
+	// SeverityWarning marks strings whose literals or atoms match often,
+	// so that they are verified or reported much more often than needed.
+	SeverityWarning
+	// SeverityError marks strings that Compile rejects, such as regexes
+	// without an atom.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// ParseSeverity returns the Severity named name, as returned by String.
+func ParseSeverity(name string) (Severity, error) {
+	for s := SeverityInfo; s <= SeverityError; s++ {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q", name)
+}
+
+// Names of the checks Lint runs, reported in Diagnostic.Check.
+const (
+	CheckFullScan       = "full-scan"        // regex or hex string without an atom
+	CheckLowQualityAtom = "low-quality-atom" // literal or atom scoring below LintOptions.MinAtomQuality
+	CheckCommonToken    = "common-token"     // literal or only literal that is a common token
+	CheckShortLiteral   = "short-literal"    // literal shorter than LintOptions.MinLength
+	CheckShortBase64    = "short-base64"     // base64 string encoding to a pattern shorter than LintOptions.MinLength
+	CheckUnboundedJump  = "unbounded-jump"   // hex jump without an upper bound, like [-] or [4-]
+	CheckDotStar        = "dot-star"         // regex with .* or .+
+	CheckWideRegex      = "wide-regex"       // regex with the wide modifier
+)
+
+// Diagnostic is a problem Lint found with a string.
+type Diagnostic struct {
+	Span       ast.Span
+	Severity   Severity
+	Check      string // one of the Check constants
+	Rule       string
+	StringName string
+	Msg        string
+}
+
+// String formats the diagnostic as
+// "file:line:column: severity: rule "name" string $a: message [check]",
+// without the location if it is unknown.
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.Span.Start.Line > 0 {
+		if d.Span.File != "" {
+			b.WriteString(d.Span.File + ":")
+		}
+		fmt.Fprintf(&b, "%d:%d: ", d.Span.Start.Line, d.Span.Start.Column)
+	}
+	fmt.Fprintf(&b, "%s: rule %q string %s: %s [%s]", d.Severity, d.Rule, d.StringName, d.Msg, d.Check)
+	return b.String()
+}
+
+// MarshalJSON encodes the diagnostic as a flat object with the fields
+// file, line, column, severity, check, rule, string and message.
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File     string `json:"file,omitempty"`
+		Line     int    `json:"line,omitempty"`
+		Column   int    `json:"column,omitempty"`
+		Severity string `json:"severity"`
+		Check    string `json:"check"`
+		Rule     string `json:"rule"`
+		String   string `json:"string"`
+		Message  string `json:"message"`
+	}{
+		File:     d.Span.File,
+		Line:     d.Span.Start.Line,
+		Column:   d.Span.Start.Column,
+		Severity: d.Severity.String(),
+		Check:    d.Check,
+		Rule:     d.Rule,
+		String:   d.StringName,
+		Message:  d.Msg,
+	})
+}
+
+// LintOptions configures Lint. A zero field turns its check off; start
+// from DefaultLintOptions to get the usual thresholds.
+type LintOptions struct {
+	// MinAtomQuality is the lowest atomQuality score of a literal or
+	// atom that is not reported.
+	MinAtomQuality int
+
+	// MinLength is the length of the shortest text or hex literal, or
+	// base64 pattern, that is not reported.
+	MinLength int
+}
+
+// DefaultLintOptions returns the thresholds yargo lint uses by default:
+// a quality of 60, the score of three distinct letters, and a length of 4.
+func DefaultLintOptions() LintOptions {
+	return LintOptions{MinAtomQuality: 60, MinLength: 4}
+}
+
+// Lint reports the strings of rs that make scans slow or are rejected by
+// Compile: literals and regex atoms that match too often, because they
+// are short, score low by atomQuality or are common tokens, base64
+// strings encoding to short patterns, regexes and hex strings without
+// an atom, unbounded hex jumps and regexes with .* or .+. Diagnostics
+// are returned in rule and string order.
+func Lint(rs *ast.RuleSet, opts LintOptions) []Diagnostic {
+	var diags []Diagnostic
+	for _, r := range rs.Rules {
+		for _, s := range r.Strings {
+			l := linter{opts: opts, rule: r, str: s}
+			l.lintString()
+			diags = append(diags, l.diags...)
+		}
+	}
+	return diags
+}
+
+// linter holds the state of Lint for a string.
+type linter struct {
+	opts  LintOptions
+	rule  *ast.Rule
+	str   *ast.StringDef
+	diags []Diagnostic
+}
+
+func (l *linter) report(span ast.Span, severity Severity, check, format string, args ...any) {
+	l.diags = append(l.diags, Diagnostic{
+		Span:       span,
+		Severity:   severity,
+		Check:      check,
+		Rule:       l.rule.Name,
+		StringName: l.str.Name,
+		Msg:        fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) lintString() {
+	switch v := l.str.Value.(type) {
+	case ast.TextString:
+		if l.str.Modifiers.Base64 || l.str.Modifiers.Base64Wide {
+			l.lintBase64([]byte(v.Value))
+		} else {
+			l.lintLiterals(textLiterals([]byte(v.Value), l.str.Modifiers))
+		}
+	case ast.HexString:
+		for _, tok := range v.Tokens {
+			if j, ok := tok.(ast.HexJump); ok && j.Max == nil {
+				l.report(j.Span, SeverityInfo, CheckUnboundedJump, "jump %s has no upper bound", j)
+			}
+		}
+		if isSimpleHexString(v) {
+			l.lintLiterals([]literal{{data: hexStringToBytes(v)}})
+		} else {
+			l.lintAtoms("(?s)" + hexStringToRegex(v))
+		}
+	case ast.RegexString:
+		if l.str.Modifiers.Wide {
+			l.report(l.str.Span, SeverityError, CheckWideRegex, "wide regular expressions are not supported")
+			return
+		}
+		if hasDotStar(v.Pattern) {
+			l.report(l.str.Span, SeverityInfo, CheckDotStar, "regex has .* or .+, matching up to the end of the verification window")
+		}
+		mods := v.Modifiers
+		mods.CaseInsensitive = mods.CaseInsensitive || l.str.Modifiers.Nocase
+		l.lintAtoms(buildRE2Pattern(v.Pattern, mods))
+	}
+}
+
+// lintLiterals checks the literals a string is searched for as, such as
+// the wide and xor forms of a text string, and reports the worst one.
+// Lengths of wide literals count characters, not bytes.
+func (l *linter) lintLiterals(lits []literal) {
+	shortest, worst := -1, lits[0].data
+	for _, lit := range lits {
+		if isCommonToken(lit.data) {
+			l.report(l.str.Span, SeverityWarning, CheckCommonToken, "literal %q is a common token", lit.data)
+			return
+		}
+		n := len(lit.data)
+		if lit.wide {
+			n /= 2
+		}
+		if shortest < 0 || n < shortest {
+			shortest = n
+		}
+		if atomQuality(lit.data) < atomQuality(worst) {
+			worst = lit.data
+		}
+	}
+	switch {
+	case shortest < l.opts.MinLength:
+		l.report(l.str.Span, SeverityWarning, CheckShortLiteral, "literal is %d bytes, want at least %d", shortest, l.opts.MinLength)
+	default:
+		if q := atomQuality(worst); q < l.opts.MinAtomQuality {
+			l.report(l.str.Span, SeverityWarning, CheckLowQualityAtom, "literal %q has quality %d, want at least %d", worst, q, l.opts.MinAtomQuality)
+		}
+	}
+}
+
+// lintBase64 checks the patterns a base64 string is searched for as.
+func (l *linter) lintBase64(data []byte) {
+	shortest := -1
+	for _, lit := range textLiterals(data, l.str.Modifiers) {
+		n := len(lit.data)
+		if lit.wide {
+			n /= 2
+		}
+		if shortest < 0 || n < shortest {
+			shortest = n
+		}
+	}
+	if shortest < l.opts.MinLength {
+		l.report(l.str.Span, SeverityWarning, CheckShortBase64, "base64 encodes to patterns of %d characters, want at least %d", max(shortest, 0), l.opts.MinLength)
+	}
+}
+
+// lintAtoms checks the atoms of a regex, as extracted by compileRegex.
+func (l *linter) lintAtoms(pattern string) {
+	atoms, ok := extractAtoms(pattern, minAtomLength)
+	if !ok {
+		for _, run := range extractLiteralRuns(pattern) {
+			if len(run) >= minAtomLength && isCommonToken(run) {
+				l.report(l.str.Span, SeverityError, CheckCommonToken, "only literal %q is a common token, requiring a full buffer scan", run)
+				return
+			}
+		}
+		l.report(l.str.Span, SeverityError, CheckFullScan, "no literal of %d or more bytes, requiring a full buffer scan", minAtomLength)
+		return
+	}
+	// Every atom is searched for, so the worst one decides how often the
+	// regex is verified.
+	worst := atoms[0]
+	for _, atom := range atoms[1:] {
+		if atomQuality(atom) < atomQuality(worst) {
+			worst = atom
+		}
+	}
+	if q := atomQuality(worst); q < l.opts.MinAtomQuality {
+		l.report(l.str.Span, SeverityWarning, CheckLowQualityAtom, "atom %q has quality %d, want at least %d", worst, q, l.opts.MinAtomQuality)
+	}
+}
+
+// hasDotStar reports whether a regex has a . outside a character class
+// repeated by * or +.
+func hasDotStar(pattern string) bool {
+	for i := 0; i < len(pattern); {
+		switch pattern[i] {
+		case '\\':
+			i += 2
+		case '[':
+			i = skipCharClass(pattern, i)
+		case '.':
+			if i+1 < len(pattern) && (pattern[i+1] == '*' || pattern[i+1] == '+') {
+				return true
+			}
+			i++
+		default:
+			i++
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sansecio/yargo/parser"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		str  string
+		want []string // diagnostics, in order
+	}{
+		{`"eval(base64"`, nil},
+		{`"ab"`, []string{`1:19: warning: rule "a" string $a: literal is 2 bytes, want at least 4 [short-literal]`}},
+		{`"function"`, []string{`1:19: warning: rule "a" string $a: literal "function" is a common token [common-token]`}},
+		{`"          "`, []string{`1:19: warning: rule "a" string $a: literal "          " has quality 22, want at least 60 [low-quality-atom]`}},
+		{`"ab" wide`, []string{`1:19: warning: rule "a" string $a: literal is 2 bytes, want at least 4 [short-literal]`}},
+		{`"eval(base64" wide ascii`, nil},
+		{`"function" xor(0-1)`, []string{`1:19: warning: rule "a" string $a: literal "function" is a common token [common-token]`}},
+		{`"abc" base64`, []string{`1:19: warning: rule "a" string $a: base64 encodes to patterns of 3 characters, want at least 4 [short-base64]`}},
+		{`"system($_GET" base64wide`, nil},
+		{`{ 4D 5A 90 00 }`, nil},
+		{`{ 4D 5A }`, []string{`1:19: warning: rule "a" string $a: literal is 2 bytes, want at least 4 [short-literal]`}},
+		{`{ 4D 5A 90 [-] 00 03 }`, []string{`1:35: info: rule "a" string $a: jump [-] has no upper bound [unbounded-jump]`}},
+		{`{ 4D 5A 90 [4-] 00 03 }`, []string{`1:35: info: rule "a" string $a: jump [4-] has no upper bound [unbounded-jump]`}},
+		{`{ 4D ?? 5A }`, []string{`1:19: error: rule "a" string $a: no literal of 3 or more bytes, requiring a full buffer scan [full-scan]`}},
+		{`/abc/ wide`, []string{`1:19: error: rule "a" string $a: wide regular expressions are not supported [wide-regex]`}},
+		{`/eval\(.*\)/`, []string{`1:19: info: rule "a" string $a: regex has .* or .+, matching up to the end of the verification window [dot-star]`}},
+		{`/eval\(\.*[.*]\)/`, nil},
+		{`/[a-z]+\d/`, []string{`1:19: error: rule "a" string $a: no literal of 3 or more bytes, requiring a full buffer scan [full-scan]`}},
+		{`/return\s+\d/`, []string{`1:19: error: rule "a" string $a: only literal "return" is a common token, requiring a full buffer scan [common-token]`}},
+		{`/(eval|aaa)\(/`, []string{`1:19: warning: rule "a" string $a: atom "aaa" has quality 56, want at least 60 [low-quality-atom]`}},
+	}
+	for _, tt := range tests {
+		src := `rule a { strings: $a = ` + tt.str + ` condition: $a }`
+		rs, err := parser.New().Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", src, err)
+		}
+		var got []string
+		for _, d := range Lint(rs, DefaultLintOptions()) {
+			got = append(got, d.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Lint(%s):\n%s\nwant:\n%s", tt.str, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestLintThresholdsOff(t *testing.T) {
+	rs, err := parser.New().Parse(`rule a { strings: $a = "ab" $b = "          " $c = "abc" base64 condition: any of them }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if diags := Lint(rs, LintOptions{}); len(diags) != 0 {
+		t.Errorf("Lint() with zero thresholds = %v, want no diagnostics", diags)
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	rs, err := parser.New().Parse("rule a {\n strings: $a = \"ab\" condition: $a }")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	diags := Lint(rs, DefaultLintOptions())
+	if len(diags) != 1 {
+		t.Fatalf("Lint() = %v, want 1 diagnostic", diags)
+	}
+	got, err := json.Marshal(diags[0])
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"line":2,"column":11,"severity":"warning","check":"short-literal","rule":"a","string":"$a","message":"literal is 2 bytes, want at least 4"}`
+	if string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+}
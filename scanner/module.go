@@ -0,0 +1,238 @@
+package scanner
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sansecio/yargo/ast"
+)
+
+type (
+	// Module provides values to rule conditions under the name rules import
+	// it by. After `import "pe"`, the condition pe.number_of_sections reads
+	// the number_of_sections field of the structure returned by Load.
+	Module interface {
+		// Name returns the name rules import the module by.
+		Name() string
+
+		// Load is invoked once per scan when a compiled rule imports the
+		// module. It returns the root structure of the module's values.
+		Load(sc *ScanContext) (Struct, error)
+	}
+
+	// ScanContext describes the scan in progress to modules.
+	ScanContext struct {
+		// Data is the buffer being scanned. Modules must not modify it.
+		Data []byte
+
+		// Console receives messages meant for the rule author, as configured
+		// by CompileOptions.Console. It is never nil.
+		Console io.Writer
+	}
+
+	// Struct is a module structure. Its fields are accessed with a dot, as
+	// in pe.machine. Field values are integers (any Go integer type or bool),
+	// floats, strings, Struct, Array, Dict or Func. A missing or nil field
+	// is undefined.
+	Struct map[string]any
+
+	// Array is a module array, indexed with integers from 0 as in
+	// pe.sections[0].
+	Array []any
+
+	// Dict is a module dictionary, indexed with strings.
+	Dict map[string]any
+
+	// Func is a module function, called as in pe.exports("Hello"). It
+	// receives its evaluated arguments, each an int64, float64 or string,
+	// and returns its result, or false if the result is undefined.
+	Func func(args []any) (any, bool)
+)
+
+// resolveModules returns the modules for the ruleset's imports, in import
+// order.
+func resolveModules(imports []string, available []Module) ([]Module, error) {
+	byName := make(map[string]Module, len(available))
+	for _, m := range available {
+		byName[m.Name()] = m
+	}
+	modules := make([]Module, 0, len(imports))
+	for _, name := range imports {
+		m, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown module %q", name)
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// loadModules invokes every imported module for a scan of buf.
+func (r *Rules) loadModules(buf []byte) (map[string]Struct, error) {
+	if len(r.modules) == 0 {
+		return nil, nil
+	}
+	sc := &ScanContext{Data: buf, Console: r.console}
+	values := make(map[string]Struct, len(r.modules))
+	for _, m := range r.modules {
+		v, err := m.Load(sc)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", m.Name(), err)
+		}
+		values[m.Name()] = v
+	}
+	return values, nil
+}
+
+// evalValue evaluates an expression to its value: an int64, float64,
+// string, or a module Struct, Array, Dict or Func. The second result is
+// false when the value is undefined.
+func evalValue(expr ast.Expr, ctx *evalContext) (any, bool) {
+	switch e := expr.(type) {
+	case ast.Ident:
+		if v, ok := ctx.vars[e.Name]; ok {
+			return v, true
+		}
+		if v, ok := ctx.externals[e.Name]; ok {
+			return v, true
+		}
+		if v, ok := ctx.modules[e.Name]; ok {
+			return v, true
+		}
+		if i, ok := ctx.ruleIndex[e.Name]; ok {
+			return boolToInt(ctx.ruleResults[i]), true
+		}
+		return nil, false
+	case ast.MemberExpr:
+		obj, ok := evalValue(e.Object, ctx)
+		if !ok {
+			return nil, false
+		}
+		s, ok := obj.(Struct)
+		if !ok {
+			return nil, false
+		}
+		return normalizeValue(s[e.Member])
+	case ast.IndexExpr:
+		return evalIndexExpr(e, ctx)
+	case ast.CallExpr:
+		callee, ok := evalValue(e.Func, ctx)
+		if !ok {
+			return nil, false
+		}
+		fn, ok := callee.(Func)
+		if !ok {
+			return nil, false
+		}
+		args := make([]any, len(e.Args))
+		for i, arg := range e.Args {
+			if args[i], ok = evalValue(arg, ctx); !ok {
+				return nil, false
+			}
+		}
+		v, ok := fn(args)
+		if !ok {
+			return nil, false
+		}
+		return normalizeValue(v)
+	case ast.StringLit:
+		return e.Value, true
+	case ast.FloatLit:
+		return e.Value, true
+	case ast.BinaryExpr:
+		if isArithmeticOp(e.Op) {
+			return evalArithmeticValue(e, ctx)
+		}
+		v, ok := evalBinaryExpr(e, ctx)
+		return boolToInt(v), ok
+	case ast.UnaryExpr:
+		if e.Op != "-" {
+			v, ok := evalUnaryInt(e, ctx)
+			return v, ok
+		}
+		switch v, _ := evalValue(e.Operand, ctx); v := v.(type) {
+		case int64:
+			return -v, true
+		case float64:
+			return -v, true
+		}
+		return nil, false
+	case ast.ParenExpr:
+		return evalValue(e.Inner, ctx)
+	default:
+		v, ok := evalExprInt(expr, ctx)
+		return v, ok
+	}
+}
+
+func evalIndexExpr(e ast.IndexExpr, ctx *evalContext) (any, bool) {
+	obj, ok := evalValue(e.Object, ctx)
+	if !ok {
+		return nil, false
+	}
+	index, ok := evalValue(e.Index, ctx)
+	if !ok {
+		return nil, false
+	}
+	switch container := obj.(type) {
+	case Array:
+		i, ok := index.(int64)
+		if !ok || i < 0 || i >= int64(len(container)) {
+			return nil, false
+		}
+		return normalizeValue(container[i])
+	case Dict:
+		key, ok := index.(string)
+		if !ok {
+			return nil, false
+		}
+		return normalizeValue(container[key])
+	default:
+		return nil, false
+	}
+}
+
+// normalizeValue converts the Go values modules may return to the forms
+// the evaluator works with. Missing and unsupported values are undefined.
+func normalizeValue(v any) (any, bool) {
+	switch v := v.(type) {
+	case nil:
+		return nil, false
+	case int64, float64, string, Struct, Array, Dict, Func:
+		return v, true
+	case float32:
+		return float64(v), true
+	case bool:
+		return boolToInt(v), true
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	default:
+		return nil, false
+	}
+}
+
+// evalModuleInt evaluates a module expression that should yield an integer.
+func evalModuleInt(expr ast.Expr, ctx *evalContext) (int64, bool) {
+	v, ok := evalValue(expr, ctx)
+	if !ok {
+		return 0, false
+	}
+	n, ok := v.(int64)
+	return n, ok
+}
@@ -0,0 +1,141 @@
+package scanner_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/parser"
+	"github.com/sansecio/yargo/scanner"
+)
+
+// testModule exposes a few values derived from the scanned data and counts
+// how often it is loaded.
+type testModule struct {
+	loads int
+	err   error
+}
+
+func (m *testModule) Name() string { return "test" }
+
+func (m *testModule) Load(sc *scanner.ScanContext) (scanner.Struct, error) {
+	m.loads++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return scanner.Struct{
+		"size":   len(sc.Data),
+		"is_php": strings.HasPrefix(string(sc.Data), "<?php"),
+		"sections": scanner.Array{
+			scanner.Struct{"size": uint32(16)},
+			scanner.Struct{"size": uint32(32)},
+		},
+		"missing": nil,
+		"nested":  scanner.Struct{"answer": int64(42)},
+		"config":  scanner.Dict{"level": 3},
+		"name":    "php",
+		"empty":   "",
+		"double": scanner.Func(func(args []any) (any, bool) {
+			if len(args) != 1 {
+				return nil, false
+			}
+			n, ok := args[0].(int64)
+			return n * 2, ok
+		}),
+	}, nil
+}
+
+func TestModuleConditions(t *testing.T) {
+	tests := []struct {
+		cond string
+		want bool
+	}{
+		{`test.size == 9`, true},
+		{`test.is_php`, true},
+		{`test.nested.answer == 42`, true},
+		{`test.sections[1].size == 32`, true},
+		{`test.sections[0].size + test.sections[1].size == 48`, true},
+		{`test.sections[2].size == 0`, false},
+		{`test.missing == 0`, false},
+		{`test.unknown == 0`, false},
+		{`test.double(21) == 42`, true},
+		{`test.double(test.nested.answer) == 84`, true},
+		{`test.double() == 0`, false},
+		{`test.sections == 0`, false},
+		{`test.config["level"] == 3`, true},
+		{`test.config["other"] == 3`, false},
+		{`test.config[0] == 3`, false},
+		{`test.name == "php"`, true},
+		{`test.name != "php"`, false},
+		{`test.name == "PHP"`, false},
+		{`test.name > "asp" and test.name < "python"`, true},
+		{`test.name == 3`, false},
+		{`test.size == "9"`, false},
+		{`test.missing == "php"`, false},
+		{`test.name`, true},
+		{`test.empty`, false},
+		{`"php" == test.name`, true},
+		{`for any i in (0..1) : (test.sections[i].size == 16)`, true},
+		{`for all i in (0..1) : (test.sections[i].size > 16)`, false},
+		{`uint8(test.size - 1) == 0x3e`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cond, func(t *testing.T) {
+			opts := scanner.CompileOptions{Modules: []scanner.Module{&testModule{}}}
+			if got := scantest.Match(t, tt.cond, []byte("<?php ?>>"), opts); got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleLoadedOncePerScan(t *testing.T) {
+	m := &testModule{}
+	rules := scantest.Compile(t, `
+		import "test"
+		rule a { condition: test.is_php }
+		rule b { strings: $ = "php" condition: $ and test.size > 0 }
+		rule c { strings: $ = "php" condition: $ }
+	`, scanner.CompileOptions{Modules: []scanner.Module{m}})
+
+	for i := 1; i <= 2; i++ {
+		if matches := scantest.Scan(t, rules, []byte("<?php echo 1;")); len(matches) != 3 {
+			t.Errorf("expected 3 matches, got %d", len(matches))
+		}
+		if m.loads != i {
+			t.Errorf("after scan %d: expected %d loads, got %d", i, i, m.loads)
+		}
+	}
+}
+
+func TestModuleNotImported(t *testing.T) {
+	m := &testModule{}
+	rules := scantest.Compile(t, `rule t { strings: $ = "x" condition: $ }`, scanner.CompileOptions{Modules: []scanner.Module{m}})
+	scantest.Scan(t, rules, []byte("x"))
+	if m.loads != 0 {
+		t.Errorf("expected module not to be loaded, got %d loads", m.loads)
+	}
+}
+
+func TestModuleUnknownImport(t *testing.T) {
+	rs, err := parser.New().Parse(`import "pe" rule t { condition: pe.is_dll() }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	_, err = scanner.CompileWithOptions(rs, scanner.CompileOptions{Modules: []scanner.Module{&testModule{}}})
+	if err == nil || !strings.Contains(err.Error(), `unknown module "pe"`) {
+		t.Errorf("expected unknown module error, got %v", err)
+	}
+}
+
+func TestModuleLoadError(t *testing.T) {
+	loadErr := errors.New("boom")
+	rules := scantest.Compile(t, `import "test" rule t { condition: test.is_php }`, scanner.CompileOptions{Modules: []scanner.Module{&testModule{err: loadErr}}})
+	var matches scanner.MatchRules
+	if err := rules.ScanMem([]byte("<?php"), 0, time.Second, &matches); !errors.Is(err, loadErr) {
+		t.Errorf("expected load error, got %v", err)
+	}
+}
@@ -237,3 +237,30 @@ func isOptionalQuantifier(pattern string, i int) bool {
 	}
 	return false
 }
+
+// hasCaseInsensitiveFlag reports whether the regex enables case-insensitive
+// matching anywhere through an inline flag group such as (?i) or (?is:...).
+func hasCaseInsensitiveFlag(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			i = skipCharClass(pattern, i) - 1
+		case '(':
+			if i+1 >= len(pattern) || pattern[i+1] != '?' {
+				continue
+			}
+			for j := i + 2; j < len(pattern); j++ {
+				c := pattern[j]
+				if c == 'i' {
+					return true
+				}
+				if c == '-' || c == ':' || c == ')' || c < 'a' || c > 'z' {
+					break
+				}
+			}
+		}
+	}
+	return false
+}
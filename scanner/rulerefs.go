@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sansecio/yargo/ast"
+)
+
+// linkRules resolves the references between compiled rules: identifiers
+// naming a rule, and the rule sets of expressions like "any of (is_*)".
+// Rules only refer to rules of their own namespace. It fills
+// rules.ruleIndex and rules.ruleSets, and sets rules.order so that every
+// rule is evaluated after the rules it refers to. Cyclic references are an
+// error.
+func linkRules(rules *Rules) error {
+	rules.ruleIndex = make(map[string]map[string]int)
+	rules.ruleSets = make(map[string]map[string][]int)
+	for i, cr := range rules.rules {
+		index, ok := rules.ruleIndex[cr.namespace]
+		if !ok {
+			index = make(map[string]int)
+			rules.ruleIndex[cr.namespace] = index
+			rules.ruleSets[cr.namespace] = make(map[string][]int)
+		}
+		if _, ok := index[cr.name]; !ok {
+			index[cr.name] = i
+		}
+	}
+	for _, cr := range rules.rules {
+		if _, ok := rules.externals[cr.name]; ok {
+			return fmt.Errorf("rule %q: conflicts with external %q", cr.name, cr.name)
+		}
+		for _, m := range rules.modules {
+			if m.Name() == cr.name {
+				return fmt.Errorf("rule %q: conflicts with module %s", cr.name, cr.name)
+			}
+		}
+	}
+
+	deps := make([][]int, len(rules.rules))
+	var errs []error
+	for i, cr := range rules.rules {
+		index := rules.ruleIndex[cr.namespace]
+		walkExpr(cr.condition, func(e ast.Expr) bool {
+			switch e := e.(type) {
+			case ast.Ident:
+				if j, ok := index[e.Name]; ok {
+					deps[i] = append(deps[i], j)
+				}
+			case ast.OfExpr:
+				if len(e.Strings) > 0 && len(e.Rules) > 0 {
+					errs = append(errs, fmt.Errorf("rule %q: set mixes strings and rules", cr.name))
+				}
+				for _, name := range e.Rules {
+					set, err := rules.ruleSet(cr.namespace, name)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("rule %q: %w", cr.name, err))
+					}
+					deps[i] = append(deps[i], set...)
+				}
+			case ast.ForOfExpr:
+				for _, name := range e.Strings {
+					if name != "them" && !strings.HasPrefix(name, "$") {
+						errs = append(errs, fmt.Errorf("rule %q: for..of iterates over strings, not rule %s", cr.name, name))
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	order, err := ruleOrder(rules.rules, deps)
+	if err != nil {
+		return err
+	}
+	rules.order = order
+	return nil
+}
+
+// ruleSet returns the indices of the rules of a namespace that a rule set
+// element selects: the rule of that name, or every rule starting with a
+// prefix ending in *.
+func (r *Rules) ruleSet(namespace, name string) ([]int, error) {
+	if set, ok := r.ruleSets[namespace][name]; ok {
+		return set, nil
+	}
+	var set []int
+	if prefix, ok := strings.CutSuffix(name, "*"); ok {
+		for i, cr := range r.rules {
+			if cr.namespace == namespace && strings.HasPrefix(cr.name, prefix) {
+				set = append(set, i)
+			}
+		}
+		if len(set) == 0 {
+			return nil, fmt.Errorf("no rule matches %s", name)
+		}
+	} else {
+		i, ok := r.ruleIndex[namespace][name]
+		if !ok {
+			return nil, fmt.Errorf("undefined rule %s", name)
+		}
+		set = []int{i}
+	}
+	r.ruleSets[namespace][name] = set
+	return set, nil
+}
+
+// ruleOrder returns the rule indices ordered so that every rule follows
+// the rules it depends on, keeping the definition order otherwise. It
+// returns an error describing the first cycle it finds.
+func ruleOrder(rules []*compiledRule, deps [][]int) ([]int, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(rules))
+	order := make([]int, 0, len(rules))
+	var path []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := path[slices.Index(path, i):]
+			names := make([]string, 0, len(cycle)+1)
+			for _, j := range cycle {
+				names = append(names, rules[j].name)
+			}
+			names = append(names, rules[i].name)
+			return fmt.Errorf("rule %q: cyclic reference %s", rules[i].name, strings.Join(names, " -> "))
+		}
+		state[i] = visiting
+		path = append(path, i)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		order = append(order, i)
+		return nil
+	}
+
+	for i := range rules {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,186 @@
+package scanner_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sansecio/yargo/internal/scantest"
+	"github.com/sansecio/yargo/parser"
+	"github.com/sansecio/yargo/scanner"
+)
+
+func TestRuleReferences(t *testing.T) {
+	rules := scantest.Compile(t, `
+		private rule is_php { strings: $ = "<?php" condition: $ at 0 }
+		rule php_eval { strings: $a = "eval(" condition: is_php and $a }
+		rule not_php { condition: not is_php }
+		rule forward { condition: later and filesize > 0 }
+		rule later { strings: $ = "base64_decode" condition: any of them }
+		rule chained { condition: php_eval and forward }
+	`, scanner.CompileOptions{})
+
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"<?php eval($x);", []string{"php_eval"}},
+		{"<?php eval(base64_decode($x));", []string{"php_eval", "forward", "later", "chained"}},
+		{"<html> eval($x); base64_decode", []string{"not_php", "forward", "later"}},
+		{"", []string{"not_php"}},
+	}
+	for _, tt := range tests {
+		if got := scantest.Scan(t, rules, []byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.want, got)
+		}
+	}
+}
+
+func TestRulesWithoutMatchesAreEvaluated(t *testing.T) {
+	rules := scantest.Compile(t, `
+		rule no_marker { strings: $ = "marker" condition: not any of them }
+		rule small { condition: filesize < 10 }
+	`, scanner.CompileOptions{})
+	if got, want := scantest.Scan(t, rules, []byte("short")), []string{"no_marker", "small"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := scantest.Scan(t, rules, []byte("has a marker")), []string(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRuleSetQuantifiers(t *testing.T) {
+	rules := scantest.Compile(t, `
+		private rule ws_eval { strings: $ = "eval(" condition: $ }
+		private rule ws_system { strings: $ = "system(" condition: $ }
+		private rule ws_assert { strings: $ = "assert(" condition: $ }
+		rule any_ws { condition: any of (ws_*) }
+		rule two_ws { condition: 2 of (ws_*) }
+		rule all_ws { condition: all of (ws_*) }
+		rule no_ws { condition: none of (ws_*) }
+		rule listed { condition: any of (ws_eval, ws_assert) }
+		rule most_ws { condition: 60% of (ws_eval, ws_system*, ws_assert) }
+	`, scanner.CompileOptions{})
+
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"clean", []string{"no_ws"}},
+		{"system($x)", []string{"any_ws"}},
+		{"eval($x)", []string{"any_ws", "listed"}},
+		{"eval($x) system($y)", []string{"any_ws", "two_ws", "listed", "most_ws"}},
+		{"eval($x) system($y) assert($z)", []string{"any_ws", "two_ws", "all_ws", "listed", "most_ws"}},
+	}
+	for _, tt := range tests {
+		if got := scantest.Scan(t, rules, []byte(tt.data)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.want, got)
+		}
+	}
+}
+
+func TestRuleReferenceErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{
+			`rule a { condition: a }`,
+			`rule "a": cyclic reference a -> a`,
+		},
+		{
+			`rule a { condition: b } rule b { condition: c and filesize > 0 } rule c { condition: a }`,
+			`rule "a": cyclic reference a -> b -> c -> a`,
+		},
+		{
+			`rule ws_a { condition: filesize > 0 } rule ws_b { condition: any of (ws_*) }`,
+			`rule "ws_b": cyclic reference ws_b -> ws_b`,
+		},
+		{
+			`rule a { condition: any of (missing) }`,
+			`rule "a": undefined rule missing`,
+		},
+		{
+			`rule a { condition: any of (missing_*) }`,
+			`rule "a": no rule matches missing_*`,
+		},
+		{
+			`rule a { strings: $x = "x" condition: any of ($x, b) } rule b { condition: filesize > 0 }`,
+			`rule "a": set mixes strings and rules`,
+		},
+		{
+			`rule a { condition: for any of (b) : ($) } rule b { condition: filesize > 0 }`,
+			`rule "a": for..of iterates over strings, not rule b`,
+		},
+	}
+	for _, tt := range tests {
+		rs, err := parser.New().Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.src, err)
+		}
+		if _, err := scanner.Compile(rs); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestRuleConflictsWithExternal(t *testing.T) {
+	rs, err := parser.New().Parse(`rule platform { condition: filesize > 0 }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	_, err = scanner.CompileWithOptions(rs, scanner.CompileOptions{Externals: map[string]any{"platform": ""}})
+	if err == nil || err.Error() != `rule "platform": conflicts with external "platform"` {
+		t.Errorf("expected conflict error, got %v", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	fsys := fstest.MapFS{
+		"php.yar": {Data: []byte(`
+			global rule has_php { strings: $ = "<?php" condition: $ }
+			private rule ws_eval { strings: $ = "eval(" condition: $ }
+			rule webshell : php { condition: any of (ws_*) }
+		`)},
+		"js.yar": {Data: []byte(`
+			private rule ws_eval { strings: $ = "eval(atob(" condition: $ }
+			rule webshell : js { condition: ws_eval }
+		`)},
+	}
+	rs, err := parser.NewWithOptions(parser.Options{FS: fsys}).ParseFiles(
+		parser.File{Name: "php.yar", Namespace: "php"},
+		parser.File{Name: "js.yar", Namespace: "js"},
+	)
+	if err != nil {
+		t.Fatalf("ParseFiles() error = %v", err)
+	}
+	rules, err := scanner.Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"<?php eval($x);", []string{"php:has_php", "php:webshell"}},
+		// The global rule of the php namespace does not veto the js rules.
+		{"eval(atob('x'))", []string{"js:webshell"}},
+		{"<?php eval(atob('x'))", []string{"php:has_php", "php:webshell", "js:webshell"}},
+	}
+	for _, tt := range tests {
+		var matches scanner.MatchRules
+		if err := rules.ScanMem([]byte(tt.data), 0, time.Second, &matches); err != nil {
+			t.Fatalf("ScanMem() error = %v", err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Namespace+":"+m.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.want, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package scanner
 
 import (
 	"context"
+	"io"
 	"slices"
 	"sync"
 	"time"
@@ -45,9 +46,11 @@ type (
 
 	// MatchRule represents a rule that matched during scanning.
 	MatchRule struct {
-		Rule    string
-		Metas   []Meta
-		Strings []MatchString
+		Rule      string
+		Namespace string
+		Tags      []string
+		Metas     []Meta
+		Strings   []MatchString
 	}
 
 	// MatchRules collects matching rules and implements ScanCallback.
@@ -60,6 +63,24 @@ type (
 		patterns      [][]byte
 		patternMap    []patternRef
 		regexPatterns []*regexPattern
+
+		// nocaseMatcher folds ASCII case while matching. It holds nocase
+		// text strings and the atoms of case-insensitive regexes.
+		nocaseMatcher    *ahocorasick.AhoCorasick
+		nocasePatterns   [][]byte
+		nocasePatternMap []patternRef
+
+		modules   []Module                    // imported modules, loaded once per scan
+		externals map[string]any              // external variable values, see WithExternals
+		regexLits map[ast.RegexLit]Regexp     // compiled regexes of matches operators
+		ruleIndex map[string]map[string]int   // namespace -> rule name -> index in rules
+		ruleSets  map[string]map[string][]int // namespace -> rule set element like "is_*" -> rule indices
+		order     []int                       // rule indices, each after the rules it refers to
+		globals   []int                       // indices of global rules
+		// needsMatches holds per rule whether its condition is false unless
+		// one of its strings matches, so that it is skipped when none does.
+		needsMatches []bool
+		console      io.Writer // receives module messages, see CompileOptions.Console
 	}
 )
 
@@ -69,6 +90,7 @@ type (
 		ruleIndex   int
 		stringIndex int
 		fullword    bool
+		wide        bool
 		regexIdx    int
 	}
 
@@ -80,14 +102,24 @@ type (
 		re          Regexp
 		ruleIndex   int
 		stringIndex int
+		fullword    bool
 	}
 
 	// compiledRule holds the compiled form of a single YARA rule.
 	compiledRule struct {
-		name        string
-		metas       []Meta
-		condition   ast.Expr
-		stringNames []string
+		name           string
+		namespace      string
+		tags           []string
+		private        bool // evaluated, but not reported to the callback
+		global         bool // vetoes all other rules of its namespace when it does not match
+		metas          []Meta
+		condition      ast.Expr
+		stringNames    []string
+		privateStrings []bool // per string, excluded from MatchRule.Strings
+		allStrings     []int  // indices of all strings, the set "them"
+		allMatches     bool   // condition inspects individual matches, not just their presence
+		minSize        int64  // smallest filesize for which the condition can hold
+		maxSize        int64  // largest filesize for which the condition can hold
 	}
 
 	// matchInfo records the position and data of a single pattern match.
@@ -126,7 +158,7 @@ func (m *MatchRules) RuleMatching(r *MatchRule) (abort bool, err error) {
 
 // Stats returns compilation statistics.
 func (r *Rules) Stats() (acPatterns, regexPatterns int) {
-	return len(r.patterns), len(r.regexPatterns)
+	return len(r.patterns) + len(r.nocasePatterns), len(r.regexPatterns)
 }
 
 // NumRules returns the number of compiled rules.
@@ -151,17 +183,37 @@ func checkWordBoundary(buf []byte, start, end int) bool {
 	return true
 }
 
+// checkWideWordBoundary is checkWordBoundary for UTF-16LE text, where each
+// character is followed by a zero byte.
+func checkWideWordBoundary(buf []byte, start, end int) bool {
+	if start > 1 && buf[start-1] == 0 && isWordChar(buf[start-2]) {
+		return false
+	}
+	if end+1 < len(buf) && isWordChar(buf[end]) && buf[end+1] == 0 {
+		return false
+	}
+	return true
+}
+
 // ScanMem scans a byte buffer for matching rules.
 func (r *Rules) ScanMem(buf []byte, flags ScanFlags, timeout time.Duration, cb ScanCallback) error {
-	if r.matcher == nil && len(r.regexPatterns) == 0 {
+	if len(r.rules) == 0 {
 		return nil
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	if !r.anySizeAllowed(int64(len(buf))) {
+		return nil
+	}
+	modules, err := r.loadModules(buf)
+	if err != nil {
+		return err
+	}
+
 	ruleMatches := r.collectMatches(buf)
-	return r.evaluateRules(ctx, buf, ruleMatches, cb)
+	return r.evaluateRules(ctx, buf, ruleMatches, modules, cb)
 }
 
 // collectMatches runs AC matching, atom-based regex verification, and full-scan
@@ -170,46 +222,57 @@ func (r *Rules) collectMatches(buf []byte) map[int]map[int][]matchInfo {
 	ruleMatches := make(map[int]map[int][]matchInfo)
 	atomCandidates := make(map[int][]int)
 
+	size := int64(len(buf))
 	if r.matcher != nil {
-		iter := r.matcher.IterOverlappingByte(buf)
-		for match := iter.Next(); match != nil; match = iter.Next() {
-			ref := r.patternMap[match.Pattern()]
-
-			if ref.regexIdx >= 0 {
-				atomCandidates[ref.regexIdx] = append(atomCandidates[ref.regexIdx], match.Start())
-				continue
-			}
-
-			if ref.fullword && !checkWordBoundary(buf, match.Start(), match.End()) {
-				continue
-			}
-
-			data := make([]byte, match.End()-match.Start())
-			copy(data, buf[match.Start():match.End()])
-			addMatch(ruleMatches, ref.ruleIndex, ref.stringIndex, match.Start(), data)
-		}
+		r.collectLiteralMatches(buf, r.matcher, r.patternMap, ruleMatches, atomCandidates)
+	}
+	if r.nocaseMatcher != nil {
+		r.collectLiteralMatches(buf, r.nocaseMatcher, r.nocasePatternMap, ruleMatches, atomCandidates)
 	}
 
 	halfWindow := maxMatchLen / 2
 	for regexIdx, positions := range atomCandidates {
 		rp := r.regexPatterns[regexIdx]
+		if !r.rules[rp.ruleIndex].sizeAllowed(size) {
+			continue
+		}
 		re := rp.compiled()
 		if re == nil {
 			continue
 		}
 		positions = dedupe(positions)
+		allMatches := r.rules[rp.ruleIndex].allMatches
 
+		nextStart := 0
+	candidates:
 		for _, pos := range positions {
-			start := max(0, pos-halfWindow)
+			start := max(nextStart, pos-halfWindow)
 			end := min(len(buf), pos+halfWindow)
 
-			if loc := recoverFindIndex(re, buf[start:end]); loc != nil {
+			for start < end {
+				loc := recoverFindIndex(re, buf[start:end])
+				if loc == nil {
+					break
+				}
 				matchStart := start + loc[0]
 				matchEnd := start + loc[1]
+				if rp.fullword && !checkWordBoundary(buf, matchStart, matchEnd) {
+					start = matchStart + 1
+					continue
+				}
 				data := make([]byte, matchEnd-matchStart)
 				copy(data, buf[matchStart:matchEnd])
 				addMatch(ruleMatches, rp.ruleIndex, rp.stringIndex, matchStart, data)
-				break
+				if !allMatches {
+					break candidates
+				}
+				// Keep searching past this match so that every occurrence
+				// is recorded once for counts, offsets and lengths.
+				nextStart = max(matchEnd, matchStart+1)
+				start = nextStart
+				if matchEnd > pos {
+					break
+				}
 			}
 		}
 	}
@@ -217,45 +280,114 @@ func (r *Rules) collectMatches(buf []byte) map[int]map[int][]matchInfo {
 	return ruleMatches
 }
 
-// evaluateRules evaluates conditions for rules with matches, invokes the
-// callback for matching rules, and handles abort/timeout.
-func (r *Rules) evaluateRules(ctx context.Context, buf []byte, ruleMatches map[int]map[int][]matchInfo, cb ScanCallback) error {
-	ruleIndices := make([]int, 0, len(ruleMatches))
-	for ruleIdx := range ruleMatches {
-		ruleIndices = append(ruleIndices, ruleIdx)
+// collectLiteralMatches runs one Aho-Corasick automaton over buf, recording
+// literal matches in ruleMatches and atom hits in atomCandidates.
+func (r *Rules) collectLiteralMatches(buf []byte, matcher *ahocorasick.AhoCorasick, patternMap []patternRef, ruleMatches map[int]map[int][]matchInfo, atomCandidates map[int][]int) {
+	size := int64(len(buf))
+	iter := matcher.IterOverlappingByte(buf)
+	for match := iter.Next(); match != nil; match = iter.Next() {
+		ref := patternMap[match.Pattern()]
+
+		if ref.regexIdx >= 0 {
+			atomCandidates[ref.regexIdx] = append(atomCandidates[ref.regexIdx], match.Start())
+			continue
+		}
+
+		if !r.rules[ref.ruleIndex].sizeAllowed(size) {
+			continue
+		}
+
+		if ref.fullword {
+			boundary := checkWordBoundary
+			if ref.wide {
+				boundary = checkWideWordBoundary
+			}
+			if !boundary(buf, match.Start(), match.End()) {
+				continue
+			}
+		}
+
+		data := make([]byte, match.End()-match.Start())
+		copy(data, buf[match.Start():match.End()])
+		addMatch(ruleMatches, ref.ruleIndex, ref.stringIndex, match.Start(), data)
 	}
-	slices.Sort(ruleIndices)
+}
 
-	for _, ruleIdx := range ruleIndices {
-		matchedStrings := ruleMatches[ruleIdx]
+// sizeAllowed reports whether the rule's filesize constraints can hold for
+// data of the given size.
+func (cr *compiledRule) sizeAllowed(size int64) bool {
+	return size >= cr.minSize && size <= cr.maxSize
+}
+
+// anySizeAllowed reports whether at least one rule can match data of the
+// given size, so that scanning can be skipped entirely otherwise.
+func (r *Rules) anySizeAllowed(size int64) bool {
+	for _, cr := range r.rules {
+		if cr.sizeAllowed(size) {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateRules evaluates the conditions of all rules, each after the
+// rules it refers to, except those that cannot hold without a string match
+// when none of their strings matched. It then invokes the callback for
+// matching rules in definition order. When a global rule does not match,
+// no other rule of its namespace does. Private rules are evaluated for
+// reference but not reported.
+func (r *Rules) evaluateRules(ctx context.Context, buf []byte, ruleMatches map[int]map[int][]matchInfo, modules map[string]Struct, cb ScanCallback) error {
+	size := int64(len(buf))
+	results := make([]bool, len(r.rules))
+	base := evalContext{
+		buf:         buf,
+		modules:     modules,
+		externals:   r.externals,
+		regexLits:   r.regexLits,
+		ruleResults: results,
+		entryPoint:  sync.OnceValues(func() (int64, bool) { return entryPoint(buf) }),
+		done:        ctx.Done(),
+	}
+
+	matched := make([]bool, len(r.rules))
+	for ruleIdx := range ruleMatches {
+		matched[ruleIdx] = true
+	}
+	for _, ruleIdx := range r.order {
+		if !matched[ruleIdx] && r.needsMatches[ruleIdx] {
+			continue
+		}
 		select {
-		case <-ctx.Done():
+		case <-base.done:
 			return ctx.Err()
 		default:
 		}
+		results[ruleIdx] = r.rules[ruleIdx].sizeAllowed(size) && r.evalRule(ruleIdx, ruleMatches[ruleIdx], base)
+	}
+	// Loops stop early when the scan times out, so the last result may be
+	// wrong.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-		cr := r.rules[ruleIdx]
-
-		matchPositions := make(map[int][]int, len(matchedStrings))
-		for idx, infos := range matchedStrings {
-			positions := make([]int, len(infos))
-			for i, info := range infos {
-				positions[i] = info.pos
-			}
-			matchPositions[idx] = positions
+	var vetoed []string // namespaces with a global rule that did not match
+	for _, ruleIdx := range r.globals {
+		if ns := r.rules[ruleIdx].namespace; !results[ruleIdx] && !slices.Contains(vetoed, ns) {
+			vetoed = append(vetoed, ns)
 		}
+	}
 
-		evalCtx := &evalContext{
-			matches:     matchPositions,
-			buf:         buf,
-			stringNames: cr.stringNames,
-		}
-		if !evalExpr(cr.condition, evalCtx) {
+	for ruleIdx, cr := range r.rules {
+		if !results[ruleIdx] || cr.private || slices.Contains(vetoed, cr.namespace) {
 			continue
 		}
 
+		matchedStrings := ruleMatches[ruleIdx]
 		strings := make([]MatchString, 0, len(matchedStrings))
 		for idx, infos := range matchedStrings {
+			if cr.privateStrings[idx] {
+				continue
+			}
 			name := cr.stringNames[idx]
 			for _, info := range infos {
 				strings = append(strings, MatchString{Name: name, Data: info.data})
@@ -263,9 +395,11 @@ func (r *Rules) evaluateRules(ctx context.Context, buf []byte, ruleMatches map[i
 		}
 
 		abort, err := cb.RuleMatching(&MatchRule{
-			Rule:    cr.name,
-			Metas:   cr.metas,
-			Strings: strings,
+			Rule:      cr.name,
+			Namespace: cr.namespace,
+			Tags:      cr.tags,
+			Metas:     cr.metas,
+			Strings:   strings,
 		})
 		if err != nil {
 			return err
@@ -278,6 +412,38 @@ func (r *Rules) evaluateRules(ctx context.Context, buf []byte, ruleMatches map[i
 	return nil
 }
 
+// evalRule evaluates the condition of a rule given its string matches.
+// The matches are sorted by position in place.
+func (r *Rules) evalRule(ruleIdx int, matchedStrings map[int][]matchInfo, base evalContext) bool {
+	cr := r.rules[ruleIdx]
+	evalCtx := base
+	evalCtx.stringNames = cr.stringNames
+	evalCtx.allStrings = cr.allStrings
+	evalCtx.ruleIndex = r.ruleIndex[cr.namespace]
+	evalCtx.ruleSets = r.ruleSets[cr.namespace]
+	if len(matchedStrings) == 0 {
+		return evalExpr(cr.condition, &evalCtx)
+	}
+
+	matchPositions := make(map[int][]int, len(matchedStrings))
+	matchLengths := make(map[int][]int, len(matchedStrings))
+	for idx, infos := range matchedStrings {
+		slices.SortStableFunc(infos, func(a, b matchInfo) int { return a.pos - b.pos })
+		positions := make([]int, len(infos))
+		lengths := make([]int, len(infos))
+		for i, info := range infos {
+			positions[i] = info.pos
+			lengths[i] = len(info.data)
+		}
+		matchPositions[idx] = positions
+		matchLengths[idx] = lengths
+	}
+
+	evalCtx.matches = matchPositions
+	evalCtx.lengths = matchLengths
+	return evalExpr(cr.condition, &evalCtx)
+}
+
 // ScanFile scans a file for matching rules.
 // The implementation is platform-specific:
 //   - Unix (Linux, macOS, BSD): uses mmap for zero-copy file scanning
@@ -1,7 +1,11 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -57,7 +61,7 @@ func TestScanWithPanickingFindIndex(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.RegexString{Pattern: `file_get_contents\(base64_decode\([^)]{0,100}`}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -90,7 +94,7 @@ func TestBasicStringMatch(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$php", Value: ast.TextString{Value: "<?php"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -127,7 +131,7 @@ func TestNoMatch(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$php", Value: ast.TextString{Value: "<?php"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -159,7 +163,7 @@ func TestMultipleStringsInRule(t *testing.T) {
 					{Name: "$a", Value: ast.TextString{Value: "eval"}},
 					{Name: "$b", Value: ast.TextString{Value: "base64_decode"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -194,14 +198,14 @@ func TestMultipleRules(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$php", Value: ast.TextString{Value: "<?php"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "eval_usage",
 				Strings: []*ast.StringDef{
 					{Name: "$eval", Value: ast.TextString{Value: "eval("}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -244,7 +248,7 @@ func TestBase64Modifier(t *testing.T) {
 						Modifiers: ast.StringModifiers{Base64: true},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -294,7 +298,7 @@ func TestMetaExtraction(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "match"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -341,7 +345,7 @@ func TestTimeout(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -360,6 +364,27 @@ func TestTimeout(t *testing.T) {
 	}
 }
 
+func TestTimeoutInLoop(t *testing.T) {
+	rs, err := parser.New().Parse(`rule t { condition: for any i in (0..filesize * 1000000000) : (i < 0) }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	start := time.Now()
+	var matches MatchRules
+	err = rules.ScanMem([]byte("test data"), 0, 50*time.Millisecond, &matches)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ScanMem() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ScanMem() took %v", elapsed)
+	}
+}
+
 func TestEmptyRuleset(t *testing.T) {
 	rs := &ast.RuleSet{
 		Rules: []*ast.Rule{},
@@ -388,7 +413,7 @@ func TestRuleWithNoStrings(t *testing.T) {
 			{
 				Name:      "no_strings",
 				Strings:   []*ast.StringDef{},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -411,6 +436,73 @@ func TestRuleWithNoStrings(t *testing.T) {
 	}
 }
 
+func TestRuleTags(t *testing.T) {
+	rs, err := parser.New().Parse(`
+		rule tagged : webshell php { strings: $ = "eval" condition: any of them }
+		rule untagged { strings: $ = "eval" condition: any of them }
+	`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	var matches MatchRules
+	if err := rules.ScanMem([]byte("eval("), 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(matches))
+	}
+	if want := []string{"webshell", "php"}; !reflect.DeepEqual(matches[0].Tags, want) {
+		t.Errorf("expected tags %q, got %q", want, matches[0].Tags)
+	}
+	if matches[1].Tags != nil {
+		t.Errorf("expected no tags, got %q", matches[1].Tags)
+	}
+}
+
+func TestPrivateAndGlobalRules(t *testing.T) {
+	rs, err := parser.New().Parse(`
+		global rule is_php { strings: $ = "<?php" condition: $ at 0 }
+		global private rule small { condition: filesize < 100 }
+		private rule hidden { strings: $ = "eval" condition: $ }
+		rule webshell { strings: $ = "eval" condition: $ }
+		rule other { strings: $ = "system" condition: $ }
+	`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		data string
+		want []string
+	}{
+		{"<?php eval($x); system($y);", []string{"is_php", "webshell", "other"}},
+		{"<?php echo 1;", []string{"is_php"}},
+		{"<html> eval($x); system($y);", nil},
+		{"<?php eval($x);" + strings.Repeat(" ", 100), nil},
+	}
+	for _, tt := range tests {
+		var matches MatchRules
+		if err := rules.ScanMem([]byte(tt.data), 0, time.Second, &matches); err != nil {
+			t.Fatalf("ScanMem() error = %v", err)
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.want, got)
+		}
+	}
+}
+
 func TestScanCallbackAbort(t *testing.T) {
 	rs := &ast.RuleSet{
 		Rules: []*ast.Rule{
@@ -419,14 +511,14 @@ func TestScanCallbackAbort(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "rule2",
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -477,7 +569,7 @@ func TestFullwordModifier(t *testing.T) {
 						Modifiers: ast.StringModifiers{Fullword: true},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -533,7 +625,7 @@ func TestFullwordWithMultipleMatches(t *testing.T) {
 						Modifiers: ast.StringModifiers{Fullword: true},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -569,7 +661,7 @@ func TestFullwordAtBufferBoundaries(t *testing.T) {
 						Modifiers: ast.StringModifiers{Fullword: true},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -617,7 +709,7 @@ func TestRegexWordBoundary(t *testing.T) {
 						Value: ast.RegexString{Pattern: `\bmalware\b`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -667,7 +759,7 @@ func TestRegexWordBoundaryWithDot(t *testing.T) {
 						Value: ast.RegexString{Pattern: `\bevil\.com\b`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -716,7 +808,7 @@ func TestRegexWordBoundaryWithDash(t *testing.T) {
 						Value: ast.RegexString{Pattern: `\bevil-site\.com\b`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -749,7 +841,7 @@ func TestRegexBasicMatching(t *testing.T) {
 						Value: ast.RegexString{Pattern: `foo[0-9]+bar`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -786,7 +878,7 @@ func TestRegexBasicMatching(t *testing.T) {
 }
 
 func TestRegexCaseInsensitive(t *testing.T) {
-	// Case-insensitive regexes require full buffer scan (no atom acceleration)
+	// Case-insensitive regexes find their atoms through the case-folding automaton
 	rs := &ast.RuleSet{
 		Rules: []*ast.Rule{
 			{
@@ -797,14 +889,51 @@ func TestRegexCaseInsensitive(t *testing.T) {
 						Value: ast.RegexString{Pattern: `malware`, Modifiers: ast.RegexModifiers{CaseInsensitive: true}},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
 
-	_, err := Compile(rs)
-	if err == nil {
-		t.Fatal("expected error for full buffer scan regex, got nil")
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"found malware here", true},
+		{"found MALWARE here", true},
+		{"found MalWare here", true},
+		{"found malwar here", false},
+	}
+	for _, tt := range tests {
+		var matches MatchRules
+		if err := rules.ScanMem([]byte(tt.data), 0, time.Second, &matches); err != nil {
+			t.Fatalf("ScanMem() error = %v", err)
+		}
+		if got := len(matches) > 0; got != tt.want {
+			t.Errorf("%q: match = %v, want %v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestRegexInlineCaseInsensitive(t *testing.T) {
+	rs, err := parser.New().Parse(`rule t { strings: $a = /(?i)eval\(/ condition: $a }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	var matches MatchRules
+	if err := rules.ScanMem([]byte("x = EVAL($_POST['c']);"), 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Errorf("expected 1 match, got %d", len(matches))
 	}
 }
 
@@ -819,7 +948,7 @@ func TestRegexDotMatchesAll(t *testing.T) {
 						Value: ast.RegexString{Pattern: `start.+end`, Modifiers: ast.RegexModifiers{DotMatchesAll: true}},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -865,7 +994,7 @@ func TestRegexDotWithoutSFlag(t *testing.T) {
 						Value: ast.RegexString{Pattern: `start.+end`}, // no s flag
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -910,7 +1039,7 @@ func TestRegexMultiline(t *testing.T) {
 						Value: ast.RegexString{Pattern: `^line`, Modifiers: ast.RegexModifiers{Multiline: true}},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -972,7 +1101,7 @@ func TestRegexComplexPatterns(t *testing.T) {
 								Value: ast.RegexString{Pattern: tt.pattern},
 							},
 						},
-						Condition: ast.AnyOf{Pattern: "them"},
+						Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 					},
 				},
 			}
@@ -1017,7 +1146,7 @@ func TestRegexFullBufferScanError(t *testing.T) {
 								Value: ast.RegexString{Pattern: tt.pattern},
 							},
 						},
-						Condition: ast.AnyOf{Pattern: "them"},
+						Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 					},
 				},
 			}
@@ -1041,7 +1170,7 @@ func TestRegexInvalidPattern(t *testing.T) {
 						Value: ast.RegexString{Pattern: `[unclosed`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1064,7 +1193,7 @@ func TestRegexWordBoundaryBackwardCompatibility(t *testing.T) {
 						Value: ast.RegexString{Pattern: `\btest\b`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1120,7 +1249,7 @@ func TestRegexMixedWithTextStrings(t *testing.T) {
 						Value: ast.RegexString{Pattern: `pattern[0-9]+`},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1186,7 +1315,7 @@ func TestFullwordMixedWithRegular(t *testing.T) {
 						Value: ast.TextString{Value: "test"},
 					},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1231,7 +1360,7 @@ func TestSkipNilCondition(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "match"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name: "no_condition",
@@ -1275,7 +1404,7 @@ func TestAllOfThemCondition(t *testing.T) {
 					{Name: "$a", Value: ast.TextString{Value: "foo"}},
 					{Name: "$b", Value: ast.TextString{Value: "bar"}},
 				},
-				Condition: ast.AllOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAll}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1318,7 +1447,7 @@ func TestAllOfThemAnonymousStrings(t *testing.T) {
 					{Name: "$", Value: ast.TextString{Value: "bar"}},
 					{Name: "$", Value: ast.TextString{Value: "baz"}},
 				},
-				Condition: ast.AllOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAll}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1372,7 +1501,7 @@ func TestAnyOfThemAnonymousStrings(t *testing.T) {
 					{Name: "$", Value: ast.TextString{Value: "bar"}},
 					{Name: "$", Value: ast.TextString{Value: "baz"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1413,7 +1542,7 @@ func TestNoWarningForSupportedCondition(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1491,7 +1620,7 @@ func TestRegexWindowCentering(t *testing.T) {
 								Value: ast.RegexString{Pattern: tt.pattern},
 							},
 						},
-						Condition: ast.AnyOf{Pattern: "them"},
+						Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 					},
 				},
 			}
@@ -1558,7 +1687,7 @@ func TestRegexWindowCenteringEdgeCases(t *testing.T) {
 								Value: ast.RegexString{Pattern: tt.pattern},
 							},
 						},
-						Condition: ast.AnyOf{Pattern: "them"},
+						Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 					},
 				},
 			}
@@ -1638,7 +1767,7 @@ func TestScanFile(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$php", Value: ast.TextString{Value: "<?php"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1683,7 +1812,7 @@ func TestScanFileNoMatch(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$php", Value: ast.TextString{Value: "<?php"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1724,7 +1853,7 @@ func TestScanFileNotFound(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1749,7 +1878,7 @@ func TestScanFileEmptyFile(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "test"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1785,7 +1914,7 @@ func TestScanFileLargeFile(t *testing.T) {
 				Strings: []*ast.StringDef{
 					{Name: "$s", Value: ast.TextString{Value: "MARKER_STRING"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1836,17 +1965,17 @@ func TestMatchOrderDeterministic(t *testing.T) {
 			{
 				Name:      "rule_ccc",
 				Strings:   []*ast.StringDef{{Name: "$s", Value: ast.TextString{Value: "test"}}},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name:      "rule_aaa",
 				Strings:   []*ast.StringDef{{Name: "$s", Value: ast.TextString{Value: "test"}}},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 			{
 				Name:      "rule_bbb",
 				Strings:   []*ast.StringDef{{Name: "$s", Value: ast.TextString{Value: "test"}}},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1891,7 +2020,7 @@ func TestScanFileMatchesScanMem(t *testing.T) {
 					{Name: "$a", Value: ast.TextString{Value: "foo"}},
 					{Name: "$b", Value: ast.TextString{Value: "bar"}},
 				},
-				Condition: ast.AnyOf{Pattern: "them"},
+				Condition: ast.OfExpr{Quantifier: ast.Quantifier{Kind: ast.QuantAny}, Strings: []string{"them"}},
 			},
 		},
 	}
@@ -1939,3 +2068,131 @@ func TestScanFileMatchesScanMem(t *testing.T) {
 		}
 	}
 }
+
+func TestStringCountOffsetLength(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		data string
+		want bool
+	}{
+		{"literal_count", `rule t { strings: $a = "eval" condition: #a == 3 }`, "eval eval eval", true},
+		{"literal_count_too_low", `rule t { strings: $a = "eval" condition: #a > 3 }`, "eval eval eval", false},
+		{"literal_offset", `rule t { strings: $a = "eval" condition: @a[2] == 5 }`, "eval eval eval", true},
+		{"literal_length", `rule t { strings: $a = "eval" condition: !a[3] == 4 }`, "eval eval eval", true},
+		{"regex_count", `rule t { strings: $a = /eval\([a-z]+\)/ condition: #a == 3 }`, "eval(a) x eval(bb) y eval(ccc)", true},
+		{"regex_offset", `rule t { strings: $a = /eval\([a-z]+\)/ condition: @a[3] == 21 }`, "eval(a) x eval(bb) y eval(ccc)", true},
+		{"regex_length", `rule t { strings: $a = /eval\([a-z]+\)/ condition: !a[2] == 8 and !a[3] == 9 }`, "eval(a) x eval(bb) y eval(ccc)", true},
+		{"regex_at_second_match", `rule t { strings: $a = /eval\([a-z]+\)/ condition: $a at 10 }`, "eval(a) x eval(bb) y eval(ccc)", true},
+		{"regex_for_loop", `rule t { strings: $a = /eval\([a-z]+\)/ condition: for all i in (1..#a) : (!a[i] >= 7 and @a[i] < 30) }`, "eval(a) x eval(bb) y eval(ccc)", true},
+		{"hex_count", `rule t { strings: $a = { 4D 5A 90 ?? 00 } condition: #a == 2 }`, "MZ\x90\x00\x00....MZ\x90\x01\x00", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := parser.New().Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			rules, err := Compile(rs)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			var matches MatchRules
+			if err := rules.ScanMem([]byte(tt.data), 0, time.Second, &matches); err != nil {
+				t.Fatalf("ScanMem() error = %v", err)
+			}
+			if got := len(matches) > 0; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringModifiers(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		data string
+		want bool
+	}{
+		{"wide", `rule t { strings: $a = "eval" wide condition: $a }`, "e\x00v\x00a\x00l\x00", true},
+		{"wide_skips_ascii", `rule t { strings: $a = "eval" wide condition: $a }`, "eval", false},
+		{"ascii_wide", `rule t { strings: $a = "eval" ascii wide condition: #a == 2 }`, "eval e\x00v\x00a\x00l\x00", true},
+		{"wide_fullword", `rule t { strings: $a = "eval" wide fullword condition: $a }`, " \x00e\x00v\x00a\x00l\x00(\x00", true},
+		{"wide_fullword_embedded", `rule t { strings: $a = "eval" wide fullword condition: $a }`, "x\x00e\x00v\x00a\x00l\x00", false},
+		{"nocase", `rule t { strings: $a = "eval(" nocase condition: $a }`, "x=EvAl($_POST)", true},
+		{"nocase_count", `rule t { strings: $a = "eval" nocase condition: #a == 3 }`, "eval EVAL Eval", true},
+		{"nocase_mismatch", `rule t { strings: $a = "eval(" nocase condition: $a }`, "evil(", false},
+		{"nocase_wide", `rule t { strings: $a = "eval" nocase wide condition: $a }`, "E\x00v\x00A\x00l\x00", true},
+		{"nocase_fullword", `rule t { strings: $a = "eval" nocase fullword condition: $a }`, "xEVAL", false},
+		{"xor", `rule t { strings: $a = "eval" xor condition: $a }`, "EVAL", true},
+		{"xor_key", `rule t { strings: $a = "eval" xor(32) condition: $a }`, "EVAL", true},
+		{"xor_range_excludes", `rule t { strings: $a = "eval" xor(1-2) condition: $a }`, "EVAL", false},
+		{"xor_range", `rule t { strings: $a = "eval" xor(1-2) condition: $a }`, "dw`m", true},
+		{"base64wide", `rule t { strings: $a = "secret" base64wide condition: $a }`, "c\x002\x00V\x00j\x00c\x00m\x00V\x000\x00", true},
+		{"base64wide_skips_ascii", `rule t { strings: $a = "secret" base64wide condition: $a }`, "c2VjcmV0", false},
+		{"base64_alphabet", `rule t { strings: $a = "secret" base64("ZYXWVUTSRQPONMLKJIHGFEDCBAzyxwvutsrqponmlkjihgfedcba9876543210+/") condition: $a }`, "x7EqxnE9", true},
+		{"base64_alphabet_skips_standard", `rule t { strings: $a = "secret" base64("ZYXWVUTSRQPONMLKJIHGFEDCBAzyxwvutsrqponmlkjihgfedcba9876543210+/") condition: $a }`, "c2VjcmV0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := parser.New().Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			rules, err := Compile(rs)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			var matches MatchRules
+			if err := rules.ScanMem([]byte(tt.data), 0, time.Second, &matches); err != nil {
+				t.Fatalf("ScanMem() error = %v", err)
+			}
+			if got := len(matches) > 0; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrivateStrings(t *testing.T) {
+	rs, err := parser.New().Parse(`rule t {
+		strings:
+			$a = "eval" private
+			$b = "base64_decode"
+		condition: $a and $b
+	}`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	rules, err := Compile(rs)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	var matches MatchRules
+	if err := rules.ScanMem([]byte("eval(base64_decode($x))"), 0, time.Second, &matches); err != nil {
+		t.Fatalf("ScanMem() error = %v", err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(matches))
+	}
+	if len(matches[0].Strings) != 1 || matches[0].Strings[0].Name != "$b" {
+		t.Errorf("expected only $b to be reported, got %+v", matches[0].Strings)
+	}
+}
+
+func TestWideRegexUnsupported(t *testing.T) {
+	rs, err := parser.New().Parse(`rule t { strings: $a = /eval\(/ wide condition: $a }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := Compile(rs); err == nil {
+		t.Error("expected error for wide regex")
+	}
+	if _, err := CompileWithOptions(rs, CompileOptions{SkipInvalidRegex: true}); err != nil {
+		t.Errorf("expected wide regex to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,459 @@
+package scanner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/sansecio/yargo/ast"
+)
+
+// ValidationError is a semantic error in a rule, found by Validate.
+type ValidationError struct {
+	Span ast.Span // location of the offending node, zero for rules built by hand
+	Rule string
+	Msg  string
+}
+
+// Error formats the error as "file:line:column: rule "name": message",
+// without the location if it is unknown.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.Span.Start.Line > 0 {
+		if e.Span.File != "" {
+			b.WriteString(e.Span.File + ":")
+		}
+		fmt.Fprintf(&b, "%d:%d: ", e.Span.Start.Line, e.Span.Start.Column)
+	}
+	fmt.Fprintf(&b, "rule %q: %s", e.Rule, e.Msg)
+	return b.String()
+}
+
+// ValidationErrors is the list of errors Validate returns, in rule order.
+type ValidationErrors []*ValidationError
+
+// Error formats the errors one per line.
+func (l ValidationErrors) Error() string {
+	lines := make([]string, len(l))
+	for i, e := range l {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the errors, for errors.As and errors.Is.
+func (l ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, e := range l {
+		errs[i] = e
+	}
+	return errs
+}
+
+// builtinFuncs are the functions conditions can call without a module.
+// Each takes the offset to read an integer at.
+var builtinFuncs = []string{"uint8", "uint16", "uint32", "uint16be", "uint32be"}
+
+// Validate checks rs for rules that compile but cannot work as intended,
+// as Compile does unless CompileOptions.SkipValidation is set. It reports
+// duplicate rule names in a namespace, duplicate string names in a rule,
+// references to undefined strings, rules, identifiers and functions,
+// strings the condition never uses, calls with the wrong number of
+// arguments and operands of the wrong type. Identifiers may name loop
+// variables, the external variables of opts, imported modules and rules
+// of the same namespace. All errors are returned as ValidationErrors.
+//
+// Module values are only known while scanning, so the fields and
+// functions of modules are not checked.
+func Validate(rs *ast.RuleSet, opts CompileOptions) error {
+	v := &validator{
+		externals: make(map[string]any, len(opts.Externals)),
+		rules:     make(map[string]map[string]bool),
+	}
+	for name, value := range opts.Externals {
+		if n, ok := externalValue(value); ok {
+			v.externals[name] = n
+		}
+	}
+	for _, r := range rs.Rules {
+		if v.rules[r.Namespace] == nil {
+			v.rules[r.Namespace] = make(map[string]bool)
+		}
+		v.rules[r.Namespace][r.Name] = true
+	}
+
+	seen := make(map[string]map[string]bool)
+	for _, r := range rs.Rules {
+		v.rule = r
+		if seen[r.Namespace] == nil {
+			seen[r.Namespace] = make(map[string]bool)
+		}
+		if seen[r.Namespace][r.Name] {
+			v.errorf(r.Span, "duplicate rule %s", r.Name)
+		}
+		seen[r.Namespace][r.Name] = true
+		v.checkRule(r, rs.Imports)
+	}
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// exprType is the type of a condition expression, as far as it is known
+// before scanning.
+type exprType int
+
+const (
+	typeUnknown exprType = iota // module values
+	typeInt                     // integers and booleans
+	typeFloat
+	typeString
+)
+
+func (t exprType) String() string {
+	switch t {
+	case typeInt:
+		return "integer"
+	case typeFloat:
+		return "float"
+	case typeString:
+		return "string"
+	}
+	return "unknown"
+}
+
+// typeOf returns the type of an external variable value.
+func typeOf(v any) exprType {
+	switch v.(type) {
+	case int64:
+		return typeInt
+	case float64:
+		return typeFloat
+	case string:
+		return typeString
+	}
+	return typeUnknown
+}
+
+// validator holds the state of Validate.
+type validator struct {
+	errs      ValidationErrors
+	externals map[string]any             // external variable name -> value
+	rules     map[string]map[string]bool // namespace -> rule names
+
+	// State of the rule being checked.
+	rule         *ast.Rule
+	modules      []string
+	used         []bool   // strings referenced by the condition
+	vars         []string // for..in variables in scope
+	inStringLoop bool     // in the body of a for..of loop
+}
+
+func (v *validator) errorf(span ast.Span, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{Span: span, Rule: v.rule.Name, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) checkRule(r *ast.Rule, imports []string) {
+	names := make(map[string]bool, len(r.Strings))
+	for _, s := range r.Strings {
+		if s.Name != "$" && names[s.Name] {
+			v.errorf(s.Span, "duplicate string %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+	if r.Condition == nil {
+		return
+	}
+
+	v.modules = imports
+	v.used = make([]bool, len(r.Strings))
+	v.check(r.Condition)
+	for i, s := range r.Strings {
+		if !v.used[i] {
+			v.errorf(s.Span, "unreferenced string %s", s.Name)
+		}
+	}
+}
+
+// check checks an expression and returns its type.
+func (v *validator) check(expr ast.Expr) exprType {
+	switch e := expr.(type) {
+	case ast.StringRef:
+		v.stringRef(e.Name, e.Span)
+	case ast.StringCount:
+		v.stringRef(e.Name, e.Span)
+	case ast.StringOffset:
+		v.stringRef(e.Name, e.Span)
+		v.want(e.Index, typeInt, "index")
+	case ast.StringLength:
+		v.stringRef(e.Name, e.Span)
+		v.want(e.Index, typeInt, "index")
+	case ast.AtExpr:
+		v.stringRef(e.Ref.Name, e.Ref.Span)
+		v.want(e.Pos, typeInt, "offset")
+	case ast.InExpr:
+		v.stringRef(e.Ref.Name, e.Ref.Span)
+		v.want(e.Range.Start, typeInt, "range start")
+		v.want(e.Range.End, typeInt, "range end")
+	case ast.IntLit, ast.Filesize, ast.Entrypoint:
+	case ast.FloatLit:
+		return typeFloat
+	case ast.StringLit:
+		return typeString
+	case ast.FuncCall:
+		v.funcCall(e)
+	case ast.Ident:
+		return v.ident(e)
+	case ast.MemberExpr:
+		if obj, ok := e.Object.(ast.Ident); ok {
+			if t := v.ident(obj); t != typeUnknown {
+				v.errorf(e.Span, "%s is %s, not a structure", obj.Name, t)
+			}
+		} else {
+			v.check(e.Object)
+		}
+		return typeUnknown
+	case ast.IndexExpr:
+		v.check(e.Object)
+		v.check(e.Index)
+		return typeUnknown
+	case ast.CallExpr:
+		v.check(e.Func)
+		for _, arg := range e.Args {
+			v.check(arg)
+		}
+		return typeUnknown
+	case ast.BinaryExpr:
+		return v.binary(e)
+	case ast.UnaryExpr:
+		t := v.check(e.Operand)
+		switch {
+		case e.Op == "-" && t == typeString:
+			v.errorf(e.Span, "operator -: string operand, want number")
+		case e.Op == "-":
+			return t
+		case e.Op == "~" && (t == typeString || t == typeFloat):
+			v.errorf(e.Span, "operator ~: %s operand, want integer", t)
+		}
+	case ast.ParenExpr:
+		return v.check(e.Inner)
+	case ast.OfExpr:
+		v.quantifier(e.Quantifier)
+		v.stringSet(e.Strings, e.Span)
+		v.ruleSet(e.Rules, e.Span)
+	case ast.ForOfExpr:
+		v.quantifier(e.Quantifier)
+		v.stringSet(e.Strings, e.Span)
+		inStringLoop := v.inStringLoop
+		v.inStringLoop = true
+		v.check(e.Body)
+		v.inStringLoop = inStringLoop
+	case ast.ForInExpr:
+		v.quantifier(e.Quantifier)
+		switch it := e.Iterable.(type) {
+		case ast.Range:
+			v.want(it.Start, typeInt, "range start")
+			v.want(it.End, typeInt, "range end")
+			start, ok1 := constInt(it.Start)
+			end, ok2 := constInt(it.End)
+			if ok1 && ok2 && end >= start && uint64(end-start) >= maxLoopRange {
+				v.errorf(it.Span, "loop range of %d values exceeds %d", uint64(end-start)+1, maxLoopRange)
+			}
+		case ast.ValueList:
+			for _, value := range it.Values {
+				v.want(value, typeInt, "loop value")
+			}
+		}
+		v.vars = append(v.vars, e.Var)
+		v.check(e.Body)
+		v.vars = v.vars[:len(v.vars)-1]
+	}
+	return typeInt
+}
+
+// maxLoopRange is the largest number of values a for..in loop may
+// iterate over a range with constant bounds.
+const maxLoopRange = 1 << 20
+
+// constInt returns the value of an integer literal, possibly negated or
+// parenthesized.
+func constInt(expr ast.Expr) (int64, bool) {
+	switch e := expr.(type) {
+	case ast.IntLit:
+		return e.Value, true
+	case ast.ParenExpr:
+		return constInt(e.Inner)
+	case ast.UnaryExpr:
+		if n, ok := constInt(e.Operand); ok && e.Op == "-" {
+			return -n, true
+		}
+	}
+	return 0, false
+}
+
+// want checks an optional expression that must be of type t.
+func (v *validator) want(expr ast.Expr, t exprType, what string) {
+	if expr == nil {
+		return
+	}
+	if got := v.check(expr); got != typeUnknown && got != t {
+		v.errorf(ast.SpanOf(expr), "%s is %s, want %s", what, got, t)
+	}
+}
+
+// stringRef marks the string a reference names as used.
+func (v *validator) stringRef(name string, span ast.Span) {
+	if name == "$" && v.inStringLoop {
+		return // the string being iterated
+	}
+	found := false
+	for i, s := range v.rule.Strings {
+		if s.Name == name {
+			v.used[i] = true
+			found = true
+		}
+	}
+	if !found {
+		v.errorf(span, "undefined string %s", name)
+	}
+}
+
+// stringSet marks the strings of a set like "($a, $b*)" as used. Names
+// that are not strings are left to linkRules.
+func (v *validator) stringSet(names []string, span ast.Span) {
+	stringNames := make([]string, len(v.rule.Strings))
+	for i, s := range v.rule.Strings {
+		stringNames[i] = s.Name
+	}
+	for _, name := range names {
+		if name != "them" && !strings.HasPrefix(name, "$") {
+			continue
+		}
+		indices := matchingStringIndices(name, stringNames)
+		for _, i := range indices {
+			v.used[i] = true
+		}
+		switch {
+		case len(indices) > 0, name == "them":
+		case strings.HasSuffix(name, "*"):
+			v.errorf(span, "no string matches %s", name)
+		default:
+			v.errorf(span, "undefined string %s", name)
+		}
+	}
+}
+
+// ruleSet checks that the elements of a rule set like "(is_php, ws_*)"
+// name rules of the namespace.
+func (v *validator) ruleSet(names []string, span ast.Span) {
+	rules := v.rules[v.rule.Namespace]
+	for _, name := range names {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			matched := false
+			for r := range rules {
+				matched = matched || strings.HasPrefix(r, prefix)
+			}
+			if !matched {
+				v.errorf(span, "no rule matches %s", name)
+			}
+		} else if !rules[name] {
+			v.errorf(span, "undefined rule %s", name)
+		}
+	}
+}
+
+// ident returns the type of an identifier, resolved as evalValue does.
+func (v *validator) ident(e ast.Ident) exprType {
+	if slices.Contains(v.vars, e.Name) {
+		return typeInt
+	}
+	if value, ok := v.externals[e.Name]; ok {
+		return typeOf(value)
+	}
+	if slices.Contains(v.modules, e.Name) {
+		return typeUnknown
+	}
+	if v.rules[v.rule.Namespace][e.Name] {
+		return typeInt
+	}
+	v.errorf(e.Span, "undefined identifier %s", e.Name)
+	return typeUnknown
+}
+
+func (v *validator) funcCall(e ast.FuncCall) {
+	if !slices.Contains(builtinFuncs, e.Name) {
+		v.errorf(e.Span, "undefined function %s", e.Name)
+	} else if len(e.Args) != 1 {
+		v.errorf(e.Span, "%s takes 1 argument, got %d", e.Name, len(e.Args))
+	}
+	for _, arg := range e.Args {
+		v.want(arg, typeInt, "offset")
+	}
+}
+
+// quantifier checks the count or percentage of a quantifier.
+func (v *validator) quantifier(q ast.Quantifier) {
+	switch q.Kind {
+	case ast.QuantCount:
+		v.want(q.Value, typeInt, "count")
+		if n, ok := constInt(q.Value); ok && n < 0 {
+			v.errorf(ast.SpanOf(q.Value), "count %d is negative", n)
+		}
+	case ast.QuantPercent:
+		v.want(q.Value, typeInt, "percentage")
+		if lit, ok := q.Value.(ast.IntLit); ok && (lit.Value < 1 || lit.Value > 100) {
+			v.errorf(lit.Span, "percentage %d%% out of range 1-100", lit.Value)
+		}
+	}
+}
+
+// binary checks a binary expression and returns its type.
+func (v *validator) binary(e ast.BinaryExpr) exprType {
+	left := v.check(e.Left)
+	if e.Op == "matches" {
+		if left != typeUnknown && left != typeString {
+			v.errorf(e.Span, "operator matches: %s operand, want string", left)
+		}
+		if _, ok := e.Right.(ast.RegexLit); !ok {
+			v.errorf(ast.SpanOf(e.Right), "operator matches: right operand is not a regex")
+		}
+		return typeInt
+	}
+	right := v.check(e.Right)
+	operands := []exprType{left, right}
+
+	switch e.Op {
+	case "and", "or":
+	case "==", "!=", "<", "<=", ">", ">=":
+		if left != typeUnknown && right != typeUnknown && (left == typeString) != (right == typeString) {
+			v.errorf(e.Span, "cannot compare %s and %s", left, right)
+		}
+	case "contains", "icontains", "startswith", "istartswith", "endswith", "iendswith", "iequals":
+		for _, t := range operands {
+			if t != typeUnknown && t != typeString {
+				v.errorf(e.Span, "operator %s: %s operand, want string", e.Op, t)
+				break
+			}
+		}
+	case "+", "-", "*", "\\":
+		if slices.Contains(operands, typeString) {
+			v.errorf(e.Span, "operator %s: string operand, want number", e.Op)
+			return typeUnknown
+		}
+		switch {
+		case slices.Contains(operands, typeUnknown):
+			return typeUnknown
+		case slices.Contains(operands, typeFloat):
+			return typeFloat
+		}
+	default: // % & | ^ << >>
+		for _, t := range operands {
+			if t == typeString || t == typeFloat {
+				v.errorf(e.Span, "operator %s: %s operand, want integer", e.Op, t)
+				break
+			}
+		}
+	}
+	return typeInt
+}
@@ -0,0 +1,129 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sansecio/yargo/ast"
+	"github.com/sansecio/yargo/parser"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string // errors, in order
+	}{
+		// Valid rules.
+		{`rule a { strings: $a = "x" $b = "y" condition: $a and #b > 1 and @a[1] < !b[1] }`, nil},
+		{`rule a { strings: $ = "x" $ = "y" condition: $ }`, nil},
+		{`rule a { strings: $a1 = "x" $a2 = "y" $b = "z" condition: any of ($a*) and for all of ($b) : ($ at 0) }`, nil},
+		{`rule a { strings: $a = "x" condition: for any i in (1..#a) : (@a[i] < 10) }`, nil},
+		{`rule a { condition: uint16(0) == 0x5A4D and uint32be(filesize - 4) > 0 }`, nil},
+		{`rule a { condition: b and any of (b, c*) } rule b { condition: filesize > 0 } rule c1 { condition: b }`, nil},
+		{`rule a { condition: platform contains "magento" and version + ratio > 1 }`, nil},
+		{`import "pe" rule a { condition: pe.number_of_sections > 1 and pe.exports("x") }`, nil},
+		{`rule a { condition: 50% of (b) } rule b { condition: filesize > 0 }`, nil},
+		{`rule a { condition: filesize > 0 } rule a { condition: filesize > 1 }`, []string{`1:36: rule "a": duplicate rule a`}},
+
+		// Strings.
+		{`rule a { strings: $a = "x" $a = "y" condition: $a }`, []string{`1:28: rule "a": duplicate string $a`}},
+		{`rule a { strings: $a = "x" condition: $b }`, []string{
+			`1:39: rule "a": undefined string $b`,
+			`1:19: rule "a": unreferenced string $a`,
+		}},
+		{`rule a { strings: $a = "x" $b = "y" condition: $a }`, []string{`1:28: rule "a": unreferenced string $b`}},
+		{`rule a { strings: $a = "x" condition: $a and #c > 0 and @d[1] > 0 }`, []string{
+			`1:46: rule "a": undefined string $c`,
+			`1:57: rule "a": undefined string $d`,
+		}},
+		{`rule a { strings: $a = "x" condition: any of ($a, $b, $c*) }`, []string{
+			`1:39: rule "a": undefined string $b`,
+			`1:39: rule "a": no string matches $c*`,
+		}},
+		{`rule a { strings: $ = "x" condition: filesize > 0 }`, []string{`1:19: rule "a": unreferenced string $`}},
+
+		// Identifiers and rules.
+		{`rule a { condition: b }`, []string{`1:21: rule "a": undefined identifier b`}},
+		{`rule a { condition: pe.is_dll() }`, []string{`1:21: rule "a": undefined identifier pe`}},
+		{`rule a { condition: any of (b, c*) }`, []string{
+			`1:21: rule "a": undefined rule b`,
+			`1:21: rule "a": no rule matches c*`,
+		}},
+		{`rule a { condition: for any i in (1, 2) : (i > 1) and i > 0 }`, []string{`1:55: rule "a": undefined identifier i`}},
+		{`rule a { condition: platform.name == "x" }`, []string{`1:21: rule "a": platform is string, not a structure`}},
+
+		{`rule a { condition: for any i in (0..1048575) : (i == 1) }`, nil},
+		{`rule a { condition: for any i in (-1..3000000000) : (i < 0) }`, []string{`1:34: rule "a": loop range of 3000000002 values exceeds 1048576`}},
+
+		// Functions.
+		{`rule a { condition: int8(0) == 1 }`, []string{`1:21: rule "a": undefined function int8`}},
+		{`rule a { condition: uint8(0, 1) == 1 }`, []string{`1:21: rule "a": uint8 takes 1 argument, got 2`}},
+		{`rule a { condition: uint8("x") == 1 }`, []string{`1:27: rule "a": offset is string, want integer`}},
+
+		// Types.
+		{`rule a { condition: platform == 1 }`, []string{`1:21: rule "a": cannot compare string and integer`}},
+		{`rule a { condition: version contains "2" }`, []string{`1:21: rule "a": operator contains: integer operand, want string`}},
+		{`rule a { condition: version matches /2/ }`, []string{`1:21: rule "a": operator matches: integer operand, want string`}},
+		{`rule a { condition: platform + 1 > 0 }`, []string{`1:21: rule "a": operator +: string operand, want number`}},
+		{`rule a { condition: ratio % 2 == 0 }`, []string{`1:21: rule "a": operator %: float operand, want integer`}},
+		{`rule a { condition: -platform < 0 }`, []string{`1:21: rule "a": operator -: string operand, want number`}},
+		{`rule a { strings: $a = "x" condition: $a at "0" }`, []string{`1:45: rule "a": offset is string, want integer`}},
+		{`rule a { strings: $a = "x" condition: $a in (0..ratio) }`, []string{`1:49: rule "a": range end is float, want integer`}},
+		{`rule a { strings: $a = "x" condition: @a[ratio] > 0 }`, []string{`1:42: rule "a": index is float, want integer`}},
+		{`rule a { strings: $a = "x" condition: 150% of them }`, []string{`1:39: rule "a": percentage 150% out of range 1-100`}},
+		{`rule a { strings: $a = "x" condition: -1 of them }`, []string{`1:39: rule "a": count -1 is negative`}},
+		{`rule a { strings: $a = "x" condition: (#a - 5) of them }`, nil},
+		{`rule a { strings: $a = "x" condition: platform of them }`, []string{`1:39: rule "a": count is string, want integer`}},
+	}
+	externals := map[string]any{"platform": "magento2", "version": 2, "ratio": 0.5}
+	for _, tt := range tests {
+		rs, err := parser.New().Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.src, err)
+		}
+		err = Validate(rs, CompileOptions{Externals: externals})
+		var got []string
+		var errs ValidationErrors
+		if errors.As(err, &errs) {
+			for _, e := range errs {
+				got = append(got, e.Error())
+			}
+		} else if err != nil {
+			t.Errorf("Validate(%q) error = %v, want ValidationErrors", tt.src, err)
+			continue
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("Validate(%q) errors:\n%s\nwant:\n%s", tt.src, strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+		}
+	}
+}
+
+func TestCompileValidates(t *testing.T) {
+	rs, err := parser.New().Parse(`rule a { strings: $a = "x" $b = "y" condition: $a }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, err := Compile(rs); err == nil || err.Error() != `1:28: rule "a": unreferenced string $b` {
+		t.Errorf("Compile() error = %v, want unreferenced string error", err)
+	}
+	if _, err := CompileWithOptions(rs, CompileOptions{SkipValidation: true}); err != nil {
+		t.Errorf("CompileWithOptions(SkipValidation) error = %v", err)
+	}
+}
+
+func TestValidateMatchesOperand(t *testing.T) {
+	rs, err := parser.New().Parse(`rule a { condition: platform matches /x/ }`)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	// The grammar only takes a regex after matches, so build the
+	// condition the parser cannot produce.
+	e := rs.Rules[0].Condition.(ast.BinaryExpr)
+	e.Right = ast.StringLit{Value: "x", Span: ast.SpanOf(e.Right)}
+	rs.Rules[0].Condition = e
+	err = Validate(rs, CompileOptions{Externals: map[string]any{"platform": "magento2"}})
+	if want := `1:38: rule "a": operator matches: right operand is not a regex`; err == nil || err.Error() != want {
+		t.Errorf("Validate() error = %v, want %q", err, want)
+	}
+}